@@ -0,0 +1,230 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Returns the absolute value of a sample, normalized to the range [0, 1].
+func amplitude(sample int16) float64 {
+	if sample < 0 {
+		return -float64(sample) / -float64(MinInt16)
+	}
+	return float64(sample) / -float64(MinInt16)
+}
+
+// Returns an amplitude envelope of a channel, as the peak amplitude (in the range [0, 1])
+// of each of the specified number of equally sized windows of samples,
+// such as for drawing a thumbnail of a waveform.
+func (c *Clip) Envelope(chanNum, points int) ([]float64, error) {
+	if chanNum < 0 || chanNum >= len(c.Samples) {
+		return nil, fmt.Errorf("Channel %d does not exist in a clip with %d channels.",
+			chanNum, len(c.Samples))
+	}
+	if points <= 0 {
+		return nil, fmt.Errorf("Envelope requires a positive number of points, not %d.", points)
+	}
+	samples := c.Samples[chanNum]
+	envelope := make([]float64, points)
+	for i := range envelope {
+		start := i * len(samples) / points
+		end := (i + 1) * len(samples) / points
+		for _, sample := range samples[start:end] {
+			if a := amplitude(sample); a > envelope[i] {
+				envelope[i] = a
+			}
+		}
+	}
+	return envelope, nil
+}
+
+// Returns the results of a function of each window of a number of samples per channel,
+// such as to build a custom meter. Windows are consecutive, without overlap, and the last
+// window is shorter if the clip is not a whole number of windows long. Each window has
+// a slice of samples for each channel, which may be shorter (or empty) for shorter channels.
+// The window shares the clip's sample data, so the function must not modify it,
+// and there are no results for a window size that is not positive.
+func (c *Clip) WindowedReduce(windowSize int, fn func(window [][]int16) float64) []float64 {
+	if windowSize <= 0 {
+		return nil
+	}
+	length := c.maxLenPerChannel()
+	results := make([]float64, 0, (length+windowSize-1)/windowSize)
+	window := make([][]int16, len(c.Samples))
+	for start := 0; start < length; start += windowSize {
+		for chanNum, samples := range c.Samples {
+			from, to := start, start+windowSize
+			if to > len(samples) {
+				to = len(samples)
+			}
+			if from > to {
+				from = to
+			}
+			window[chanNum] = samples[from:to]
+		}
+		results = append(results, fn(window))
+	}
+	return results
+}
+
+// Returns a histogram of the sample values of each channel, counting the samples within
+// each of a number of equally sized bins spanning all sample values from MinInt16 to MaxInt16,
+// such as to find DC offset (an off-center peak), clipping (full outer bins),
+// or a reduced bit depth (many empty bins).
+func (c *Clip) Histogram(bins int) ([][]int, error) {
+	if bins <= 0 {
+		return nil, fmt.Errorf("Histogram requires a positive number of bins, not %d.", bins)
+	}
+	const numValues = 1 << 16
+	histograms := make([][]int, len(c.Samples))
+	for chanNum, samples := range c.Samples {
+		histograms[chanNum] = make([]int, bins)
+		for _, sample := range samples {
+			histograms[chanNum][(int(sample)-int(MinInt16))*bins/numValues]++
+		}
+	}
+	return histograms, nil
+}
+
+const (
+	onsetFrame       = 5 * time.Millisecond  // The duration of frames whose energy is compared to find onsets.
+	onsetLookBack    = 3                     // The number of preceding frames a frame's energy rises from.
+	onsetFloor       = -60                   // The level (in dBFS) below which frames are considered silent.
+	minOnsetInterval = 50 * time.Millisecond // The shortest duration between detected onsets.
+)
+
+// Returns the level (in dBFS) of the mean energy of each frame of a mono sum of the clip,
+// along with the mono sum, and the number of samples in each frame.
+func (c *Clip) frameLevels(frameLen int) (levels []float64, mono []float64) {
+	mono = make([]float64, c.maxLenPerChannel())
+	for _, samples := range c.Samples {
+		for i, sample := range samples {
+			mono[i] += float64(sample) / -float64(MinInt16) / float64(len(c.Samples))
+		}
+	}
+	levels = make([]float64, len(mono)/frameLen)
+	for i := range levels {
+		var energy float64
+		for _, x := range mono[i*frameLen : (i+1)*frameLen] {
+			energy += x * x
+		}
+		levels[i] = 10 * math.Log10(energy/float64(frameLen)+1e-12)
+	}
+	return levels, mono
+}
+
+// Returns the times of onsets (the starts of transients, such as drum hits) in the clip,
+// in order, such as to slice a drum loop into hits with SliceTime. Onsets are found where
+// the energy of a mono sum of the clip rises sharply over a few milliseconds.
+// The sensitivity, from 0 to 1, sets how sharp a rise is detected: 0 detects only rises
+// of 30 dB (like hits after silence) and 1 detects rises of 6 dB (like hits over other sounds).
+func (c *Clip) DetectOnsets(sensitivity float64) []time.Duration {
+	if c.SampleRate <= 0 {
+		return nil
+	}
+	sensitivity = math.Max(0, math.Min(1, sensitivity))
+	threshold := 6 + 24*(1-sensitivity)
+	frameLen := c.numSamples(onsetFrame)
+	if frameLen < 1 {
+		frameLen = 1
+	}
+	levels, mono := c.frameLevels(frameLen)
+	rise := make([]float64, len(levels))
+	for i, level := range levels {
+		if level < onsetFloor {
+			continue
+		}
+		from := level
+		for j := i - onsetLookBack; j < i; j++ {
+			if j < 0 {
+				from = math.Min(from, onsetFloor) // Audio rises from silence before the clip.
+			} else {
+				from = math.Min(from, levels[j])
+			}
+		}
+		rise[i] = level - from
+	}
+	var onsets []time.Duration
+	last := -c.numSamples(minOnsetInterval)
+	for i, r := range rise {
+		if r < threshold || (i+1 < len(rise) && rise[i+1] > r) {
+			continue // Not the sharpest rise of a transient.
+		}
+		// Place the onset at the first sample reaching half the peak near the rise.
+		start, end := (i-onsetLookBack)*frameLen, (i+1)*frameLen
+		if start < 0 {
+			start = 0
+		}
+		var peak float64
+		for _, x := range mono[start:end] {
+			peak = math.Max(peak, math.Abs(x))
+		}
+		onset := start
+		for onset < end && math.Abs(mono[onset]) < peak/2 {
+			onset++
+		}
+		if onset-last < c.numSamples(minOnsetInterval) {
+			continue
+		}
+		last = onset
+		onsets = append(onsets, time.Duration(int64(onset)*int64(time.Second)/int64(c.SampleRate)))
+	}
+	return onsets
+}
+
+const (
+	minTempo       = 80 // Tempos are estimated from minTempo up to (but not including) twice it, in BPM.
+	tempoTolerance = 2  // How close (in BPM) intervals between onsets must be to agree on a tempo.
+)
+
+// Returns the tempo of the clip in quarter notes per minute (BPM), such as to set the tempo
+// of a MIDI clock to play along with a loop, estimated from the intervals between its onsets
+// (see DetectOnsets). As intervals between onsets may be of any note length, tempos are
+// estimated from 80 BPM up to 160 BPM, so a loop of eighth notes at 70 BPM is estimated at 140 BPM.
+// An error is returned if the clip has too few onsets, or no tempo agrees with most of them.
+func (c *Clip) EstimateBPM() (float64, error) {
+	onsets := c.DetectOnsets(0.5)
+	if len(onsets) < 4 {
+		return 0, fmt.Errorf("Clip has %d onsets, too few to estimate a tempo.", len(onsets))
+	}
+	// The tempo of the intervals between each onset and the few following it,
+	// doubled or halved until within the range of tempos.
+	var tempos []float64
+	for i := range onsets {
+		for j := i + 1; j < len(onsets) && j <= i+4; j++ {
+			tempo := float64(time.Minute) / float64(onsets[j]-onsets[i])
+			for tempo < minTempo {
+				tempo *= 2
+			}
+			for tempo >= 2*minTempo {
+				tempo /= 2
+			}
+			tempos = append(tempos, tempo)
+		}
+	}
+	// Choose the tempo that the most intervals agree with, and average those that do.
+	best, agreeing := 0.0, 0
+	for _, candidate := range tempos {
+		var sum float64
+		n := 0
+		for _, tempo := range tempos {
+			// Tempos at the top and bottom of the range of tempos agree when doubled or halved.
+			for _, t := range []float64{tempo, tempo / 2, tempo * 2} {
+				if math.Abs(t-candidate) <= tempoTolerance {
+					sum += t
+					n++
+					break
+				}
+			}
+		}
+		if n > agreeing {
+			best, agreeing = sum/float64(n), n
+		}
+	}
+	if agreeing*2 < len(tempos) {
+		return 0, fmt.Errorf("Tempo is ambiguous, with %d of %d intervals between onsets agreeing on %.1f BPM.",
+			agreeing, len(tempos), best)
+	}
+	return best, nil
+}
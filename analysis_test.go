@@ -0,0 +1,160 @@
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEnvelope(t *testing.T) {
+	c := NewClip(1)
+	c.Samples[0] = []int16{0, MaxInt16, 0, -16384, 0, MinInt16, 0, 0}
+	envelope, err := c.Envelope(0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{float64(MaxInt16) / 32768, 0.5, 1, 0}
+	if len(envelope) != len(expected) {
+		t.Fatalf("Expected %d points instead of %d\n", len(expected), len(envelope))
+	}
+	for i, e := range expected {
+		if envelope[i] != e {
+			t.Errorf("Expected %v instead of %v at point %d\n", e, envelope[i], i)
+		}
+	}
+	if _, err := c.Envelope(1, 4); err == nil {
+		t.Errorf("Expected an error for a channel that does not exist.")
+	}
+	if _, err := c.Envelope(0, 0); err == nil {
+		t.Errorf("Expected an error for zero points.")
+	}
+}
+
+func TestWindowedReduce(t *testing.T) {
+	c := NewClip(2)
+	c.Samples[0] = []int16{1, 2, 3, 4, 5, 6, 7}
+	c.Samples[1] = []int16{10, 20, 30}
+	sum := func(window [][]int16) float64 {
+		var total float64
+		for _, samples := range window {
+			for _, sample := range samples {
+				total += float64(sample)
+			}
+		}
+		return total
+	}
+	results := c.WindowedReduce(3, sum)
+	expected := []float64{66, 15, 7}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d windows instead of %d\n", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if results[i] != e {
+			t.Errorf("Expected %v instead of %v for window %d\n", e, results[i], i)
+		}
+	}
+	if results := c.WindowedReduce(0, sum); results != nil {
+		t.Errorf("Expected no results for a window size of 0.")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	c := NewClip(2)
+	c.Samples[0] = []int16{MinInt16, -1, 0, 0, 1, MaxInt16}
+	c.Samples[1] = []int16{100, 200}
+	histograms, err := c.Histogram(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]int{{1, 1, 3, 1}, {0, 0, 2, 0}}
+	for chanNum, counts := range expected {
+		for bin, count := range counts {
+			if actual := histograms[chanNum][bin]; actual != count {
+				t.Errorf("Expected %d instead of %d in bin %d on channel %d\n", count, actual, bin, chanNum)
+			}
+		}
+	}
+	histograms, _ = c.Histogram(1 << 16)
+	if histograms[0][0] != 1 || histograms[0][1<<15] != 2 || histograms[0][1<<16-1] != 1 {
+		t.Errorf("Expected a bin for every sample value.")
+	}
+	if _, err := c.Histogram(0); err == nil {
+		t.Errorf("Expected an error for 0 bins.")
+	}
+}
+
+// Returns a clip of a click train: a quiet tone with decaying clicks of an amplitude
+// at regular intervals, and the times of the clicks.
+func newClickTrain(numClicks int, interval time.Duration, amplitude float64) (*Clip, []time.Duration) {
+	c := NewClip(2)
+	c.SampleRate = 44100
+	var clicks []time.Duration
+	n := c.numSamples(interval*time.Duration(numClicks) + time.Second/4)
+	mono := make([]float64, n)
+	for i := range mono {
+		mono[i] = 30 * math.Sin(2*math.Pi*220*float64(i)/44100)
+	}
+	for k := 0; k < numClicks; k++ {
+		at := time.Second/10 + interval*time.Duration(k)
+		clicks = append(clicks, at)
+		start := c.numSamples(at)
+		for i := 0; i < c.numSamples(20*time.Millisecond); i++ {
+			decay := math.Exp(-float64(i) / 200)
+			mono[start+i] += amplitude * decay * math.Sin(2*math.Pi*1500*float64(i)/44100+math.Pi/2)
+		}
+	}
+	for chanNum := range c.Samples {
+		for _, x := range mono {
+			c.Samples[chanNum] = append(c.Samples[chanNum], int16(x))
+		}
+	}
+	return c, clicks
+}
+
+func TestDetectOnsets(t *testing.T) {
+	c, clicks := newClickTrain(8, time.Second/4, 20000)
+	onsets := c.DetectOnsets(0.5)
+	if len(onsets) != len(clicks) {
+		t.Fatalf("Expected %d onsets instead of %d: %v\n", len(clicks), len(onsets), onsets)
+	}
+	for i, click := range clicks {
+		if d := onsets[i] - click; d < -2*time.Millisecond || d > 2*time.Millisecond {
+			t.Errorf("Expected an onset at %v instead of %v\n", click, onsets[i])
+		}
+	}
+	quiet, _ := newClickTrain(4, time.Second/4, 300) // About 13 dB above silence.
+	if onsets := quiet.DetectOnsets(1); len(onsets) != 4 {
+		t.Errorf("Expected %d onsets at full sensitivity instead of %d\n", 4, len(onsets))
+	}
+	if onsets := quiet.DetectOnsets(0); len(onsets) != 0 {
+		t.Errorf("Expected no onsets at the least sensitivity instead of %d\n", len(onsets))
+	}
+	if onsets := NewClip(1).DetectOnsets(0.5); len(onsets) != 0 {
+		t.Errorf("Expected no onsets in an empty clip.")
+	}
+}
+
+func TestEstimateBPM(t *testing.T) {
+	for _, test := range []struct {
+		interval time.Duration
+		bpm      float64
+	}{
+		{time.Second / 2, 120},
+		{time.Second / 4, 120}, // Sixteenth notes at 60 BPM or eighth notes at 120 BPM.
+		{time.Second * 60 / 150, 150},
+		{time.Second * 60 / 90, 90},
+	} {
+		c, _ := newClickTrain(12, test.interval, 20000)
+		bpm, err := c.EstimateBPM()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(bpm-test.bpm) > 0.5 {
+			t.Errorf("Expected %v BPM instead of %v for clicks every %v\n", test.bpm, bpm, test.interval)
+		}
+	}
+	c, _ := newClickTrain(3, time.Second/2, 20000)
+	if _, err := c.EstimateBPM(); err == nil {
+		t.Errorf("Expected an error for too few onsets.")
+	}
+}
@@ -0,0 +1,100 @@
+package audio
+
+import "time"
+
+// An Effect processes a clip in place, such as to apply gain or distortion.
+// Effects can be combined into a reusable chain of processing with Chain.
+type Effect interface {
+	Apply(c *Clip) error
+}
+
+// An EffectFunc is a function used as an Effect.
+type EffectFunc func(c *Clip) error
+
+func (f EffectFunc) Apply(c *Clip) error {
+	return f(c)
+}
+
+// Returns an Effect applying effects in order, stopping at the first that errors.
+// Samples clipped by an effect (as reported by a *ClippingError) don't stop the chain,
+// which then returns a *ClippingError of the samples clipped by every effect.
+func Chain(effects ...Effect) Effect {
+	return EffectFunc(func(c *Clip) error {
+		var clipped []int
+		for _, e := range effects {
+			err := e.Apply(c)
+			if err == nil {
+				continue
+			}
+			clippingErr, ok := err.(*ClippingError)
+			if !ok {
+				return err
+			}
+			for chanNum, n := range clippingErr.Clipped {
+				if chanNum == len(clipped) {
+					clipped = append(clipped, 0)
+				}
+				clipped[chanNum] += n
+			}
+		}
+		return clippingError(clipped)
+	})
+}
+
+// Returns an Effect applying gain in decibels, as per Clip.Gain.
+func GainEffect(dB float64) Effect {
+	return EffectFunc(func(c *Clip) error { return c.Gain(dB) })
+}
+
+// Returns an Effect applying a gain envelope, as per Clip.ApplyGainEnvelope.
+func GainEnvelopeEffect(points []EnvelopePoint) Effect {
+	return EffectFunc(func(c *Clip) error { return c.ApplyGainEnvelope(points) })
+}
+
+// Returns an Effect normalizing the loudness of clips, as per Clip.NormalizeLUFS.
+func NormalizeLUFSEffect(targetLUFS float64) Effect {
+	return EffectFunc(func(c *Clip) error { return c.NormalizeLUFS(targetLUFS) })
+}
+
+// Returns an Effect soft clipping clips, as per Clip.SoftClip.
+func SoftClipEffect(drive float64) Effect {
+	return EffectFunc(func(c *Clip) error { return c.SoftClip(drive) })
+}
+
+// Returns an Effect widening or narrowing stereo clips, as per Clip.StereoWidth.
+func StereoWidthEffect(width float64) Effect {
+	return EffectFunc(func(c *Clip) error { return c.StereoWidth(width) })
+}
+
+// Returns an Effect ring modulating clips, as per Clip.RingMod.
+func RingModEffect(carrierHz float64) Effect {
+	return EffectFunc(func(c *Clip) error { return c.RingMod(carrierHz) })
+}
+
+// Returns an Effect applying vibrato, as per Clip.Vibrato.
+func VibratoEffect(rateHz, depthMs float64) Effect {
+	return EffectFunc(func(c *Clip) error { return c.Vibrato(rateHz, depthMs) })
+}
+
+// Returns an Effect convolving clips with an impulse response, as per Clip.Convolve,
+// replacing the samples of the clip with the longer, convolved samples.
+func ConvolveEffect(ir *Clip) Effect {
+	return EffectFunc(func(c *Clip) error {
+		convolved, err := c.Convolve(ir)
+		if convolved != nil {
+			c.Samples = convolved.Samples
+		}
+		return err
+	})
+}
+
+// Returns an Effect making clips loop seamlessly, as per Clip.MakeSeamless.
+func MakeSeamlessEffect(fade time.Duration) Effect {
+	return EffectFunc(func(c *Clip) error { return c.MakeSeamless(fade) })
+}
+
+// An Effect reversing clips, as per Clip.Reverse.
+var ReverseEffect Effect = EffectFunc(func(c *Clip) error {
+	c.Reverse()
+	return nil
+})
@@ -0,0 +1,34 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	c := NewClip(1)
+	c.Samples[0] = []int16{1000, 2000, 20000}
+	doubled := 20 * math.Log10(2)
+	if err, ok := Chain(GainEffect(doubled), ReverseEffect, GainEffect(doubled)).Apply(c).(*ClippingError); !ok {
+		t.Errorf("Expected a *ClippingError instead of %v", err)
+	} else if err.Clipped[0] != 2 {
+		t.Errorf("Expected 2 clipped samples across the chain instead of %d\n", err.Clipped[0])
+	}
+	expected := []int16{MaxInt16, 8000, 4000}
+	for i, e := range expected {
+		if actual := c.Samples[0][i]; actual != e {
+			t.Errorf("Expected %d instead of %d at offset %d\n", e, actual, i)
+		}
+	}
+	// The chain stops at the first effect that errors.
+	c.Samples[0] = []int16{1000}
+	if err := Chain(StereoWidthEffect(2), GainEffect(doubled)).Apply(c); err == nil {
+		t.Errorf("Expected an error for the stereo width of a mono clip.")
+	}
+	if c.Samples[0][0] != 1000 {
+		t.Errorf("Expected the effects following an error not to be applied.")
+	}
+	if err := Chain().Apply(c); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,236 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// A ChannelLayout is a set of speaker positions, one per channel, as per the channel mask
+// of extensible wave files. Channels are ordered by the bit of their speaker, lowest first.
+type ChannelLayout int
+
+// Speaker positions, which are combined into layouts.
+const (
+	SpeakerFrontLeft ChannelLayout = 1 << iota
+	SpeakerFrontRight
+	SpeakerFrontCenter
+	SpeakerLowFrequency
+	SpeakerBackLeft
+	SpeakerBackRight
+	SpeakerFrontLeftOfCenter
+	SpeakerFrontRightOfCenter
+	SpeakerBackCenter
+	SpeakerSideLeft
+	SpeakerSideRight
+	SpeakerTopCenter
+	SpeakerTopFrontLeft
+	SpeakerTopFrontCenter
+	SpeakerTopFrontRight
+	SpeakerTopBackLeft
+	SpeakerTopBackCenter
+	SpeakerTopBackRight
+)
+
+// Common layouts. Any other combination of speakers is a custom layout.
+const (
+	LayoutMono     = SpeakerFrontCenter
+	LayoutStereo   = SpeakerFrontLeft | SpeakerFrontRight
+	Layout5Point1  = LayoutStereo | SpeakerFrontCenter | SpeakerLowFrequency | SpeakerBackLeft | SpeakerBackRight
+	Layout7Point1  = Layout5Point1 | SpeakerSideLeft | SpeakerSideRight
+	speakersOnLeft = SpeakerFrontLeftOfCenter | SpeakerBackLeft | SpeakerSideLeft |
+		SpeakerTopFrontLeft | SpeakerTopBackLeft
+	speakersOnRight = SpeakerFrontRightOfCenter | SpeakerBackRight | SpeakerSideRight |
+		SpeakerTopFrontRight | SpeakerTopBackRight
+	speakersSurrounding = SpeakerBackLeft | SpeakerBackRight | SpeakerSideLeft | SpeakerSideRight
+)
+
+// Returns the layout usually meant by a number of channels, or 0 if there is none.
+func defaultLayout(numChannels int) ChannelLayout {
+	switch numChannels {
+	case 1:
+		return LayoutMono
+	case 2:
+		return LayoutStereo
+	case 6:
+		return Layout5Point1
+	case 8:
+		return Layout7Point1
+	}
+	return 0
+}
+
+// Returns the number of channels of the layout.
+func (l ChannelLayout) NumChannels() int {
+	return bits.OnesCount(uint(l))
+}
+
+// Returns the speaker position of each channel of the layout, in order.
+func (l ChannelLayout) Speakers() []ChannelLayout {
+	speakers := make([]ChannelLayout, 0, l.NumChannels())
+	for l != 0 {
+		speaker := l & -l // The lowest bit.
+		speakers = append(speakers, speaker)
+		l &^= speaker
+	}
+	return speakers
+}
+
+// Returns the speaker position of each channel of the clip, as per its layout, or else as per
+// the layout usually meant by its number of channels, or nil if the positions are unknown.
+func (c *Clip) speakers() []ChannelLayout {
+	if c.Layout != 0 && c.Layout.NumChannels() == len(c.Samples) {
+		return c.Layout.Speakers()
+	}
+	if l := defaultLayout(len(c.Samples)); l != 0 {
+		return l.Speakers()
+	}
+	return nil
+}
+
+// Returns the gains a speaker is downmixed to stereo (left and right) with, as per
+// ITU-R BS.775: the LFE is omitted, and other speakers beside the front left and right
+// are attenuated by 3 dB, with centered speakers split evenly across both sides.
+func stereoGains(speaker ChannelLayout) (left, right float64) {
+	switch {
+	case speaker == SpeakerLowFrequency:
+		return 0, 0
+	case speaker == SpeakerFrontLeft:
+		return 1, 0
+	case speaker == SpeakerFrontRight:
+		return 0, 1
+	case speaker&speakersOnLeft != 0:
+		return math.Sqrt2 / 2, 0
+	case speaker&speakersOnRight != 0:
+		return 0, math.Sqrt2 / 2
+	}
+	return math.Sqrt2 / 2, math.Sqrt2 / 2
+}
+
+// Returns the gains to downmix channels of speakers with (by output channel, then input channel),
+// normalized so that each output channel's gains sum to 1, which prevents clipping.
+// Unknown speakers (in a nil slice) are mixed to mono equally.
+func downmixGains(speakers []ChannelLayout, numChannels, n int) [][]float64 {
+	gains := make([][]float64, n)
+	for out := range gains {
+		gains[out] = make([]float64, numChannels)
+	}
+	for in := 0; in < numChannels; in++ {
+		switch {
+		case speakers == nil:
+			gains[0][in] = 1
+		case n == 1:
+			if speakers[in] != SpeakerLowFrequency {
+				gains[0][in] = 1
+			}
+		default:
+			gains[0][in], gains[1][in] = stereoGains(speakers[in])
+		}
+	}
+	for _, g := range gains {
+		var sum float64
+		for _, gain := range g {
+			sum += gain
+		}
+		for in := range g {
+			if sum > 0 {
+				g[in] /= sum
+			}
+		}
+	}
+	return gains
+}
+
+// Returns channels mixed from the channels of the clip with gains by output and input channel.
+func (c *Clip) mixChannels(gains [][]float64, length int) [][]int16 {
+	mixed := make([][]int16, len(gains))
+	for out, g := range gains {
+		sums := make([]float64, length)
+		for in, samples := range c.Samples {
+			if g[in] == 0 {
+				continue
+			}
+			for i, sample := range samples {
+				sums[i] += g[in] * float64(sample)
+			}
+		}
+		mixed[out] = make([]int16, length)
+		for i, sum := range sums {
+			mixed[out][i] = int16(math.Floor(sum + 0.5))
+		}
+	}
+	return mixed
+}
+
+// Returns a copy of the clip with a different number of channels. Converting from mono
+// duplicates the channel to every channel, and converting to more channels copies each
+// channel and adds silent channels after them. Converting to mono or stereo downmixes the
+// channels as per the speaker positions of their layout (see stereoGains), omitting the LFE,
+// or averages all channels for mono if the positions are unknown. Converting to fewer channels
+// otherwise is an error. Channels of varying length are padded with silence to the length
+// of the longest channel.
+func (c *Clip) ChangeChannelCount(n int) (*Clip, error) {
+	numChannels := len(c.Samples)
+	speakers := c.speakers()
+	switch {
+	case n <= 0:
+		return nil, fmt.Errorf("Cannot convert to %d channels.", n)
+	case numChannels == 0:
+		return nil, fmt.Errorf("Cannot convert a clip without channels to %d channels.", n)
+	case n < numChannels && n != 1 && (n != 2 || speakers == nil):
+		return nil, fmt.Errorf("Cannot downmix %d channels to %d channels.", numChannels, n)
+	}
+	converted := NewClip(n)
+	converted.Name = c.Name
+	converted.SampleRate = c.SampleRate
+	converted.BroadcastChunk = c.BroadcastChunk
+	converted.SourceFormat = c.SourceFormat
+	length := c.maxLenPerChannel()
+	switch {
+	case n == numChannels:
+		converted.Layout = c.Layout
+		for chanNum := range converted.Samples {
+			converted.Samples[chanNum] = make([]int16, length)
+			copy(converted.Samples[chanNum], c.Samples[chanNum])
+		}
+	case numChannels == 1:
+		for chanNum := range converted.Samples {
+			converted.Samples[chanNum] = make([]int16, length)
+			copy(converted.Samples[chanNum], c.Samples[0])
+		}
+	case n < numChannels:
+		converted.Layout = defaultLayout(n)
+		converted.Samples = c.mixChannels(downmixGains(speakers, numChannels, n), length)
+	default:
+		for chanNum := range converted.Samples {
+			converted.Samples[chanNum] = make([]int16, length)
+			if chanNum < numChannels {
+				copy(converted.Samples[chanNum], c.Samples[chanNum])
+			}
+		}
+	}
+	return converted, nil
+}
+
+// Returns whether two channels of the clip have identical samples, such as
+// the channels of a "stereo" clip that is really dual-mono.
+func (c *Clip) ChannelsIdentical(a, b int) (bool, error) {
+	for _, chanNum := range []int{a, b} {
+		if chanNum < 0 || chanNum >= len(c.Samples) {
+			return false, fmt.Errorf("Channel %d does not exist in a clip of %d channels.",
+				chanNum, len(c.Samples))
+		}
+	}
+	return compareSamples(c.Samples[a], c.Samples[b], b) == nil, nil
+}
+
+// Returns whether every channel of the clip has identical samples, in which case
+// the clip could be converted to mono without losing any audio.
+func (c *Clip) IsMonoContent() bool {
+	for chanNum := 1; chanNum < len(c.Samples); chanNum++ {
+		if same, _ := c.ChannelsIdentical(0, chanNum); !same {
+			return false
+		}
+	}
+	return true
+}
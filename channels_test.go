@@ -0,0 +1,115 @@
+package audio
+
+import "testing"
+
+func TestChangeChannelCount(t *testing.T) {
+	tests := []struct {
+		in  [][]int16
+		n   int
+		out [][]int16 // Nil for conversions expected to fail.
+	}{
+		{[][]int16{{1, 2}, {3, 4}}, 2, [][]int16{{1, 2}, {3, 4}}},
+		{[][]int16{{1, 2}, {3, 5}}, 1, [][]int16{{2, 4}}},
+		{[][]int16{{1, 2}, {3}}, 1, [][]int16{{2, 1}}},
+		{[][]int16{{1, 2}}, 2, [][]int16{{1, 2}, {1, 2}}},
+		{[][]int16{{1, 2}}, 6, [][]int16{{1, 2}, {1, 2}, {1, 2}, {1, 2}, {1, 2}, {1, 2}}},
+		{[][]int16{{1, 2}, {3, 4}}, 4, [][]int16{{1, 2}, {3, 4}, {0, 0}, {0, 0}}},
+		{[][]int16{{1}, {2}, {3}, {4}, {5}}, 1, [][]int16{{3}}},
+		{[][]int16{{1}, {2}, {3}, {4}, {5}}, 2, nil},
+		{[][]int16{{1}, {2}, {3}, {4}, {5}}, 3, nil},
+		// 5.1 surround (assumed of 6 channels), downmixed without the LFE.
+		{[][]int16{{1000}, {2000}, {3000}, {4000}, {500}, {600}}, 2, [][]int16{{1439}, {1883}}},
+		{[][]int16{{1000}, {2000}, {3000}, {4000}, {500}, {600}}, 1, [][]int16{{1420}}},
+		{[][]int16{{1000}, {2000}, {3000}, {4000}, {500}, {600}}, 4, nil},
+		{[][]int16{{1, 2}}, 0, nil},
+		{[][]int16{}, 2, nil},
+	}
+	for _, test := range tests {
+		c := NewClip(len(test.in))
+		c.SampleRate = 44100
+		copy(c.Samples, test.in)
+		converted, err := c.ChangeChannelCount(test.n)
+		if test.out == nil {
+			if err == nil {
+				t.Errorf("Expected an error converting %d channels to %d channels.", len(test.in), test.n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Could not convert %d channels to %d channels: %v", len(test.in), test.n, err)
+			continue
+		}
+		if converted.SampleRate != c.SampleRate {
+			t.Errorf("Expected sample rate %d instead of %d\n", c.SampleRate, converted.SampleRate)
+		}
+		expected := &Clip{Samples: test.out}
+		if same, err := converted.IsEqual(expected); !same {
+			t.Errorf("Converting %d channels to %d channels: %v", len(test.in), test.n, err)
+		}
+	}
+}
+
+func TestIsMonoContent(t *testing.T) {
+	c := NewClip(3)
+	c.Samples[0] = []int16{1, 2, 3}
+	c.Samples[1] = []int16{1, 2, 3}
+	c.Samples[2] = []int16{1, 2, 3}
+	if !c.IsMonoContent() {
+		t.Errorf("Expected identical channels to be mono content.")
+	}
+	c.Samples[2] = []int16{1, 2, 4}
+	if c.IsMonoContent() {
+		t.Errorf("Expected channels with a differing sample to not be mono content.")
+	}
+	if same, err := c.ChannelsIdentical(0, 1); !same || err != nil {
+		t.Errorf("Expected channels 0 and 1 to be identical: %v", err)
+	}
+	if same, _ := c.ChannelsIdentical(1, 2); same {
+		t.Errorf("Expected channels 1 and 2 to differ.")
+	}
+	c.Samples[2] = []int16{1, 2}
+	if same, _ := c.ChannelsIdentical(1, 2); same {
+		t.Errorf("Expected channels of varying length to differ.")
+	}
+	if _, err := c.ChannelsIdentical(0, 3); err == nil {
+		t.Errorf("Expected an error comparing a channel that does not exist.")
+	}
+	if !NewClip(1).IsMonoContent() {
+		t.Errorf("Expected a mono clip to be mono content.")
+	}
+}
+
+func TestChannelLayout(t *testing.T) {
+	if n := Layout7Point1.NumChannels(); n != 8 {
+		t.Errorf("Expected %d channels instead of %d\n", 8, n)
+	}
+	expected := []ChannelLayout{SpeakerFrontLeft, SpeakerFrontRight, SpeakerFrontCenter,
+		SpeakerLowFrequency, SpeakerBackLeft, SpeakerBackRight}
+	speakers := Layout5Point1.Speakers()
+	if len(speakers) != len(expected) {
+		t.Fatalf("Expected speakers %v instead of %v\n", expected, speakers)
+	}
+	for i, speaker := range expected {
+		if speakers[i] != speaker {
+			t.Errorf("Expected speaker %#x instead of %#x for channel %d\n", speaker, speakers[i], i)
+		}
+	}
+	// A custom layout of 3 channels: front left and right, and a back center.
+	c := NewClip(3)
+	c.Layout = LayoutStereo | SpeakerBackCenter
+	c.Samples = [][]int16{{1000}, {2000}, {1415}}
+	stereo, err := c.ChangeChannelCount(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stereo.Layout != LayoutStereo {
+		t.Errorf("Expected channel layout %#x instead of %#x\n", LayoutStereo, stereo.Layout)
+	}
+	if same, err := stereo.IsEqual(&Clip{Samples: [][]int16{{1172}, {1758}}}); !same {
+		t.Error(err)
+	}
+	c.Layout = 0 // Without a layout, only averaging to mono is possible.
+	if _, err := c.ChangeChannelCount(2); err == nil {
+		t.Errorf("Expected an error downmixing 3 channels of an unknown layout to stereo.")
+	}
+}
@@ -2,10 +2,13 @@
 package audio
 
 import (
-	"errors"
+	"encoding/binary"
 	"fmt"
 	"github.com/aoeu/audio/encoding/wave"
+	"math"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,12 +17,40 @@ const (
 	MinInt16 = -MaxInt16 - 1
 )
 
+// Converts a floating point sample in the range [-1, 1] to a 16-bit sample,
+// clipping values beyond the range.
+func floatToSample(f float32) int16 {
+	switch {
+	case f >= 1:
+		return MaxInt16
+	case f <= -1:
+		return MinInt16
+	}
+	return int16(f * -float32(MinInt16))
+}
+
 // Represents a (possibly) multi-channel audio clip.
 type Clip struct {
 	// Hardcoding for 16-bit.
 	Samples    [][]int16 // Channels of Samples, non interlaced.
 	Name       string
 	SampleRate int
+	// Speaker positions of the channels, or 0 if unspecified.
+	Layout ChannelLayout
+	// Broadcast Wave meta-data carried over from (and back to) wave files.
+	BroadcastChunk *wave.BroadcastChunk
+	// The format of the wave file the clip was created from, or nil.
+	SourceFormat *SourceFormat
+}
+
+// The format of the samples of a wave file a clip was created from, which the clip
+// is written back to wave files with (rather than 16-bit PCM), so that a round trip
+// doesn't lower the bit depth of the file.
+type SourceFormat struct {
+	Format        int // The format code, such as wave.FormatPCM, or sub-format of extensible files.
+	BitsPerSample int16
+	BytesPerBlock int16 // The bytes of a sample of every channel, a.k.a. "block align."
+	ByteRate      int32 // The bytes per second of the source file.
 }
 
 // Creates a new empty clip with initialized data structures to append to.
@@ -32,6 +63,26 @@ func NewClip(numChannels int) *Clip {
 	return c
 }
 
+// Creates a new clip of silence (zero valued samples) lasting the specified duration,
+// such as for padding timelines.
+func Silence(d time.Duration, sampleRate, numChannels int) (*Clip, error) {
+	switch {
+	case d <= 0:
+		return nil, fmt.Errorf("Duration of silence %v is not positive.", d)
+	case sampleRate <= 0:
+		return nil, fmt.Errorf("Invalid sample rate: %d", sampleRate)
+	case numChannels <= 0:
+		return nil, fmt.Errorf("Invalid number of channels: %d", numChannels)
+	}
+	c := NewClip(numChannels)
+	c.SampleRate = sampleRate
+	n := c.numSamples(d)
+	for chanNum := range c.Samples {
+		c.Samples[chanNum] = make([]int16, n)
+	}
+	return c, nil
+}
+
 // Creates a new clip from a wave file name.
 func NewClipFromWave(waveFileName string) (*Clip, error) {
 	c := new(Clip)
@@ -43,6 +94,14 @@ func NewClipFromWave(waveFileName string) (*Clip, error) {
 	numChannels := int(w.Header.NumChannels)
 	c = NewClip(int(w.Header.NumChannels))
 	c.SampleRate = int(w.Header.SampleRate)
+	c.Layout = ChannelLayout(w.ChannelMask())
+	c.BroadcastChunk = w.BroadcastChunk
+	c.SourceFormat = &SourceFormat{
+		Format:        w.Format(),
+		BitsPerSample: w.Header.BitsPerSample,
+		BytesPerBlock: w.Header.BytesPerBlock,
+		ByteRate:      w.Header.ByteRate,
+	}
 	// Deinterlace the wave sample data into disparate slices.
 	for i, sample := range w.Samples {
 		c.Samples[i%numChannels] = append(c.Samples[i%numChannels], sample)
@@ -50,7 +109,12 @@ func NewClipFromWave(waveFileName string) (*Clip, error) {
 	return c, nil
 }
 
-// Creates a new wave file from a clip.
+// Creates a new wave file from a clip, with samples of the format and bit depth of the clip's
+// source format, or of 16-bit PCM for clips without one (or with a format that can't be written).
+// Clips of more than 2 channels, or with an unusual layout, are written in the extensible format.
+// Channels of varying length are padded with silence (zero valued samples)
+// to the length of the longest channel, so no audio data is lost.
+// Clips without channels or a sample rate make files that error when written.
 func NewWaveFromClip(c *Clip) (w *wave.File) {
 	fileName := c.Name
 	if !strings.Contains(fileName, ".wav") {
@@ -59,57 +123,329 @@ func NewWaveFromClip(c *Clip) (w *wave.File) {
 	w = wave.NewFile(fileName)
 	w.Header.NumChannels = int16(len(c.Samples))
 	w.Header.SampleRate = int32(c.SampleRate)
-	// Interlace the slices of samples into a single slice.
-	for offset := 0; offset < len(c.Samples[0]); offset++ {
-		for chanNum := 0; chanNum < len(c.Samples); chanNum++ {
-			w.Samples = append(w.Samples, c.Samples[chanNum][offset])
+	w.BroadcastChunk = c.BroadcastChunk
+	if len(c.Samples) > 2 || (c.Layout != 0 && c.Layout != defaultLayout(len(c.Samples))) {
+		w.MakeExtensible(int32(c.Layout))
+	}
+	numChannels := len(c.Samples)
+	switch numChannels {
+	case 0:
+	case 1: // Mono data is already "interlaced."
+		w.Samples = append(w.Samples, c.Samples[0]...)
+	default:
+		// Interlace the slices of samples into a single slice,
+		// allocated at once as shorter channels are padded with zeros.
+		w.Samples = make([]int16, c.maxLenPerChannel()*numChannels)
+		for chanNum, samples := range c.Samples {
+			for offset, sample := range samples {
+				w.Samples[offset*numChannels+chanNum] = sample
+			}
 		}
 	}
 	w.UpdateHeader()
+	if f := c.SourceFormat; f != nil && (f.Format != wave.FormatPCM || f.BitsPerSample != 16) {
+		// Keeps 16-bit PCM if the source format can't be written.
+		w.SetFormat(f.Format, f.BitsPerSample)
+	}
 	return w
 }
 
+// Creates a new wave file from a clip, as per NewWaveFromClip, with samples of a format
+// and bit depth, such as wave.FormatIEEEFloat with 32 bits per sample for intermediate renders,
+// whose floating point samples (scaled to the range [-1, 1]) have headroom for later processing.
+func NewWaveFromClipFormat(c *Clip, format int, bitsPerSample int16) (*wave.File, error) {
+	w := NewWaveFromClip(c)
+	if err := w.SetFormat(format, bitsPerSample); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Returns the number of bytes of sample data of a wave file created from the clip.
+func (c *Clip) waveDataSize() int64 {
+	bytesPerSample := int64(2)
+	if c.SourceFormat != nil && c.SourceFormat.BitsPerSample > 16 {
+		bytesPerSample = int64(c.SourceFormat.BitsPerSample / 8)
+	}
+	return int64(c.maxLenPerChannel()) * int64(len(c.Samples)) * bytesPerSample
+}
+
+// Creates a new wave file from a clip, as per NewWaveFromClip, unless the wave file's
+// sample data would exceed a maximum number of bytes, which errors before any allocation.
+func NewWaveFromClipLimit(c *Clip, maxBytes int64) (*wave.File, error) {
+	if size := c.waveDataSize(); size > maxBytes {
+		return nil, fmt.Errorf("Wave file of %d bytes of samples exceeds the limit of %d bytes.",
+			size, maxBytes)
+	}
+	w := NewWaveFromClip(c)
+	if err := w.UpdateHeader(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Creates a new clip from raw (headerless) interlaced, little-endian, 16-bit PCM data.
+func NewClipFromPCM(data []byte, sampleRate, numChannels int) (*Clip, error) {
+	if numChannels <= 0 {
+		return nil, fmt.Errorf("Invalid number of channels: %d", numChannels)
+	}
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("Invalid sample rate: %d", sampleRate)
+	}
+	if frameLen := 2 * numChannels; len(data)%frameLen != 0 {
+		return nil, fmt.Errorf("PCM data length %d is not a multiple of %d bytes "+
+			"(2 bytes per sample for %d channels)", len(data), frameLen, numChannels)
+	}
+	c := NewClip(numChannels)
+	c.SampleRate = sampleRate
+	lenPerChannel := len(data) / 2 / numChannels
+	for chanNum := range c.Samples {
+		c.Samples[chanNum] = make([]int16, lenPerChannel)
+	}
+	// Deinterlace the PCM data into disparate slices.
+	for i := 0; i < len(data)/2; i++ {
+		c.Samples[i%numChannels][i/numChannels] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return c, nil
+}
+
+// Returns the clip's audio data as raw (headerless) interlaced, little-endian, 16-bit PCM data.
+// Channels of varying length are padded with silence to the length of the longest.
+func (c *Clip) PCMBytes() []byte {
+	maxLen := c.maxLenPerChannel()
+	data := make([]byte, maxLen*len(c.Samples)*2)
+	for chanNum, samples := range c.Samples {
+		for i, sample := range samples {
+			binary.LittleEndian.PutUint16(data[(i*len(c.Samples)+chanNum)*2:], uint16(sample))
+		}
+	}
+	return data
+}
+
 // Compares individual samples across all channels of two clips and returns
 // true if all the samples have the same value, false and an error message
 // explaining why if otherwise.
 func (s *Clip) IsEqual(t *Clip) (bool, error) {
+	switch {
+	case s == nil && t == nil:
+		return true, nil
+	case s == nil || t == nil:
+		return false, fmt.Errorf("Only one of the clips is nil.\n")
+	}
 	if len(s.Samples) != len(t.Samples) {
-		return false, fmt.Errorf("Clips have varying number of channnels: "+
-			"%d, $%d\n",
+		return false, fmt.Errorf("Clips have varying number of channels: "+
+			"%d, %d\n",
 			len(s.Samples), len(t.Samples))
 	}
 	for chanNum := 0; chanNum < len(s.Samples); chanNum++ {
-		if len(s.Samples[chanNum]) != len(t.Samples[chanNum]) {
-			return false, fmt.Errorf("Clips have varying number of samples "+
-				"(%d and %d) for channel %d\n",
-				len(s.Samples[chanNum]), len(t.Samples[chanNum]), chanNum)
-		}
-		for i, sample := range s.Samples[chanNum] {
-			sample2 := t.Samples[chanNum][i]
-			if sample != sample2 {
-				return false, fmt.Errorf("Clips have varying sample values "+
-					"(%d and %d) at offset %d on channel %d\n",
-					sample, sample2, i, chanNum)
-			}
+		if err := compareSamples(s.Samples[chanNum], t.Samples[chanNum], chanNum); err != nil {
+			return false, err
 		}
 	}
 	return true, nil
 }
 
+// Returns true if two clips have the same samples at the same sample rate,
+// regardless of their names and other meta-data.
+func (s *Clip) Equal(t *Clip) bool {
+	if s != nil && t != nil && s.SampleRate != t.SampleRate {
+		return false
+	}
+	same, _ := s.IsEqual(t)
+	return same
+}
+
+// Compares the samples of a channel in two clips, returning an error
+// explaining why if they differ.
+func compareSamples(s, t []int16, chanNum int) error {
+	if len(s) != len(t) {
+		return fmt.Errorf("Clips have varying number of samples "+
+			"(%d and %d) for channel %d\n",
+			len(s), len(t), chanNum)
+	}
+	for i, sample := range s {
+		sample2 := t[i]
+		if sample != sample2 {
+			return fmt.Errorf("Clips have varying sample values "+
+				"(%d and %d) at offset %d on channel %d\n",
+				sample, sample2, i, chanNum)
+		}
+	}
+	return nil
+}
+
 // Returns the total number of samples within any clip channel.
 func (c *Clip) LenPerChannel() int {
 	return len(c.Samples[0])
 }
 
-// Returns the real-time playback length of the audio, in milliseconds.
+// Returns the number of samples of the longest channel.
+func (c *Clip) maxLenPerChannel() int {
+	maxLen := 0
+	for _, samples := range c.Samples {
+		if len(samples) > maxLen {
+			maxLen = len(samples)
+		}
+	}
+	return maxLen
+}
+
+// Returns the real-time playback length of the audio.
 func (c *Clip) Duration() time.Duration {
-	return time.Duration(int64(float32(c.LenPerChannel()) / float32(c.SampleRate) * 1000000000))
+	if c.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(c.LenPerChannel()) * time.Second / time.Duration(c.SampleRate)
+}
+
+// Returns the number of samples (per channel) played back within a duration.
+func (c *Clip) numSamples(d time.Duration) int {
+	return int(int64(d) * int64(c.SampleRate) / int64(time.Second))
+}
+
+// Returns the index of the sample of a channel played back at a time.
+func (c *Clip) sampleIndex(chanNum int, t time.Duration) (int, error) {
+	if chanNum < 0 || chanNum >= len(c.Samples) {
+		return 0, fmt.Errorf("Channel %d does not exist in a clip of %d channels.",
+			chanNum, len(c.Samples))
+	}
+	if c.SampleRate <= 0 {
+		return 0, fmt.Errorf("Clip has an invalid sample rate of %d.", c.SampleRate)
+	}
+	i := c.numSamples(t)
+	if t < 0 || i >= len(c.Samples[chanNum]) {
+		return 0, fmt.Errorf("Time %v is beyond the %v duration of channel %d.",
+			t, time.Duration(len(c.Samples[chanNum]))*time.Second/time.Duration(c.SampleRate), chanNum)
+	}
+	return i, nil
+}
+
+// Returns the sample of a channel played back at a time.
+func (c *Clip) SampleAt(chanNum int, t time.Duration) (int16, error) {
+	i, err := c.sampleIndex(chanNum, t)
+	if err != nil {
+		return 0, err
+	}
+	return c.Samples[chanNum][i], nil
+}
+
+// Sets the sample of a channel played back at a time.
+func (c *Clip) SetSampleAt(chanNum int, t time.Duration, sample int16) error {
+	i, err := c.sampleIndex(chanNum, t)
+	if err != nil {
+		return err
+	}
+	c.Samples[chanNum][i] = sample
+	return nil
+}
+
+// Inserts silence of the specified duration at a position in every channel,
+// increasing the length. Channels shorter than the position are first extended with silence.
+func (c *Clip) InsertSilence(at, dur time.Duration) error {
+	if at < 0 || dur < 0 {
+		return fmt.Errorf("Cannot insert %v of silence at %v, durations must not be negative.", dur, at)
+	}
+	start, n := c.numSamples(at), c.numSamples(dur)
+	for chanNum, samples := range c.Samples {
+		if start > len(samples) {
+			samples = append(samples, make([]int16, start-len(samples))...)
+		}
+		grown := make([]int16, len(samples)+n)
+		copy(grown, samples[:start])
+		copy(grown[start+n:], samples[start:])
+		c.Samples[chanNum] = grown
+	}
+	return nil
+}
+
+// Pads every channel with silence of the specified durations before and after its audio,
+// such as to align clips before mixing them.
+func (c *Clip) Pad(before, after time.Duration) error {
+	if before < 0 || after < 0 {
+		return fmt.Errorf("Cannot pad with %v of silence before and %v after, "+
+			"durations must not be negative.", before, after)
+	}
+	head, tail := c.numSamples(before), c.numSamples(after)
+	for chanNum, samples := range c.Samples {
+		padded := make([]int16, head+len(samples)+tail)
+		copy(padded[head:], samples)
+		c.Samples[chanNum] = padded
+	}
+	return nil
+}
+
+// Returns the number of samples per channel nearest to lasting a duration,
+// at the clip's sample rate, for durations that must be exact.
+func (c *Clip) lenForDuration(d time.Duration) (int, error) {
+	if d < 0 {
+		return 0, fmt.Errorf("Duration of %v must not be negative.", d)
+	}
+	if c.SampleRate <= 0 {
+		return 0, fmt.Errorf("Clip has an invalid sample rate of %d.", c.SampleRate)
+	}
+	return int((int64(d)*int64(c.SampleRate) + int64(time.Second)/2) / int64(time.Second)), nil
+}
+
+// Pads every channel with silence at its end to last exactly the specified duration
+// (to the nearest sample), such as to make a loop last exactly a bar.
+// Channels already lasting at least the duration are unchanged (see TruncateTo).
+func (c *Clip) ZeroPadTo(d time.Duration) error {
+	n, err := c.lenForDuration(d)
+	if err != nil {
+		return err
+	}
+	for chanNum, samples := range c.Samples {
+		if len(samples) < n {
+			c.Samples[chanNum] = append(samples, make([]int16, n-len(samples))...)
+		}
+	}
+	return nil
+}
+
+// Shortens every channel to last exactly the specified duration (to the nearest sample),
+// discarding the audio after it. Channels lasting no longer than the duration are unchanged
+// (see ZeroPadTo).
+func (c *Clip) TruncateTo(d time.Duration) error {
+	n, err := c.lenForDuration(d)
+	if err != nil {
+		return err
+	}
+	for chanNum, samples := range c.Samples {
+		if len(samples) > n {
+			c.Samples[chanNum] = samples[:n]
+		}
+	}
+	return nil
+}
+
+// Removes the audio between two positions from every channel, closing the gap,
+// and returns the removed audio as a new clip (such as for pasting elsewhere).
+// Positions beyond the end of the clip are clamped to its end.
+func (c *Clip) Cut(start, end time.Duration) (*Clip, error) {
+	if start < 0 || start >= end {
+		return nil, fmt.Errorf("Cannot cut from %v to %v, the start must not be negative "+
+			"and must precede the end.", start, end)
+	}
+	cut := NewClip(len(c.Samples))
+	cut.SampleRate = c.SampleRate
+	for chanNum, samples := range c.Samples {
+		startIndex, endIndex := c.numSamples(start), c.numSamples(end)
+		if endIndex > len(samples) {
+			endIndex = len(samples)
+		}
+		if startIndex > endIndex {
+			startIndex = endIndex
+		}
+		cut.Samples[chanNum] = append(cut.Samples[chanNum], samples[startIndex:endIndex]...)
+		c.Samples[chanNum] = append(samples[:startIndex], samples[endIndex:]...)
+	}
+	return cut, nil
 }
 
 // Append's another Clip's audio data to this Clip, increasing the length.
 func (target *Clip) Append(source *Clip) error {
-	if len(target.Samples) != len(source.Samples) {
-		return errors.New("Clips have varying number of channels.")
+	if err := target.checkCompatible(source); err != nil {
+		return err
 	}
 	for chanNum := 0; chanNum < len(target.Samples); chanNum++ {
 		target.Samples[chanNum] = append(target.Samples[chanNum], source.Samples[chanNum]...)
@@ -117,8 +453,82 @@ func (target *Clip) Append(source *Clip) error {
 	return nil
 }
 
-// Mixes two disparate channels of audio data together.
-func mix(s []int16, t []int16) {
+// Appends the audio data of another clip, crossfading over a duration at the join by
+// overlapping the end of the clip with the start of the other, to avoid a click.
+// The crossfade has equal power, so the join keeps a steady loudness between unrelated audio,
+// and the overlap is shortened for channels shorter than the duration.
+func (target *Clip) AppendFade(source *Clip, d time.Duration) error {
+	if err := target.checkCompatible(source); err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("Crossfade of %v must not be negative.", d)
+	}
+	if d > 0 && target.SampleRate <= 0 {
+		return fmt.Errorf("Clip has an invalid sample rate of %d.", target.SampleRate)
+	}
+	overlap := target.numSamples(d)
+	for chanNum := range target.Samples {
+		t, s := target.Samples[chanNum], source.Samples[chanNum]
+		n := overlap
+		if n > len(t) {
+			n = len(t)
+		}
+		if n > len(s) {
+			n = len(s)
+		}
+		tail := t[len(t)-n:]
+		for i := range tail {
+			theta := math.Pi / 2 * (float64(i) + 0.5) / float64(n)
+			tail[i], _ = saturate(float64(tail[i])*math.Cos(theta) + float64(s[i])*math.Sin(theta))
+		}
+		target.Samples[chanNum] = append(t, s[n:]...)
+	}
+	return nil
+}
+
+// Returns an error if the audio data of two clips can't be combined, because
+// they vary in number of channels or in sample rate. Clips without a sample rate
+// (a SampleRate of 0) are assumed to have the sample rate of any other clip.
+func (s *Clip) checkCompatible(t *Clip) error {
+	if len(s.Samples) != len(t.Samples) {
+		return fmt.Errorf("Clips have varying number of channels: %d and %d.",
+			len(s.Samples), len(t.Samples))
+	}
+	if s.SampleRate != t.SampleRate && s.SampleRate != 0 && t.SampleRate != 0 {
+		return fmt.Errorf("Clips have varying sample rates: %d Hz and %d Hz.",
+			s.SampleRate, t.SampleRate)
+	}
+	return nil
+}
+
+// Strategies for summed samples that exceed the range of 16-bit audio.
+type MixMode int
+
+const (
+	Saturate     MixMode = iota // Clamps sums to MinInt16 or MaxInt16, the default.
+	Wrap                        // Lets sums overflow, wrapping around the int16 range.
+	AverageScale                // Divides sums by the number of sources mixed, never clipping.
+)
+
+// Mixes two disparate channels of audio data together,
+// returning the (possibly lengthened) mixed channel.
+func mix(s []int16, t []int16, mode MixMode) []int16 {
+	if mode == Saturate && len(t) <= len(s) {
+		// The common case, mixed in place without allocation.
+		s2 := s[:len(t)]
+		for i, sample := range t {
+			mixed := int32(s2[i]) + int32(sample)
+			switch {
+			case mixed > int32(MaxInt16):
+				mixed = int32(MaxInt16)
+			case mixed < int32(MinInt16):
+				mixed = int32(MinInt16)
+			}
+			s2[i] = int16(mixed)
+		}
+		return s
+	}
 	if len(t) > len(s) {
 		diffLen := len(t) - len(s)
 		s = append(s, make([]int16, diffLen)...)
@@ -126,23 +536,113 @@ func mix(s []int16, t []int16) {
 	for i, sample := range t {
 		sample2 := s[i]
 		mixed := sample + sample2
-		switch {
-		case sample2 > 0 && mixed < sample:
-			mixed = MaxInt16
-		case sample2 < 0 && mixed > sample:
-			mixed = MinInt16
+		switch mode {
+		case Saturate:
+			switch {
+			case sample2 > 0 && mixed < sample:
+				mixed = MaxInt16
+			case sample2 < 0 && mixed > sample:
+				mixed = MinInt16
+			}
+		case AverageScale:
+			mixed = int16((int32(sample) + int32(sample2)) / 2)
 		}
 		s[i] = mixed
 	}
+	return s
 }
 
 // Mixes the audio data of a clip into this clip, increasing length as necessary.
+// Samples are saturated (clipped) if their sum exceeds the range of 16-bit audio.
 func (s *Clip) Mix(t *Clip) error {
-	if len(s.Samples) != len(t.Samples) {
-		return errors.New("Clips have varying number of channels.")
+	return s.MixMode(t, Saturate)
+}
+
+// Returns a new clip of the audio data of two clips mixed, as per Mix, leaving both clips
+// untouched. Each channel is as long as the longer of the two clips' channels.
+func Mixed(a, b *Clip) (*Clip, error) {
+	if err := a.checkCompatible(b); err != nil {
+		return nil, err
+	}
+	mixed := NewClip(len(a.Samples))
+	mixed.SampleRate = a.SampleRate
+	if mixed.SampleRate == 0 {
+		mixed.SampleRate = b.SampleRate
+	}
+	mixed.Layout = a.Layout
+	for chanNum, samples := range a.Samples {
+		length := len(samples)
+		if l := len(b.Samples[chanNum]); l > length {
+			length = l
+		}
+		// Allocated at once, with room for mixing in the longer channel.
+		s := append(make([]int16, 0, length), samples...)
+		mixed.Samples[chanNum] = mix(s, b.Samples[chanNum], Saturate)
+	}
+	return mixed, nil
+}
+
+// Mixes the audio data of a clip into this clip, increasing length as necessary,
+// with the specified handling of sums beyond the range of 16-bit audio.
+// With AverageScale, any part of this clip extended to fit the mixed clip
+// is treated as silence and so is scaled as well.
+func (s *Clip) MixMode(t *Clip, mode MixMode) error {
+	if err := s.checkCompatible(t); err != nil {
+		return err
+	}
+	switch mode {
+	case Saturate, Wrap, AverageScale:
+	default:
+		return fmt.Errorf("Unknown mix mode: %d", mode)
 	}
 	for chanNum := 0; chanNum < len(s.Samples); chanNum++ {
-		mix(s.Samples[chanNum], t.Samples[chanNum])
+		s.Samples[chanNum] = mix(s.Samples[chanNum], t.Samples[chanNum], mode)
+	}
+	return nil
+}
+
+// Multiplies the audio data of this clip by that of another clip, sample by sample,
+// such as to apply an envelope or for amplitude modulation. The other clip is a modulator
+// in the range [-1, 1], so that samples of MaxInt16 pass this clip's samples through unchanged,
+// and silence silences them. Each channel is shortened to the shorter of the two clips.
+func (s *Clip) Mul(t *Clip) error {
+	if err := s.checkCompatible(t); err != nil {
+		return err
+	}
+	for chanNum := 0; chanNum < len(s.Samples); chanNum++ {
+		modulator := t.Samples[chanNum]
+		samples := s.Samples[chanNum]
+		if len(modulator) < len(samples) {
+			samples = samples[:len(modulator)]
+		}
+		for i, sample := range samples {
+			samples[i], _ = saturate(float64(sample) * float64(modulator[i]) / float64(MaxInt16))
+		}
+		s.Samples[chanNum] = samples
+	}
+	return nil
+}
+
+// Copies the audio data of this clip into another clip starting at a sample offset,
+// overwriting (rather than mixing with) the other clip's samples, without allocating,
+// such as to render clips into a preallocated buffer. The clips must have the same number
+// of channels, and each channel of this clip must fit within the other clip's channel.
+func (s *Clip) CopyInto(t *Clip, atSample int) error {
+	if len(s.Samples) != len(t.Samples) {
+		return fmt.Errorf("Cannot copy %d channels into a clip of %d channels.",
+			len(s.Samples), len(t.Samples))
+	}
+	if atSample < 0 {
+		return fmt.Errorf("Cannot copy to negative offset %d.", atSample)
+	}
+	for chanNum, samples := range s.Samples {
+		if end := atSample + len(samples); end > len(t.Samples[chanNum]) {
+			return fmt.Errorf("Channel %d ends at offset %d, beyond the %d samples of the other clip.",
+				chanNum, end, len(t.Samples[chanNum]))
+		}
+	}
+	for chanNum, samples := range s.Samples {
+		copy(t.Samples[chanNum][atSample:], samples)
 	}
 	return nil
 }
@@ -150,6 +650,7 @@ func (s *Clip) Mix(t *Clip) error {
 // Returns a new audio clip consisting of a subsection (slice) of sample data.
 func (s *Clip) Slice(startIndex, endIndex int) (*Clip, error) {
 	t := NewClip(len(s.Samples))
+	t.SampleRate = s.SampleRate
 	if endIndex > len(s.Samples[0]) {
 		endIndex = len(s.Samples[0])
 	}
@@ -159,6 +660,107 @@ func (s *Clip) Slice(startIndex, endIndex int) (*Clip, error) {
 	return t, nil
 }
 
+// Returns a new clip of a copy of the first n samples of each channel,
+// or of every sample of channels shorter than n.
+func (c *Clip) Head(n int) *Clip {
+	return c.copyEnd(n, false)
+}
+
+// Returns a new clip of a copy of the last n samples of each channel,
+// or of every sample of channels shorter than n.
+func (c *Clip) Tail(n int) *Clip {
+	return c.copyEnd(n, true)
+}
+
+// Returns a new clip of copies of up to n samples from the start or end of each channel.
+func (c *Clip) copyEnd(n int, fromEnd bool) *Clip {
+	if n < 0 {
+		n = 0
+	}
+	t := NewClip(len(c.Samples))
+	t.SampleRate = c.SampleRate
+	t.Layout = c.Layout
+	for chanNum, samples := range c.Samples {
+		if n < len(samples) {
+			if fromEnd {
+				samples = samples[len(samples)-n:]
+			} else {
+				samples = samples[:n]
+			}
+		}
+		t.Samples[chanNum] = append(t.Samples[chanNum], samples...)
+	}
+	return t
+}
+
+// Returns a new audio clip consisting of the sample data between two playback positions.
+func (s *Clip) SliceTime(start, end time.Duration) (*Clip, error) {
+	if start < 0 || start > end {
+		return nil, fmt.Errorf("Cannot slice from %v to %v, the start must not be negative "+
+			"and must not follow the end.", start, end)
+	}
+	startIndex, endIndex := s.numSamples(start), s.numSamples(end)
+	if l := s.LenPerChannel(); startIndex > l {
+		startIndex = l
+	}
+	return s.Slice(startIndex, endIndex)
+}
+
+// How far from a position to search for a zero crossing to slice at.
+const zeroCrossingWindow = 10 * time.Millisecond
+
+// Returns whether the samples of a channel cross zero at an index, as they do
+// where the sample is zero or its sign differs from that of the previous sample.
+func crossesZero(samples []int16, i int) bool {
+	if i <= 0 || i >= len(samples) {
+		return i == 0 || i == len(samples) // The start and end of a channel are silent.
+	}
+	return samples[i] == 0 || (samples[i-1] < 0) != (samples[i] < 0)
+}
+
+// Returns the index of the nearest zero crossing within the window of an index,
+// or the index itself if there is none.
+func nearestZeroCrossing(samples []int16, i, window int) int {
+	for d := 0; d <= window; d++ {
+		if crossesZero(samples, i-d) {
+			return i - d
+		}
+		if crossesZero(samples, i+d) {
+			return i + d
+		}
+	}
+	return i
+}
+
+// Copies the samples between two positions, as per SliceTime, but with the positions
+// moved to the nearest zero crossings of the first channel (within 10 milliseconds)
+// so that the slice starts and ends without clicks, such as for seamless loops.
+// Positions without a zero crossing nearby are not moved.
+func (s *Clip) SliceZeroCrossing(start, end time.Duration) (*Clip, error) {
+	if start < 0 || start > end {
+		return nil, fmt.Errorf("Cannot slice from %v to %v, the start must not be negative "+
+			"and must not follow the end.", start, end)
+	}
+	if len(s.Samples) == 0 {
+		return nil, fmt.Errorf("Cannot slice a clip without channels.")
+	}
+	l := s.LenPerChannel()
+	startIndex, endIndex := s.numSamples(start), s.numSamples(end)
+	if startIndex > l {
+		startIndex = l
+	}
+	if endIndex > l {
+		endIndex = l
+	}
+	window := s.numSamples(zeroCrossingWindow)
+	startIndex = nearestZeroCrossing(s.Samples[0], startIndex, window)
+	endIndex = nearestZeroCrossing(s.Samples[0], endIndex, window)
+	if endIndex < startIndex {
+		endIndex = startIndex
+	}
+	return s.Slice(startIndex, endIndex)
+}
+
 // Splits a clip into an equal-length number of specified new clips.
 func (c *Clip) Split(numDivisions int) ([]*Clip, error) {
 	stepLen := len(c.Samples[0]) / numDivisions
@@ -187,13 +789,92 @@ func (c *Clip) Stretch() {
 	}
 }
 
-// Reverses the audio-data of an audio-clip.
-func (c *Clip) Reverse() {
+// Runs a function for every channel of a clip. Channels share no sample data,
+// so the function runs on channels concurrently, with no more goroutines at
+// once than can run in parallel (as per GOMAXPROCS).
+func (c *Clip) forEachChannel(fn func(chanNum int)) {
+	numWorkers := runtime.GOMAXPROCS(0)
+	if numWorkers > len(c.Samples) {
+		numWorkers = len(c.Samples)
+	}
+	if numWorkers < 2 {
+		for chanNum := 0; chanNum < len(c.Samples); chanNum++ {
+			fn(chanNum)
+		}
+		return
+	}
+	chanNums := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for chanNum := range chanNums {
+				fn(chanNum)
+			}
+		}()
+	}
 	for chanNum := 0; chanNum < len(c.Samples); chanNum++ {
-		for i, j := 0, len(c.Samples[chanNum])-1; i < j; i, j = i+1, j-1 {
-			tmp := c.Samples[chanNum][i]
-			c.Samples[chanNum][i] = c.Samples[chanNum][j]
-			c.Samples[chanNum][j] = tmp
+		chanNums <- chanNum
+	}
+	close(chanNums)
+	wg.Wait()
+}
+
+// Reverses a channel of audio data in place.
+func reverse(samples []int16) {
+	for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+		samples[i], samples[j] = samples[j], samples[i]
+	}
+}
+
+// Reverses the audio-data of an audio-clip in place, without copying the audio-data.
+func (c *Clip) Reverse() {
+	c.forEachChannel(func(chanNum int) {
+		reverse(c.Samples[chanNum])
+	})
+}
+
+// Reverses the audio-data of the listed channels of an audio-clip in place, leaving
+// the other channels untouched, such as to reverse the reverb of one side of a stereo clip.
+// Nothing is reversed if any channel doesn't exist or is listed more than once.
+func (c *Clip) ReverseChannels(chanNums ...int) error {
+	listed := make(map[int]bool, len(chanNums))
+	for _, chanNum := range chanNums {
+		if chanNum < 0 || chanNum >= len(c.Samples) {
+			return fmt.Errorf("Channel %d does not exist in a clip of %d channels.", chanNum, len(c.Samples))
+		}
+		if listed[chanNum] {
+			return fmt.Errorf("Channel %d is listed more than once.", chanNum)
 		}
+		listed[chanNum] = true
 	}
+	for _, chanNum := range chanNums {
+		reverse(c.Samples[chanNum])
+	}
+	return nil
+}
+
+// Reverses the audio-data of a region of an audio-clip in place, such as for
+// reverse cymbal effects. A region extending beyond the end of a channel
+// is clamped to the end of the channel.
+func (c *Clip) ReverseTime(start, end time.Duration) error {
+	if start < 0 || end < start {
+		return fmt.Errorf("Invalid region from %v to %v.", start, end)
+	}
+	if c.SampleRate <= 0 {
+		return fmt.Errorf("Clip has an invalid sample rate of %d.", c.SampleRate)
+	}
+	startIndex, endIndex := c.numSamples(start), c.numSamples(end)
+	c.forEachChannel(func(chanNum int) {
+		samples := c.Samples[chanNum]
+		from, to := startIndex, endIndex
+		if to > len(samples) {
+			to = len(samples)
+		}
+		if from < to {
+			reverse(samples[from:to])
+		}
+	})
+	return nil
 }
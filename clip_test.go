@@ -1,6 +1,8 @@
 package audio
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -43,6 +45,226 @@ func TestNewWaveFromClip(t *testing.T) {
 	}
 }
 
+func TestNewWaveFromClipUnequalChannels(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 44100
+	c.Samples[0] = []int16{1, 2, 3, 4}
+	c.Samples[1] = []int16{5, 6}
+	w := NewWaveFromClip(c)
+	expected := []int16{1, 5, 2, 6, 3, 0, 4, 0}
+	if len(w.Samples) != len(expected) {
+		t.Fatalf("Expected length %d and have length %d\n",
+			len(expected), len(w.Samples))
+	}
+	for i, sample := range expected {
+		if sample != w.Samples[i] {
+			t.Errorf("Expected %d instead of %d for sample offset %d\n",
+				sample, w.Samples[i], i)
+		}
+	}
+}
+
+func TestNewWaveFromClipLimit(t *testing.T) {
+	c := newTestClip(2, 100)
+	if _, err := NewWaveFromClipLimit(c, 399); err == nil {
+		t.Errorf("Expected an error for 400 bytes of samples exceeding a limit of 399 bytes.")
+	}
+	w, err := NewWaveFromClipLimit(c, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Samples) != 200 {
+		t.Errorf("Expected length %d and have length %d\n", 200, len(w.Samples))
+	}
+}
+
+func TestNewWaveFromMonoClip(t *testing.T) {
+	c := NewClip(1)
+	c.SampleRate = 44100
+	c.Samples[0] = []int16{1, 2, 3}
+	w := NewWaveFromClip(c)
+	if len(w.Samples) != 3 {
+		t.Errorf("Expected length %d and have length %d\n", 3, len(w.Samples))
+	}
+	if w.Header.NumChannels != 1 {
+		t.Errorf("Expected %d channels instead of %d\n", 1, w.Header.NumChannels)
+	}
+}
+
+func TestSurroundWaveRoundTrip(t *testing.T) {
+	c := NewClip(6)
+	c.Name = filepath.Join(os.TempDir(), "surround_clip")
+	c.SampleRate = 48000
+	c.Layout = Layout5Point1
+	for chanNum := range c.Samples {
+		for i := 0; i < 4; i++ {
+			c.Samples[chanNum] = append(c.Samples[chanNum], int16(1000*chanNum+i))
+		}
+	}
+	w := NewWaveFromClip(c)
+	if w.Header.NumChannels != 6 || w.Header.BytesPerBlock != 12 {
+		t.Errorf("Expected 6 channels in blocks of 12 bytes instead of %d channels in blocks of %d bytes\n",
+			w.Header.NumChannels, w.Header.BytesPerBlock)
+	}
+	for i, sample := range w.Samples[:6] {
+		if expected := int16(1000 * i); sample != expected {
+			t.Errorf("Expected %d instead of %d for sample offset %d\n", expected, sample, i)
+		}
+	}
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+	c2, err := NewClipFromWave(c.Name + ".wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2.Layout != c.Layout {
+		t.Errorf("Expected channel layout %#x instead of %#x\n", c.Layout, c2.Layout)
+	}
+	if same, err := c2.IsEqual(c); !same {
+		t.Error(err)
+	}
+}
+
+func TestFloatWaveRoundTrip(t *testing.T) {
+	for _, numChannels := range []int{2, 6} {
+		c := NewClip(numChannels)
+		c.Name = filepath.Join(os.TempDir(), "float_clip")
+		c.SampleRate = 48000
+		for chanNum := range c.Samples {
+			c.Samples[chanNum] = []int16{MinInt16, -12345, -1, 0, 1, 12345, MaxInt16}
+		}
+		w, err := NewWaveFromClipFormat(c, wave.FormatIEEEFloat, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.Format() != wave.FormatIEEEFloat || w.Header.BitsPerSample != 32 ||
+			int(w.Header.BytesPerBlock) != 4*numChannels {
+			t.Errorf("Expected %d channels of 32-bit float samples instead of format %d of %d bits "+
+				"in blocks of %d bytes\n", numChannels, w.Format(), w.Header.BitsPerSample, w.Header.BytesPerBlock)
+		}
+		if err := w.Write(); err != nil {
+			t.Fatal(err)
+		}
+		c2, err := NewClipFromWave(c.Name + ".wav")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same, err := c2.IsEqual(c); !same {
+			t.Error(err)
+		}
+	}
+	if _, err := NewWaveFromClipFormat(NewClip(1), wave.FormatIEEEFloat, 16); err == nil {
+		t.Errorf("Expected an error for 16-bit floating point samples.")
+	}
+}
+
+func TestSourceFormatRoundTrip(t *testing.T) {
+	c := NewClip(2)
+	c.Name = filepath.Join(os.TempDir(), "24_bit_clip")
+	c.SampleRate = 44100
+	for chanNum := range c.Samples {
+		c.Samples[chanNum] = []int16{MinInt16, -1, 0, 1, MaxInt16}
+	}
+	w, err := NewWaveFromClipFormat(c, wave.FormatPCM, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+	c2, err := NewClipFromWave(c.Name + ".wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := SourceFormat{Format: wave.FormatPCM, BitsPerSample: 24, BytesPerBlock: 6, ByteRate: 44100 * 6}
+	if c2.SourceFormat == nil || *c2.SourceFormat != expected {
+		t.Fatalf("Expected source format %+v instead of %+v\n", expected, c2.SourceFormat)
+	}
+	w2 := NewWaveFromClip(c2)
+	if w2.Format() != wave.FormatPCM || w2.Header.BitsPerSample != 24 || w2.Header.BytesPerBlock != 6 {
+		t.Errorf("Expected 24-bit PCM samples instead of format %d of %d bits in blocks of %d bytes\n",
+			w2.Format(), w2.Header.BitsPerSample, w2.Header.BytesPerBlock)
+	}
+	if same, err := c2.IsEqual(c); !same {
+		t.Error(err)
+	}
+	if w3 := NewWaveFromClip(c); w3.Header.BitsPerSample != 16 {
+		t.Errorf("Expected 16 bits per sample without a source format instead of %d\n", w3.Header.BitsPerSample)
+	}
+}
+
+func TestNewClipFromPCM(t *testing.T) {
+	data := []byte{1, 0, 2, 0, 3, 0, 0xFF, 0xFF}
+	c, err := NewClipFromPCM(data, 44100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := NewClip(2)
+	expected.Samples[0] = []int16{1, 3}
+	expected.Samples[1] = []int16{2, -1}
+	if same, err := c.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	if actual := c.PCMBytes(); string(actual) != string(data) {
+		t.Errorf("Expected PCM data %v instead of %v\n", data, actual)
+	}
+	if _, err := NewClipFromPCM(data[:6], 44100, 2); err == nil {
+		t.Errorf("Expected an error for PCM data ending mid-frame.")
+	}
+}
+
+func TestNewClipFromOgg(t *testing.T) {
+	c, err := NewClipFromOgg("testdata/220_Hz_sine_wave.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.SampleRate <= 0 {
+		t.Errorf("Expected a positive sample rate instead of %d\n", c.SampleRate)
+	}
+	if len(c.Samples) == 0 || c.LenPerChannel() == 0 {
+		t.Errorf("Expected samples in %d channels\n", len(c.Samples))
+	}
+}
+
+func TestNewClipFromMP3(t *testing.T) {
+	c, err := NewClipFromMP3("testdata/silence_mono.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.SampleRate != 44100 {
+		t.Errorf("Expected a sample rate of 44100 instead of %d\n", c.SampleRate)
+	}
+	if len(c.Samples) != 1 {
+		t.Errorf("Expected the mono file to be decoded as 1 channel instead of %d\n", len(c.Samples))
+	}
+	if c.Name != "testdata/silence_mono.mp3" {
+		t.Errorf("Expected the clip to be named after the file instead of %q\n", c.Name)
+	}
+}
+
+func TestBroadcastChunkRoundTrip(t *testing.T) {
+	c := NewClip(2)
+	c.Name = filepath.Join(os.TempDir(), "broadcast_clip")
+	c.SampleRate = 44100
+	c.Samples[0] = []int16{1, 2}
+	c.Samples[1] = []int16{3, 4}
+	c.BroadcastChunk = &wave.BroadcastChunk{Description: "Take 3", TimeReference: 44100}
+	if err := NewWaveFromClip(c).Write(); err != nil {
+		t.Fatal(err)
+	}
+	c2, err := NewClipFromWave(c.Name + ".wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2.BroadcastChunk == nil {
+		t.Fatalf("Expected a broadcast chunk and found none.")
+	}
+	if *c2.BroadcastChunk != *c.BroadcastChunk {
+		t.Errorf("Broadcast chunk %+v instead of %+v", *c2.BroadcastChunk, *c.BroadcastChunk)
+	}
+}
+
 func testIsEqual(t *testing.T) {
 	fileName := "samples/testing/bass_drum.wav"
 	bass1, err := NewClipFromWave(fileName)
@@ -78,6 +300,33 @@ func testIsEqual(t *testing.T) {
 	}
 }
 
+func TestEqual(t *testing.T) {
+	s, u := newTestClip(2, 10), newTestClip(2, 10)
+	u.Name = "Renamed"
+	if !s.Equal(u) {
+		t.Errorf("Expected clips with the same samples to be equal.")
+	}
+	u.Samples[1][5]++
+	if s.Equal(u) {
+		t.Errorf("Expected clips with varying sample values to differ.")
+	}
+	u = newTestClip(2, 10)
+	u.SampleRate = 48000
+	if s.Equal(u) {
+		t.Errorf("Expected clips with varying sample rates to differ.")
+	}
+	var none *Clip
+	if s.Equal(none) || none.Equal(s) || !none.Equal(nil) {
+		t.Errorf("Expected only nil clips to equal nil clips.")
+	}
+	if same, err := NewClip(0).IsEqual(NewClip(0)); !same {
+		t.Error(err)
+	}
+	if same, _ := NewClip(0).IsEqual(s); same {
+		t.Errorf("Expected clips with varying number of channels to differ.")
+	}
+}
+
 func TestDuration(t *testing.T) {
 	clip, err := NewClipFromWave(testSoundFilePath)
 	if err != nil {
@@ -90,6 +339,21 @@ func TestDuration(t *testing.T) {
 	}
 }
 
+func TestDurationPrecision(t *testing.T) {
+	c := NewClip(1)
+	c.SampleRate = 48000
+	c.Samples[0] = make([]int16, 48000)
+	if actual := c.Duration(); actual != time.Second {
+		t.Errorf("Expected length of %v instead of %v\n", time.Second, actual)
+	}
+	c.SampleRate = 44100
+	c.Samples[0] = make([]int16, 44100*60*10+1)
+	expected := 10*time.Minute + time.Second/44100
+	if actual := c.Duration(); actual != expected {
+		t.Errorf("Expected length of %v instead of %v\n", expected, actual)
+	}
+}
+
 func TestAppend(t *testing.T) {
 	once, err := NewClipFromWave(testSoundFilePath)
 	if err != nil {
@@ -121,6 +385,193 @@ func TestAppend(t *testing.T) {
 	}
 }
 
+func TestAppendFade(t *testing.T) {
+	target, source := NewClip(2), NewClip(2)
+	target.SampleRate, source.SampleRate = 1000, 1000
+	target.Samples[0] = []int16{1000, 1000, 1000, 1000}
+	target.Samples[1] = []int16{1000}
+	source.Samples[0] = []int16{0, 0, 2000, 2000}
+	source.Samples[1] = []int16{500, 600}
+	if err := target.AppendFade(source, 2*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// Gains of cos and sin of π/8 and 3π/8 for the overlap of 2 samples,
+	// which is shortened to 1 sample (of gains for π/4) for the second channel.
+	expected := NewClip(2)
+	expected.Samples[0] = []int16{1000, 1000, 924, 383, 2000, 2000}
+	expected.Samples[1] = []int16{1061, 600}
+	if same, err := target.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	source.SampleRate = 44100
+	if err := target.AppendFade(source, time.Millisecond); err == nil {
+		t.Errorf("Expected an error for clips with varying sample rates.")
+	}
+}
+
+func TestSampleAt(t *testing.T) {
+	c := newTestClip(2, 100)
+	c.SampleRate = 1000
+	at := 10 * time.Millisecond
+	sample, err := c.SampleAt(1, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := c.Samples[1][10]; sample != e {
+		t.Errorf("Expected %d instead of %d\n", e, sample)
+	}
+	if err := c.SetSampleAt(1, at, 1234); err != nil {
+		t.Fatal(err)
+	}
+	if sample, _ := c.SampleAt(1, at); sample != 1234 {
+		t.Errorf("Expected %d instead of %d\n", 1234, sample)
+	}
+	if _, err := c.SampleAt(2, 0); err == nil {
+		t.Errorf("Expected an error for a channel beyond the clip.")
+	}
+	if _, err := c.SampleAt(0, time.Second); err == nil {
+		t.Errorf("Expected an error for a time beyond the clip.")
+	}
+	if err := c.SetSampleAt(0, -time.Millisecond, 0); err == nil {
+		t.Errorf("Expected an error for a negative time.")
+	}
+}
+
+func TestInsertSilence(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 1000
+	c.Samples[0] = []int16{1, 2, 3}
+	c.Samples[1] = []int16{4, 5, 6}
+	if err := c.InsertSilence(time.Millisecond, 2*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	expected := NewClip(2)
+	expected.Samples[0] = []int16{1, 0, 0, 2, 3}
+	expected.Samples[1] = []int16{4, 0, 0, 5, 6}
+	if same, err := c.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	// Beyond the end of the clip.
+	if err := c.InsertSilence(7*time.Millisecond, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	expected.Samples[0] = []int16{1, 0, 0, 2, 3, 0, 0, 0}
+	expected.Samples[1] = []int16{4, 0, 0, 5, 6, 0, 0, 0}
+	if same, err := c.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	if err := c.InsertSilence(-time.Millisecond, time.Millisecond); err == nil {
+		t.Errorf("Expected an error for a negative position.")
+	}
+}
+
+func TestSilence(t *testing.T) {
+	c, err := Silence(1500*time.Millisecond, 1000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Samples) != 2 || c.SampleRate != 1000 || c.Duration() != 1500*time.Millisecond {
+		t.Errorf("Expected 1.5s of stereo silence instead of %v of %d channels\n",
+			c.Duration(), len(c.Samples))
+	}
+	for chanNum, samples := range c.Samples {
+		for i, sample := range samples {
+			if sample != 0 {
+				t.Fatalf("Expected %d instead of %d at offset %d on channel %d\n", 0, sample, i, chanNum)
+			}
+		}
+	}
+	if _, err := Silence(0, 1000, 2); err == nil {
+		t.Errorf("Expected an error for a duration of 0.")
+	}
+	if _, err := Silence(time.Second, 1000, 0); err == nil {
+		t.Errorf("Expected an error for 0 channels.")
+	}
+}
+
+func TestPad(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 1000
+	c.Samples[0] = []int16{1, 2, 3}
+	c.Samples[1] = []int16{4, 5, 6}
+	if err := c.Pad(2*time.Millisecond, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	expected := NewClip(2)
+	expected.Samples[0] = []int16{0, 0, 1, 2, 3, 0}
+	expected.Samples[1] = []int16{0, 0, 4, 5, 6, 0}
+	if same, err := c.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	if err := c.Pad(time.Millisecond, -time.Millisecond); err == nil {
+		t.Errorf("Expected an error for a negative duration.")
+	}
+}
+
+func TestZeroPadToTruncateTo(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 44100
+	c.Samples[0] = []int16{1, 2, 3}
+	c.Samples[1] = make([]int16, 20000)
+	third := time.Second / 3 // 14700 samples, though truncating would give 14699.
+	if err := c.ZeroPadTo(third); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Samples[0]) != 14700 || len(c.Samples[1]) != 20000 {
+		t.Errorf("Expected %d and %d samples instead of %d and %d\n",
+			14700, 20000, len(c.Samples[0]), len(c.Samples[1]))
+	}
+	if c.Samples[0][2] != 3 || c.Samples[0][14699] != 0 {
+		t.Errorf("Expected the audio to be followed by silence.")
+	}
+	if err := c.TruncateTo(third); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Samples[0]) != 14700 || len(c.Samples[1]) != 14700 {
+		t.Errorf("Expected %d samples instead of %d and %d\n", 14700, len(c.Samples[0]), len(c.Samples[1]))
+	}
+	if err := c.TruncateTo(-time.Second); err == nil {
+		t.Errorf("Expected an error for a negative duration.")
+	}
+	c.SampleRate = 0
+	if err := c.ZeroPadTo(time.Second); err == nil {
+		t.Errorf("Expected an error for a clip without a sample rate.")
+	}
+}
+
+func TestCut(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 1000
+	c.Samples[0] = []int16{1, 2, 3, 4, 5}
+	c.Samples[1] = []int16{6, 7, 8, 9, 10}
+	cut, err := c.Cut(time.Millisecond, 3*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := NewClip(2)
+	expected.Samples[0] = []int16{1, 4, 5}
+	expected.Samples[1] = []int16{6, 9, 10}
+	if same, err := c.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	expected.Samples[0] = []int16{2, 3}
+	expected.Samples[1] = []int16{7, 8}
+	if same, err := cut.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	// The end is clamped to the end of the clip.
+	if cut, err = c.Cut(2*time.Millisecond, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(cut.Samples[0]) != 1 || c.LenPerChannel() != 2 {
+		t.Errorf("Expected to cut %d sample and keep %d instead of cutting %d and keeping %d\n",
+			1, 2, len(cut.Samples[0]), c.LenPerChannel())
+	}
+	if _, err := c.Cut(time.Millisecond, time.Millisecond); err == nil {
+		t.Errorf("Expected an error for an empty region.")
+	}
+}
+
 func testMix(t *testing.T) {
 	bass, err := NewClipFromWave("samples/testing/bass_drum.wav")
 	if err != nil {
@@ -148,6 +599,181 @@ func testMix(t *testing.T) {
 	*/
 }
 
+func TestMismatchedClips(t *testing.T) {
+	c := newTestClip(2, 10)
+	for _, mismatched := range []*Clip{newTestClip(1, 10), newTestClip(2, 10)} {
+		if mismatched.SampleRate = c.SampleRate; len(mismatched.Samples) == len(c.Samples) {
+			mismatched.SampleRate = 48000
+		}
+		if err := c.Append(mismatched); err == nil {
+			t.Errorf("Expected an error appending a clip of %d channels at %d Hz.",
+				len(mismatched.Samples), mismatched.SampleRate)
+		}
+		if err := c.Mix(mismatched); err == nil {
+			t.Errorf("Expected an error mixing a clip of %d channels at %d Hz.",
+				len(mismatched.Samples), mismatched.SampleRate)
+		}
+	}
+	if c.LenPerChannel() != 10 {
+		t.Errorf("Expected %d samples instead of %d after errors\n", 10, c.LenPerChannel())
+	}
+	unknownRate := newTestClip(2, 10)
+	unknownRate.SampleRate = 0
+	if err := c.Append(unknownRate); err != nil {
+		t.Errorf("Expected a clip without a sample rate to append instead of: %v", err)
+	}
+}
+
+func TestMixMode(t *testing.T) {
+	tests := []struct {
+		mode     MixMode
+		expected []int16
+	}{
+		{Saturate, []int16{MaxInt16, MinInt16, 3, 4}},
+		{Wrap, []int16{-2769, 2768, 3, 4}},
+		{AverageScale, []int16{31383, -31384, 1, 2}},
+	}
+	for _, test := range tests {
+		s := NewClip(1)
+		s.Samples[0] = []int16{30000, -30000, 1}
+		c := NewClip(1)
+		c.Samples[0] = []int16{MaxInt16, MinInt16, 2, 4}
+		if err := s.MixMode(c, test.mode); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.Samples[0]) != len(test.expected) {
+			t.Fatalf("Expected %d samples instead of %d with mode %d\n",
+				len(test.expected), len(s.Samples[0]), test.mode)
+		}
+		for i, sample := range test.expected {
+			if s.Samples[0][i] != sample {
+				t.Errorf("Expected %d instead of %d at offset %d with mode %d\n",
+					sample, s.Samples[0][i], i, test.mode)
+			}
+		}
+	}
+}
+
+func TestMixed(t *testing.T) {
+	a := NewClip(1)
+	a.SampleRate = 44100
+	a.Samples[0] = []int16{1, MaxInt16}
+	b := NewClip(1)
+	b.Samples[0] = []int16{2, 1, 3}
+	mixed, err := Mixed(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := NewClip(1)
+	expected.SampleRate = 44100
+	expected.Samples[0] = []int16{3, MaxInt16, 3}
+	if same, err := mixed.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	if mixed.SampleRate != a.SampleRate {
+		t.Errorf("Expected sample rate %d instead of %d\n", a.SampleRate, mixed.SampleRate)
+	}
+	if a.Samples[0][0] != 1 || len(a.Samples[0]) != 2 || b.Samples[0][0] != 2 {
+		t.Errorf("Expected the mixed clips to be untouched instead of %v and %v", a.Samples, b.Samples)
+	}
+	if _, err := Mixed(a, NewClip(2)); err == nil {
+		t.Errorf("Expected an error mixing clips of varying numbers of channels.")
+	}
+}
+
+func TestMixEqualLength(t *testing.T) {
+	s := NewClip(1)
+	s.Samples[0] = []int16{30000, -30000, 1, 5}
+	c := NewClip(1)
+	c.Samples[0] = []int16{MaxInt16, MinInt16, 2}
+	if err := s.Mix(c); err != nil {
+		t.Fatal(err)
+	}
+	for i, sample := range []int16{MaxInt16, MinInt16, 3, 5} {
+		if s.Samples[0][i] != sample {
+			t.Errorf("Expected %d instead of %d at offset %d\n", sample, s.Samples[0][i], i)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	s := NewClip(2)
+	s.Samples[0] = []int16{1000, -1000, 1000, 1000}
+	s.Samples[1] = []int16{MaxInt16, MinInt16}
+	m := NewClip(2)
+	m.Samples[0] = []int16{MaxInt16, MaxInt16 / 2, 0, MinInt16 + 1}
+	m.Samples[1] = []int16{MinInt16, MaxInt16, 16384}
+	if err := s.Mul(m); err != nil {
+		t.Fatal(err)
+	}
+	for chanNum, expected := range [][]int16{{1000, -500, 0, -1000}, {MinInt16, MinInt16}} {
+		if len(s.Samples[chanNum]) != len(expected) {
+			t.Fatalf("Expected %d samples instead of %d on channel %d\n",
+				len(expected), len(s.Samples[chanNum]), chanNum)
+		}
+		for i, sample := range expected {
+			if s.Samples[chanNum][i] != sample {
+				t.Errorf("Expected %d instead of %d at offset %d on channel %d\n",
+					sample, s.Samples[chanNum][i], i, chanNum)
+			}
+		}
+	}
+	if err := s.Mul(NewClip(1)); err == nil {
+		t.Errorf("Expected an error for a modulator of varying number of channels.")
+	}
+}
+
+func TestCopyInto(t *testing.T) {
+	src := NewClip(2)
+	src.Samples[0] = []int16{1, 2}
+	src.Samples[1] = []int16{3}
+	dst := NewClip(2)
+	dst.Samples[0] = []int16{9, 9, 9, 9}
+	dst.Samples[1] = []int16{9, 9}
+	if err := src.CopyInto(dst, 1); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]int16{{9, 1, 2, 9}, {9, 3}}
+	for chanNum := range expected {
+		for i, e := range expected[chanNum] {
+			if actual := dst.Samples[chanNum][i]; actual != e {
+				t.Errorf("Expected %d instead of %d at offset %d on channel %d\n", e, actual, i, chanNum)
+			}
+		}
+	}
+	if allocs := testing.AllocsPerRun(10, func() { src.CopyInto(dst, 0) }); allocs != 0 {
+		t.Errorf("Expected no allocations instead of %v\n", allocs)
+	}
+	for _, at := range []int{-1, 2} {
+		if err := src.CopyInto(dst, at); err == nil {
+			t.Errorf("Expected an error copying to offset %d.", at)
+		}
+	}
+	if err := src.CopyInto(NewClip(1), 0); err == nil {
+		t.Errorf("Expected an error copying into a clip of fewer channels.")
+	}
+}
+
+func BenchmarkMix(b *testing.B) {
+	s := newTestClip(2, 4410)
+	t := newTestClip(2, 4410)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Mix(t)
+	}
+}
+
+func BenchmarkMixLonger(b *testing.B) {
+	t := newTestClip(2, 4410)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := newTestClip(2, 4000)
+		s.Mix(t)
+	}
+}
+
 func testSlice(t *testing.T) {
 	bass, err := NewClipFromWave("samples/testing/bass_drum.wav")
 	if err != nil {
@@ -167,6 +793,89 @@ func testSlice(t *testing.T) {
 	}
 }
 
+func TestSliceTime(t *testing.T) {
+	c := NewClip(1)
+	c.SampleRate = 1000
+	c.Samples[0] = []int16{1, 2, 3, 4, 5}
+	slice, err := c.SliceTime(time.Millisecond, 3*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := NewClip(1)
+	expected.Samples[0] = []int16{2, 3}
+	if same, err := slice.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	if slice.SampleRate != c.SampleRate {
+		t.Errorf("Expected sample rate %d instead of %d\n", c.SampleRate, slice.SampleRate)
+	}
+	if _, err := c.SliceTime(3*time.Millisecond, time.Millisecond); err == nil {
+		t.Errorf("Expected an error for a start following the end.")
+	}
+}
+
+func TestHeadTail(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 1000
+	c.Samples[0] = []int16{1, 2, 3, 4, 5}
+	c.Samples[1] = []int16{6, 7}
+	for _, e := range []struct {
+		name     string
+		actual   *Clip
+		expected [][]int16
+	}{
+		{"head", c.Head(3), [][]int16{{1, 2, 3}, {6, 7}}},
+		{"tail", c.Tail(3), [][]int16{{3, 4, 5}, {6, 7}}},
+		{"long head", c.Head(10), [][]int16{{1, 2, 3, 4, 5}, {6, 7}}},
+		{"negative tail", c.Tail(-1), [][]int16{{}, {}}},
+	} {
+		expected := NewClip(2)
+		expected.SampleRate = c.SampleRate
+		expected.Samples = e.expected
+		if !e.actual.Equal(expected) {
+			t.Errorf("Expected %v instead of %v for the %v\n", e.expected, e.actual.Samples, e.name)
+		}
+	}
+	head := c.Head(2)
+	head.Samples[0][0] = 0
+	if c.Samples[0][0] != 1 {
+		t.Errorf("Expected the head to be a copy, not to alias the clip.")
+	}
+}
+
+func TestSliceZeroCrossing(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 1000 // Zero crossings are searched for within 10 samples.
+	c.Samples[0] = []int16{5, 4, 3, 2, 1, -1, -2, -3, -2, -1, 1, 2}
+	c.Samples[1] = []int16{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	slice, err := c.SliceZeroCrossing(3*time.Millisecond, 9*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := NewClip(2)
+	expected.Samples[0] = []int16{-1, -2, -3, -2, -1}
+	expected.Samples[1] = []int16{5, 6, 7, 8, 9}
+	if same, err := slice.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	// Positions without a zero crossing nearby.
+	c.Samples[0] = make([]int16, 100)
+	for i := range c.Samples[0] {
+		c.Samples[0][i] = 1
+	}
+	c.Samples[1] = c.Samples[0]
+	slice, err = c.SliceZeroCrossing(30*time.Millisecond, 60*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := slice.LenPerChannel(); l != 30 {
+		t.Errorf("Expected %d samples instead of %d\n", 30, l)
+	}
+	if _, err := c.SliceZeroCrossing(3*time.Millisecond, time.Millisecond); err == nil {
+		t.Errorf("Expected an error for a start following the end.")
+	}
+}
+
 func testSplit(t *testing.T) {
 	bass, err := NewClipFromWave("samples/testing/bass_drum.wav")
 	if err != nil {
@@ -186,5 +895,144 @@ func testSplit(t *testing.T) {
 	}
 }
 
+// Creates a clip of the specified length with distinct data on each channel.
+func newTestClip(numChannels, lenPerChannel int) *Clip {
+	c := NewClip(numChannels)
+	c.SampleRate = 44100
+	for chanNum := range c.Samples {
+		c.Samples[chanNum] = make([]int16, lenPerChannel)
+		for i := range c.Samples[chanNum] {
+			c.Samples[chanNum][i] = int16(i*(chanNum+1) + chanNum)
+		}
+	}
+	return c
+}
+
+func TestReverse(t *testing.T) {
+	c := newTestClip(8, 1001)
+	expected := newTestClip(8, 1001)
+	// Reverse serially for comparison.
+	for chanNum := range expected.Samples {
+		reverse(expected.Samples[chanNum])
+	}
+	c.Reverse()
+	if same, err := c.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	if expected.Samples[3][0] != newTestClip(8, 1001).Samples[3][1000] {
+		t.Errorf("Expected the last sample to become the first sample.")
+	}
+}
+
+func TestReverseChannels(t *testing.T) {
+	c := NewClip(3)
+	c.Samples[0] = []int16{1, 2, 3}
+	c.Samples[1] = []int16{4, 5}
+	c.Samples[2] = []int16{6, 7, 8, 9}
+	if err := c.ReverseChannels(2, 0); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]int16{{3, 2, 1}, {4, 5}, {9, 8, 7, 6}}
+	for chanNum := range expected {
+		for i, e := range expected[chanNum] {
+			if actual := c.Samples[chanNum][i]; actual != e {
+				t.Errorf("Expected %d instead of %d at offset %d on channel %d\n", e, actual, i, chanNum)
+			}
+		}
+	}
+	for _, chanNums := range [][]int{{1, 1}, {0, 3}, {-1}} {
+		if err := c.ReverseChannels(chanNums...); err == nil {
+			t.Errorf("Expected an error reversing channels %v.", chanNums)
+		}
+	}
+	if c.Samples[0][0] != 3 {
+		t.Errorf("Expected no channels to be reversed when any are invalid.")
+	}
+}
+
+func TestReverseTime(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 1000
+	c.Samples[0] = []int16{0, 1, 2, 3, 4, 5}
+	c.Samples[1] = []int16{0, 1, 2}
+	if err := c.ReverseTime(time.Millisecond, 4*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]int16{{0, 3, 2, 1, 4, 5}, {0, 2, 1}}
+	for chanNum := range expected {
+		for i, e := range expected[chanNum] {
+			if actual := c.Samples[chanNum][i]; actual != e {
+				t.Errorf("Expected %d instead of %d at offset %d on channel %d\n", e, actual, i, chanNum)
+			}
+		}
+	}
+	if err := c.ReverseTime(2*time.Millisecond, time.Millisecond); err == nil {
+		t.Errorf("Expected an error for a region ending before it starts.")
+	}
+}
+
+func TestReverseDoesNotCopy(t *testing.T) {
+	samples := make([]int16, 44100)
+	if allocs := testing.AllocsPerRun(10, func() { reverse(samples) }); allocs != 0 {
+		t.Errorf("Expected no allocations instead of %v\n", allocs)
+	}
+	// Allocations for running channels concurrently must not grow with their length.
+	short, long := newTestClip(2, 10), newTestClip(2, 44100*10)
+	if s, l := testing.AllocsPerRun(10, short.Reverse), testing.AllocsPerRun(10, long.Reverse); l > s {
+		t.Errorf("Expected %v allocations instead of %v for a longer clip\n", s, l)
+	}
+}
+
+func BenchmarkReverse(b *testing.B) {
+	c := newTestClip(8, 44100*60*3)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Reverse()
+	}
+}
+
+func BenchmarkReverseSerial(b *testing.B) {
+	c := newTestClip(8, 44100*60*3)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for chanNum := range c.Samples {
+			reverse(c.Samples[chanNum])
+		}
+	}
+}
+
+func BenchmarkReverseTime(b *testing.B) {
+	c := newTestClip(8, 44100*60*3)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.ReverseTime(time.Minute, 2*time.Minute)
+	}
+}
+
+func BenchmarkNewWaveFromClip(b *testing.B) {
+	c := newTestClip(2, 44100*60*10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewWaveFromClip(c)
+	}
+}
+
+func BenchmarkNewWaveFromClipAppend(b *testing.B) {
+	c := newTestClip(2, 44100*60*10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var samples []int16
+		for offset := 0; offset < c.LenPerChannel(); offset++ {
+			for chanNum := range c.Samples {
+				samples = append(samples, c.Samples[chanNum][offset])
+			}
+		}
+	}
+}
+
 // TODO: TestStretch()
-// TODO: TestReverse()
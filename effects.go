@@ -0,0 +1,551 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// A ClippingError reports samples that exceeded the range of 16-bit audio
+// and were saturated (clipped) to MinInt16 or MaxInt16. The audio produced
+// alongside a ClippingError is otherwise valid.
+type ClippingError struct {
+	Clipped []int // The number of saturated samples on each channel.
+}
+
+func (e *ClippingError) Error() string {
+	return fmt.Sprintf("Samples exceeded the range of 16-bit audio and were clipped "+
+		"(per channel: %v)", e.Clipped)
+}
+
+// Returns a ClippingError if any samples were clipped, or nil otherwise.
+func clippingError(clipped []int) error {
+	for _, n := range clipped {
+		if n > 0 {
+			return &ClippingError{clipped}
+		}
+	}
+	return nil
+}
+
+// Converts a floating point value to a 16-bit sample, saturating values
+// beyond the range and also reporting whether the value was clipped.
+func saturate(f float64) (sample int16, clipped bool) {
+	f = math.Floor(f + 0.5)
+	switch {
+	case f > float64(MaxInt16):
+		return MaxInt16, true
+	case f < float64(MinInt16):
+		return MinInt16, true
+	}
+	return int16(f), false
+}
+
+// Returns a new clip of the audio convolved with an impulse response,
+// such as for convolution reverb. The impulse response must have the same
+// number of channels as the clip, or a single channel to apply to every channel.
+// Each channel of the new clip is len(c)+len(ir)-1 samples long.
+// A *ClippingError is returned along with the new clip if any samples clipped.
+func (c *Clip) Convolve(ir *Clip) (*Clip, error) {
+	if len(ir.Samples) != len(c.Samples) && len(ir.Samples) != 1 {
+		return nil, fmt.Errorf("Impulse response has %d channels, instead of 1 or %d.",
+			len(ir.Samples), len(c.Samples))
+	}
+	convolved := NewClip(len(c.Samples))
+	convolved.SampleRate = c.SampleRate
+	clipped := make([]int, len(c.Samples))
+	c.forEachChannel(func(chanNum int) {
+		h := ir.Samples[0]
+		if len(ir.Samples) > 1 {
+			h = ir.Samples[chanNum]
+		}
+		y := convolve(c.Samples[chanNum], h)
+		samples := make([]int16, len(y))
+		for i, f := range y {
+			var wasClipped bool
+			if samples[i], wasClipped = saturate(f); wasClipped {
+				clipped[chanNum]++
+			}
+		}
+		convolved.Samples[chanNum] = samples
+	})
+	return convolved, clippingError(clipped)
+}
+
+// Convolves samples with an impulse response by FFT with the overlap-add method,
+// treating samples as values in the range [-1, 1] (and so scaling the result).
+func convolve(x, h []int16) []float64 {
+	if len(x) == 0 || len(h) == 0 {
+		return []float64{}
+	}
+	y := make([]float64, len(x)+len(h)-1)
+	n := nextPowerOfTwo(2 * len(h))
+	blockLen := n - len(h) + 1
+	hf := make([]complex128, n)
+	for i, sample := range h {
+		hf[i] = complex(float64(sample)/-float64(MinInt16), 0)
+	}
+	fft(hf, false)
+	block := make([]complex128, n)
+	for start := 0; start < len(x); start += blockLen {
+		for i := range block {
+			block[i] = 0
+			if i < blockLen && start+i < len(x) {
+				block[i] = complex(float64(x[start+i]), 0)
+			}
+		}
+		fft(block, false)
+		for i := range block {
+			block[i] *= hf[i]
+		}
+		fft(block, true)
+		for i := 0; i < n && start+i < len(y); i++ {
+			y[start+i] += real(block[i])
+		}
+	}
+	return y
+}
+
+// Widens or narrows the stereo image of a stereo clip by scaling the side
+// (L-R) component of its mid / side representation: a width of 0 collapses
+// the clip to mono, 1 leaves it unchanged, and more than 1 widens it.
+func (c *Clip) StereoWidth(width float64) error {
+	if len(c.Samples) != 2 {
+		return fmt.Errorf("Stereo width requires 2 channels instead of %d.", len(c.Samples))
+	}
+	if width < 0 {
+		return fmt.Errorf("Stereo width of %v is negative.", width)
+	}
+	left, right := c.Samples[0], c.Samples[1]
+	n := len(left)
+	if len(right) < n {
+		n = len(right)
+	}
+	for i := 0; i < n; i++ {
+		mid := (float64(left[i]) + float64(right[i])) / 2
+		side := (float64(left[i]) - float64(right[i])) / 2 * width
+		left[i], _ = saturate(mid + side)
+		right[i], _ = saturate(mid - side)
+	}
+	return nil
+}
+
+// Ring modulates the clip, multiplying every channel by a (cosine) carrier
+// wave of the specified frequency, for metallic or robotic sounds.
+// A carrier of 0 Hz leaves the clip unchanged.
+func (c *Clip) RingMod(carrierHz float64) error {
+	if c.SampleRate <= 0 {
+		return fmt.Errorf("Clip has an invalid sample rate of %d.", c.SampleRate)
+	}
+	step := 2 * math.Pi * carrierHz / float64(c.SampleRate)
+	c.forEachChannel(func(chanNum int) {
+		samples := c.Samples[chanNum]
+		var phase float64
+		for i, sample := range samples {
+			samples[i], _ = saturate(float64(sample) * math.Cos(phase))
+			if phase += step; phase >= 2*math.Pi {
+				phase -= 2 * math.Pi
+			}
+		}
+	})
+	return nil
+}
+
+// Returns the value of samples at a fractional position by linear
+// interpolation, holding the first and last samples beyond either end.
+func interpolate(samples []int16, pos float64) float64 {
+	if pos <= 0 {
+		return float64(samples[0])
+	}
+	i := int(pos)
+	if i >= len(samples)-1 {
+		return float64(samples[len(samples)-1])
+	}
+	frac := pos - float64(i)
+	return float64(samples[i])*(1-frac) + float64(samples[i+1])*frac
+}
+
+// Applies vibrato to the clip, wobbling its pitch by reading each channel
+// through a delay line modulated by a sine wave at the specified rate.
+// The depth is the maximum deviation of the delay, in milliseconds.
+func (c *Clip) Vibrato(rateHz, depthMs float64) error {
+	if c.SampleRate <= 0 {
+		return fmt.Errorf("Clip has an invalid sample rate of %d.", c.SampleRate)
+	}
+	if depthMs < 0 {
+		return fmt.Errorf("Vibrato depth of %vms is negative.", depthMs)
+	}
+	depth := depthMs * float64(c.SampleRate) / 1000
+	step := 2 * math.Pi * rateHz / float64(c.SampleRate)
+	c.forEachChannel(func(chanNum int) {
+		dry := make([]int16, len(c.Samples[chanNum]))
+		copy(dry, c.Samples[chanNum])
+		for i := range dry {
+			delay := depth * (1 + math.Sin(step*float64(i)))
+			c.Samples[chanNum][i], _ = saturate(interpolate(dry, float64(i)-delay))
+		}
+	})
+	return nil
+}
+
+// Resamples by linear interpolation, reading samples at intervals of step,
+// so that steps greater than 1 shorten the samples and less than 1 lengthen them.
+func resample(samples []int16, step float64) []int16 {
+	if len(samples) == 0 {
+		return []int16{}
+	}
+	resampled := make([]int16, int(float64(len(samples)-1)/step)+1)
+	for i := range resampled {
+		resampled[i], _ = saturate(interpolate(samples, float64(i)*step))
+	}
+	return resampled
+}
+
+// Returns a new clip of the audio played back faster or slower by a factor,
+// like changing the speed of a tape: a factor of 2 plays back twice as fast,
+// halving the duration and raising the pitch by an octave.
+// The sample rate of the new clip is the same as the clip's.
+func (c *Clip) Speed(factor float64) (*Clip, error) {
+	if factor <= 0 || math.IsInf(factor, 0) || math.IsNaN(factor) {
+		return nil, fmt.Errorf("Speed factor of %v is not positive.", factor)
+	}
+	sped := NewClip(len(c.Samples))
+	sped.SampleRate = c.SampleRate
+	c.forEachChannel(func(chanNum int) {
+		sped.Samples[chanNum] = resample(c.Samples[chanNum], factor)
+	})
+	return sped, nil
+}
+
+// The number of zero crossings on each side of the windowed sinc low-pass filter
+// used for integer factor sample rate conversion; more are sharper but slower.
+const sincZeroCrossings = 16
+
+// Returns a windowed sinc (Blackman) low-pass filter passing frequencies below
+// a cutoff, as a fraction of the sample rate up to 0.5, with unity gain at DC.
+// The filter is 2*halfLen+1 taps long, centered on halfLen.
+func lowPassKernel(cutoff float64, halfLen int) []float64 {
+	kernel := make([]float64, 2*halfLen+1)
+	var sum float64
+	for i := range kernel {
+		x := float64(i - halfLen)
+		sinc := 2 * cutoff
+		if x != 0 {
+			sinc = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		phase := 2 * math.Pi * float64(i) / float64(len(kernel)-1)
+		window := 0.42 - 0.5*math.Cos(phase) + 0.08*math.Cos(2*phase)
+		kernel[i] = sinc * window
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// Lowers the sample rate of the clip by an integer factor, such as from 96kHz to 48kHz
+// with a factor of 2, keeping every factor-th sample. The audio is first low-pass filtered
+// below the new Nyquist frequency, so that frequencies too high for the new sample rate
+// are removed rather than aliased (folded back) into audible ones.
+// A factor of 1 leaves the clip unchanged.
+func (c *Clip) DownsampleBy(factor int) error {
+	if factor < 1 {
+		return fmt.Errorf("Downsampling factor of %d is less than 1.", factor)
+	}
+	if factor == 1 {
+		return nil
+	}
+	halfLen := sincZeroCrossings * factor
+	kernel := lowPassKernel(0.5/float64(factor), halfLen)
+	c.forEachChannel(func(chanNum int) {
+		samples := c.Samples[chanNum]
+		decimated := make([]int16, (len(samples)+factor-1)/factor)
+		for i := range decimated {
+			center := i * factor
+			var sum float64
+			for k, h := range kernel {
+				if j := center + k - halfLen; j >= 0 && j < len(samples) {
+					sum += float64(samples[j]) * h
+				}
+			}
+			decimated[i], _ = saturate(sum)
+		}
+		c.Samples[chanNum] = decimated
+	})
+	c.SampleRate /= factor
+	return nil
+}
+
+// Raises the sample rate of the clip by an integer factor, such as from 24kHz to 48kHz
+// with a factor of 2, inserting factor-1 zero samples after each sample and then
+// low-pass filtering below the original Nyquist frequency to interpolate between them,
+// removing the images of the audio that zero stuffing introduces at higher frequencies.
+// A factor of 1 leaves the clip unchanged.
+func (c *Clip) UpsampleBy(factor int) error {
+	if factor < 1 {
+		return fmt.Errorf("Upsampling factor of %d is less than 1.", factor)
+	}
+	if factor == 1 {
+		return nil
+	}
+	halfLen := sincZeroCrossings * factor
+	kernel := lowPassKernel(0.5/float64(factor), halfLen)
+	c.forEachChannel(func(chanNum int) {
+		samples := c.Samples[chanNum]
+		interpolated := make([]int16, len(samples)*factor)
+		for i := range interpolated {
+			// Only every factor-th tap of the kernel meets a sample that is not stuffed zero.
+			var sum float64
+			for k := (i + halfLen) % factor; k < len(kernel); k += factor {
+				if j := (i + halfLen - k) / factor; j >= 0 && j < len(samples) {
+					sum += float64(samples[j]) * kernel[k]
+				}
+			}
+			// Zero stuffing spreads the energy of each sample over factor samples.
+			interpolated[i], _ = saturate(sum * float64(factor))
+		}
+		c.Samples[chanNum] = interpolated
+	})
+	c.SampleRate *= factor
+	return nil
+}
+
+// Time stretches samples by a ratio (lengthening them for ratios greater than 1)
+// without changing their pitch, by overlapping and adding windowed frames
+// of the samples, with each frame aligned to the waveform of the last (WSOLA).
+func stretch(samples []int16, ratio float64) []int16 {
+	const (
+		frameLen  = 1024
+		hop       = frameLen / 2 // Hann windows overlapping by half sum to 1.
+		tolerance = frameLen / 4 // How far a frame may shift to align with the last.
+	)
+	at := func(i int) float64 {
+		if i < 0 || i >= len(samples) {
+			return 0
+		}
+		return float64(samples[i])
+	}
+	window := make([]float64, frameLen)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/frameLen)
+	}
+	out := make([]float64, int(float64(len(samples))*ratio+0.5))
+	// The first frame starts half a frame early, so every sample is overlapped.
+	prev := -hop
+	for start := -hop; start < len(out); start += hop {
+		pos := prev
+		if start > -hop {
+			// Choose the frame best matching where the last frame would have continued.
+			natural, bestCorrelation := int(float64(start)/ratio), math.Inf(-1)
+			for offset := -tolerance; offset <= tolerance; offset++ {
+				var correlation float64
+				for i := 0; i < hop; i++ {
+					correlation += at(natural+offset+i) * at(prev+hop+i)
+				}
+				if correlation > bestCorrelation {
+					pos, bestCorrelation = natural+offset, correlation
+				}
+			}
+		}
+		for i, w := range window {
+			if j := start + i; j >= 0 && j < len(out) {
+				out[j] += at(pos+i) * w
+			}
+		}
+		prev = pos
+	}
+	stretched := make([]int16, len(out))
+	for i, f := range out {
+		stretched[i], _ = saturate(f)
+	}
+	return stretched
+}
+
+// Returns a new clip of the audio with its pitch shifted by a number of semitones
+// (up for positive values, down for negative values) and its duration unchanged.
+func (c *Clip) PitchShift(semitones float64) *Clip {
+	ratio := math.Pow(2, semitones/12)
+	shifted := NewClip(len(c.Samples))
+	shifted.SampleRate = c.SampleRate
+	c.forEachChannel(func(chanNum int) {
+		samples := resample(stretch(c.Samples[chanNum], ratio), ratio)
+		for len(samples) < len(c.Samples[chanNum]) {
+			samples = append(samples, 0)
+		}
+		shifted.Samples[chanNum] = samples[:len(c.Samples[chanNum])]
+	})
+	return shifted
+}
+
+// Returns the linear gain (amplitude ratio) of a gain in decibels.
+func DecibelGain(dB float64) float64 {
+	return math.Pow(10, dB/20)
+}
+
+// Multiplies samples by a gain, returning the number of samples clipped.
+func amplify(samples []int16, gain float64) (clipped int) {
+	for i, sample := range samples {
+		var wasClipped bool
+		if samples[i], wasClipped = saturate(float64(sample) * gain); wasClipped {
+			clipped++
+		}
+	}
+	return clipped
+}
+
+// Applies gain in decibels to every channel, as per GainPerChannel.
+func (c *Clip) Gain(dB float64) error {
+	gains := make([]float64, len(c.Samples))
+	for i := range gains {
+		gains[i] = dB
+	}
+	return c.GainPerChannel(gains)
+}
+
+// Applies gain in decibels to a single channel, such as to trim one microphone.
+// Samples exceeding the range of 16-bit audio clip, and a *ClippingError is returned if any did.
+func (c *Clip) GainChannel(chanNum int, dB float64) error {
+	if chanNum < 0 || chanNum >= len(c.Samples) {
+		return fmt.Errorf("Channel %d does not exist in a clip of %d channels.", chanNum, len(c.Samples))
+	}
+	clipped := make([]int, len(c.Samples))
+	clipped[chanNum] = amplify(c.Samples[chanNum], DecibelGain(dB))
+	return clippingError(clipped)
+}
+
+// Applies a gain in decibels to each channel, such as to balance the channels of stereo audio.
+// Samples exceeding the range of 16-bit audio clip, and a *ClippingError is returned
+// (reporting the clipped samples of each channel) if any did.
+func (c *Clip) GainPerChannel(dB []float64) error {
+	if len(dB) != len(c.Samples) {
+		return fmt.Errorf("Expected a gain for each of %d channels instead of %d gains.",
+			len(c.Samples), len(dB))
+	}
+	clipped := make([]int, len(c.Samples))
+	c.forEachChannel(func(chanNum int) {
+		clipped[chanNum] = amplify(c.Samples[chanNum], DecibelGain(dB[chanNum]))
+	})
+	return clippingError(clipped)
+}
+
+// A point of a gain envelope, automating the volume of a clip over time.
+type EnvelopePoint struct {
+	At   time.Duration // Playback time of the point, from the start of the clip.
+	Gain float64       // Linear gain, where 1 is unity (see DecibelGain).
+}
+
+// Applies a gain envelope to the clip, interpolating linearly between points.
+// Audio before the first point or after the last has the gain of that point.
+// Points must be in order of time.
+func (c *Clip) ApplyGainEnvelope(points []EnvelopePoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	if c.SampleRate <= 0 {
+		return fmt.Errorf("Clip has an invalid sample rate of %d.", c.SampleRate)
+	}
+	envelope, err := NewGainEnvelopeProcessor(points, c.SampleRate)
+	if err != nil {
+		return err
+	}
+	c.forEachChannel(func(chanNum int) {
+		e := *envelope // Each channel is processed from the start of the envelope.
+		e.Process([][]int16{c.Samples[chanNum]})
+	})
+	return nil
+}
+
+// Replaces every sample of every channel with the result of a function of it,
+// such as for custom waveshaping or distortion. The function must handle any
+// sample from MinInt16 to MaxInt16, and be safe to call from multiple goroutines,
+// as channels are transformed concurrently.
+func (c *Clip) Apply(fn func(int16) int16) {
+	c.forEachChannel(func(chanNum int) {
+		apply(c.Samples[chanNum], fn)
+	})
+}
+
+// Replaces every sample of a channel with the result of a function of it.
+// The function must handle any sample from MinInt16 to MaxInt16.
+func (c *Clip) ApplyChannel(chanNum int, fn func(int16) int16) error {
+	if chanNum < 0 || chanNum >= len(c.Samples) {
+		return fmt.Errorf("Channel %d does not exist in a clip of %d channels.",
+			chanNum, len(c.Samples))
+	}
+	apply(c.Samples[chanNum], fn)
+	return nil
+}
+
+func apply(samples []int16, fn func(int16) int16) {
+	for i, sample := range samples {
+		samples[i] = fn(sample)
+	}
+}
+
+// Distorts the clip by soft clipping, shaping samples with a hyperbolic tangent
+// curve for a warmer overdrive than hard clipping. Greater drive distorts more,
+// while a drive near 0 leaves the clip nearly unchanged. Full scale samples
+// remain full scale.
+func (c *Clip) SoftClip(drive float64) error {
+	if drive <= 0 {
+		return fmt.Errorf("Drive of %v is not positive.", drive)
+	}
+	scale := math.Tanh(drive)
+	c.forEachChannel(func(chanNum int) {
+		samples := c.Samples[chanNum]
+		for i, sample := range samples {
+			shaped := math.Tanh(drive*amplitude(sample)) / scale
+			if sample < 0 {
+				shaped = -shaped
+			}
+			samples[i], _ = saturate(shaped * -float64(MinInt16))
+		}
+	})
+	return nil
+}
+
+// Returns how abruptly the clip would jump when looped, from 0 for a seamless loop
+// up to 1 for a jump across the entire range of samples, as per the largest difference
+// between the last and first samples of a channel.
+func (c *Clip) LoopDiscontinuity() float64 {
+	var max float64
+	for _, samples := range c.Samples {
+		if len(samples) == 0 {
+			continue
+		}
+		jump := math.Abs(float64(samples[len(samples)-1])-float64(samples[0])) / math.MaxUint16
+		if jump > max {
+			max = jump
+		}
+	}
+	return max
+}
+
+// Makes the clip loop without a click by crossfading its end into its start over a duration.
+// The start of each channel fades in over its end, and is then removed, shortening the clip
+// by the duration but continuing seamlessly from the end of the fade to the start of the loop.
+func (c *Clip) MakeSeamless(fade time.Duration) error {
+	if c.SampleRate <= 0 {
+		return fmt.Errorf("Clip has an invalid sample rate of %d.", c.SampleRate)
+	}
+	n := c.numSamples(fade)
+	if n <= 0 {
+		return fmt.Errorf("Crossfade of %v is too short for a sample rate of %d.", fade, c.SampleRate)
+	}
+	for chanNum, samples := range c.Samples {
+		if 2*n > len(samples) {
+			return fmt.Errorf("Crossfade of %v is longer than half of channel %d.", fade, chanNum)
+		}
+	}
+	c.forEachChannel(func(chanNum int) {
+		samples := c.Samples[chanNum]
+		head, tail := samples[:n], samples[len(samples)-n:]
+		for i := range tail {
+			g := float64(i+1) / float64(n+1)
+			tail[i], _ = saturate(float64(tail[i])*(1-g) + float64(head[i])*g)
+		}
+		c.Samples[chanNum] = samples[n:]
+	})
+	return nil
+}
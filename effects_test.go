@@ -0,0 +1,438 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+	"time"
+)
+
+func TestConvolve(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 44100
+	c.Samples[0] = []int16{1000, 2000, 3000, -4000, 0, 100}
+	c.Samples[1] = []int16{-1, 0, 1, 0, 0, 0}
+	ir := NewClip(1)
+	ir.Samples[0] = []int16{16384, 0, -8192} // 0.5, 0, -0.25
+	convolved, err := c.Convolve(ir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Direct (time domain) convolution for comparison.
+	for chanNum, x := range c.Samples {
+		if len(convolved.Samples[chanNum]) != len(x)+len(ir.Samples[0])-1 {
+			t.Fatalf("Expected %d samples instead of %d on channel %d\n",
+				len(x)+len(ir.Samples[0])-1, len(convolved.Samples[chanNum]), chanNum)
+		}
+		for i := range convolved.Samples[chanNum] {
+			var expected float64
+			for j, h := range ir.Samples[0] {
+				if i-j >= 0 && i-j < len(x) {
+					expected += float64(x[i-j]) * float64(h) / 32768
+				}
+			}
+			e, _ := saturate(expected)
+			if actual := convolved.Samples[chanNum][i]; actual != e {
+				t.Errorf("Expected %d instead of %d at offset %d on channel %d\n",
+					e, actual, i, chanNum)
+			}
+		}
+	}
+}
+
+func TestConvolveClipping(t *testing.T) {
+	c := NewClip(1)
+	c.Samples[0] = []int16{MaxInt16, MaxInt16}
+	ir := NewClip(1)
+	ir.Samples[0] = []int16{MaxInt16, MaxInt16}
+	convolved, err := c.Convolve(ir)
+	clippingErr, ok := err.(*ClippingError)
+	if !ok {
+		t.Fatalf("Expected a clipping error instead of %v", err)
+	}
+	if clippingErr.Clipped[0] != 1 || convolved.Samples[0][1] != MaxInt16 {
+		t.Errorf("Expected %d clipped sample instead of %d", 1, clippingErr.Clipped[0])
+	}
+	if _, err := c.Convolve(NewClip(2)); err == nil {
+		t.Errorf("Expected an error for an impulse response with too many channels.")
+	}
+}
+
+func TestStereoWidth(t *testing.T) {
+	c := NewClip(2)
+	c.Samples[0] = []int16{1000, -200, 30000}
+	c.Samples[1] = []int16{-1000, 600, 10000}
+	if err := c.StereoWidth(1); err != nil {
+		t.Fatal(err)
+	}
+	if c.Samples[0][1] != -200 || c.Samples[1][1] != 600 {
+		t.Errorf("Expected a width of 1 to leave the clip unchanged instead of %d, %d\n",
+			c.Samples[0][1], c.Samples[1][1])
+	}
+	if err := c.StereoWidth(2); err != nil {
+		t.Fatal(err)
+	}
+	if c.Samples[0][0] != 2000 || c.Samples[1][0] != -2000 {
+		t.Errorf("Expected %d, %d instead of %d, %d\n", 2000, -2000, c.Samples[0][0], c.Samples[1][0])
+	}
+	if c.Samples[0][2] != MaxInt16 {
+		t.Errorf("Expected %d instead of %d\n", MaxInt16, c.Samples[0][2])
+	}
+	if err := c.StereoWidth(0); err != nil {
+		t.Fatal(err)
+	}
+	for i := range c.Samples[0] {
+		if c.Samples[0][i] != c.Samples[1][i] {
+			t.Errorf("Expected a width of 0 to produce mono instead of %d, %d at offset %d\n",
+				c.Samples[0][i], c.Samples[1][i], i)
+		}
+	}
+	if err := NewClip(1).StereoWidth(1); err == nil {
+		t.Errorf("Expected an error for a mono clip.")
+	}
+}
+
+func TestRingMod(t *testing.T) {
+	c := newTestClip(2, 100)
+	expected := newTestClip(2, 100)
+	if err := c.RingMod(0); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.IsEqual(expected); !ok {
+		t.Errorf("Expected a 0 Hz carrier to leave the clip unchanged: %v", err)
+	}
+	// A carrier at half the sample rate inverts every other sample.
+	if err := c.RingMod(float64(c.SampleRate) / 2); err != nil {
+		t.Fatal(err)
+	}
+	for chanNum := range c.Samples {
+		for i, sample := range c.Samples[chanNum] {
+			e := expected.Samples[chanNum][i]
+			if i%2 == 1 {
+				e = -e
+			}
+			if sample != e {
+				t.Errorf("Expected %d instead of %d at offset %d on channel %d\n", e, sample, i, chanNum)
+			}
+		}
+	}
+	if err := NewClip(1).RingMod(440); err == nil {
+		t.Errorf("Expected an error for a clip without a sample rate.")
+	}
+}
+
+func TestVibrato(t *testing.T) {
+	c := NewClip(1)
+	c.SampleRate = 1000
+	c.Samples[0] = make([]int16, 1000)
+	for i := range c.Samples[0] {
+		c.Samples[0][i] = int16(i * 10)
+	}
+	// A rate of 0 Hz holds the delay at the depth: 2ms, or 2 samples.
+	if err := c.Vibrato(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	for i, sample := range c.Samples[0][2:] {
+		if sample != int16(i*10) {
+			t.Errorf("Expected %d instead of %d at offset %d\n", i*10, sample, i+2)
+		}
+	}
+	// Interpolated reads of a ramp are a ramp delayed by up to twice the depth.
+	for i := range c.Samples[0] {
+		c.Samples[0][i] = int16(i * 10)
+	}
+	if err := c.Vibrato(5, 1.5); err != nil {
+		t.Fatal(err)
+	}
+	for i, sample := range c.Samples[0][3:] {
+		i += 3
+		if low, high := int16((i-3)*10), int16(i*10); sample < low || sample > high {
+			t.Errorf("Expected %d to %d instead of %d at offset %d\n", low, high, sample, i)
+		}
+	}
+	if err := c.Vibrato(5, -1); err == nil {
+		t.Errorf("Expected an error for a negative depth.")
+	}
+}
+
+func TestSpeed(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 44100
+	c.Samples[0] = []int16{0, 100, 200, 300, 400, 500, 600, 700, 800}
+	c.Samples[1] = []int16{0, -100, -200, -300, -400, -500, -600, -700, -800}
+	faster, err := c.Speed(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slower, err := c.Speed(0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if faster.SampleRate != c.SampleRate {
+		t.Errorf("Expected a sample rate of %d instead of %d\n", c.SampleRate, faster.SampleRate)
+	}
+	for chanNum := range c.Samples {
+		sign := int16(1 - 2*chanNum)
+		if len(faster.Samples[chanNum]) != 5 || len(slower.Samples[chanNum]) != 17 {
+			t.Fatalf("Expected %d and %d samples instead of %d and %d on channel %d\n",
+				5, 17, len(faster.Samples[chanNum]), len(slower.Samples[chanNum]), chanNum)
+		}
+		for i, sample := range faster.Samples[chanNum] {
+			if e := sign * int16(i*200); sample != e {
+				t.Errorf("Expected %d instead of %d at offset %d on channel %d\n", e, sample, i, chanNum)
+			}
+		}
+		for i, sample := range slower.Samples[chanNum] {
+			if e := sign * int16(i*50); sample != e {
+				t.Errorf("Expected %d instead of %d at offset %d on channel %d\n", e, sample, i, chanNum)
+			}
+		}
+	}
+	if _, err := c.Speed(0); err == nil {
+		t.Errorf("Expected an error for a speed factor of 0.")
+	}
+}
+
+// Returns the index of the frequency bin with the greatest magnitude.
+func dominantBin(samples []int16) int {
+	x := make([]complex128, len(samples))
+	for i, sample := range samples {
+		x[i] = complex(float64(sample), 0)
+	}
+	fft(x, false)
+	dominant := 1
+	for i := 1; i < len(x)/2; i++ {
+		if cmplx.Abs(x[i]) > cmplx.Abs(x[dominant]) {
+			dominant = i
+		}
+	}
+	return dominant
+}
+
+// Returns samples of a sine wave with a whole number of cycles in each period of samples.
+func sineSamples(n, cycles, period int, amplitude float64) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(amplitude * math.Sin(2*math.Pi*float64(cycles*i)/float64(period)))
+	}
+	return samples
+}
+
+func TestDownsampleBy(t *testing.T) {
+	const n = 8192
+	c := NewClip(2)
+	c.SampleRate = 48000
+	c.Samples[0] = sineSamples(n, 1000, 48000, 10000)  // Below the new Nyquist frequency of 12kHz.
+	c.Samples[1] = sineSamples(n, 18000, 48000, 10000) // Above it, which would alias to 6kHz.
+	if err := c.DownsampleBy(2); err != nil {
+		t.Fatal(err)
+	}
+	if c.SampleRate != 24000 {
+		t.Errorf("Expected a sample rate of %d instead of %d\n", 24000, c.SampleRate)
+	}
+	if len(c.Samples[0]) != n/2 || len(c.Samples[1]) != n/2 {
+		t.Fatalf("Expected %d samples instead of %d and %d\n", n/2, len(c.Samples[0]), len(c.Samples[1]))
+	}
+	expected := sineSamples(n/2, 1000, 24000, 10000)
+	for i := 100; i < n/2-100; i++ {
+		if d := math.Abs(float64(c.Samples[0][i]) - float64(expected[i])); d > 50 {
+			t.Errorf("Expected %d instead of %d at offset %d\n", expected[i], c.Samples[0][i], i)
+		}
+		if math.Abs(float64(c.Samples[1][i])) > 50 {
+			t.Errorf("Expected an aliased sample of %d to be filtered at offset %d\n", c.Samples[1][i], i)
+		}
+	}
+	if err := c.DownsampleBy(0); err == nil {
+		t.Errorf("Expected an error for a factor of 0.")
+	}
+}
+
+func TestUpsampleBy(t *testing.T) {
+	const n = 2000
+	c := NewClip(1)
+	c.SampleRate = 8000
+	c.Samples[0] = sineSamples(n, 1000, 8000, 10000)
+	if err := c.UpsampleBy(3); err != nil {
+		t.Fatal(err)
+	}
+	if c.SampleRate != 24000 {
+		t.Errorf("Expected a sample rate of %d instead of %d\n", 24000, c.SampleRate)
+	}
+	if len(c.Samples[0]) != n*3 {
+		t.Fatalf("Expected %d samples instead of %d\n", n*3, len(c.Samples[0]))
+	}
+	expected := sineSamples(n*3, 1000, 24000, 10000)
+	for i := 200; i < n*3-200; i++ {
+		if d := math.Abs(float64(c.Samples[0][i]) - float64(expected[i])); d > 50 {
+			t.Errorf("Expected %d instead of %d at offset %d\n", expected[i], c.Samples[0][i], i)
+		}
+	}
+	if err := c.UpsampleBy(1); err != nil || len(c.Samples[0]) != n*3 {
+		t.Errorf("Expected a factor of 1 to leave the clip unchanged.")
+	}
+	if err := c.UpsampleBy(-1); err == nil {
+		t.Errorf("Expected an error for a factor of -1.")
+	}
+}
+
+func TestPitchShift(t *testing.T) {
+	const fftLen, bin = 4096, 40
+	c := NewClip(1)
+	c.SampleRate = 44100
+	c.Samples[0] = make([]int16, fftLen*4)
+	for i := range c.Samples[0] {
+		c.Samples[0][i] = int16(10000 * math.Sin(2*math.Pi*bin*float64(i)/fftLen))
+	}
+	for semitones, expected := range map[float64]int{12: bin * 2, -12: bin / 2, 0: bin} {
+		shifted := c.PitchShift(semitones)
+		if len(shifted.Samples[0]) != len(c.Samples[0]) {
+			t.Fatalf("Expected %d samples instead of %d\n", len(c.Samples[0]), len(shifted.Samples[0]))
+		}
+		if actual := dominantBin(shifted.Samples[0][fftLen : fftLen*2]); actual != expected {
+			t.Errorf("Expected a dominant frequency bin of %d instead of %d after shifting %v semitones\n",
+				expected, actual, semitones)
+		}
+	}
+}
+
+func TestApplyGainEnvelope(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 1000
+	for chanNum := range c.Samples {
+		c.Samples[chanNum] = make([]int16, 10)
+		for i := range c.Samples[chanNum] {
+			c.Samples[chanNum][i] = 1000
+		}
+	}
+	err := c.ApplyGainEnvelope([]EnvelopePoint{
+		{2 * time.Millisecond, 0},
+		{6 * time.Millisecond, 1},
+		{8 * time.Millisecond, DecibelGain(20)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int16{0, 0, 0, 250, 500, 750, 1000, 5500, 10000, 10000}
+	for chanNum := range c.Samples {
+		for i, sample := range c.Samples[chanNum] {
+			if sample != expected[i] {
+				t.Errorf("Expected %d instead of %d at offset %d on channel %d\n",
+					expected[i], sample, i, chanNum)
+			}
+		}
+	}
+	err = c.ApplyGainEnvelope([]EnvelopePoint{{time.Millisecond, 1}, {0, 1}})
+	if err == nil {
+		t.Errorf("Expected an error for envelope points out of order.")
+	}
+}
+
+func TestGainPerChannel(t *testing.T) {
+	c := NewClip(2)
+	c.Samples[0] = []int16{1000, -1000}
+	c.Samples[1] = []int16{1000, 30000}
+	if err := c.GainPerChannel([]float64{-20 * math.Log10(2), 20 * math.Log10(2)}); err == nil {
+		t.Errorf("Expected a clipping error for doubling 30000.")
+	} else if clipped := err.(*ClippingError).Clipped; clipped[0] != 0 || clipped[1] != 1 {
+		t.Errorf("Expected 1 sample clipped on channel 1 instead of %v\n", clipped)
+	}
+	expected := NewClip(2)
+	expected.Samples[0] = []int16{500, -500}
+	expected.Samples[1] = []int16{2000, MaxInt16}
+	if same, err := c.IsEqual(expected); !same {
+		t.Error(err)
+	}
+	if err := c.GainChannel(0, 20*math.Log10(3)); err != nil {
+		t.Fatal(err)
+	}
+	if c.Samples[0][0] != 1500 || c.Samples[1][0] != 2000 {
+		t.Errorf("Expected only channel 0 to be amplified: %v\n", c.Samples)
+	}
+	if err := c.GainChannel(2, 0); err == nil {
+		t.Errorf("Expected an error for a channel that does not exist.")
+	}
+	if err := c.GainPerChannel([]float64{0}); err == nil {
+		t.Errorf("Expected an error for too few gains.")
+	}
+}
+
+func TestApply(t *testing.T) {
+	c := newTestClip(2, 100)
+	expected := newTestClip(2, 100)
+	halve := func(s int16) int16 { return s / 2 }
+	c.Apply(halve)
+	if err := c.ApplyChannel(1, halve); err != nil {
+		t.Fatal(err)
+	}
+	for chanNum := range c.Samples {
+		for i, sample := range c.Samples[chanNum] {
+			e := expected.Samples[chanNum][i] / 2
+			if chanNum == 1 {
+				e /= 2
+			}
+			if sample != e {
+				t.Errorf("Expected %d instead of %d at offset %d on channel %d\n", e, sample, i, chanNum)
+			}
+		}
+	}
+	if err := c.ApplyChannel(2, halve); err == nil {
+		t.Errorf("Expected an error for a channel beyond the clip.")
+	}
+}
+
+func TestSoftClip(t *testing.T) {
+	c := NewClip(1)
+	c.Samples[0] = []int16{0, 1000, -1000, 8000, -16000, MaxInt16, MinInt16}
+	gentle := NewClip(1)
+	gentle.Samples[0] = append([]int16{}, c.Samples[0]...)
+	if err := gentle.SoftClip(0.01); err != nil {
+		t.Fatal(err)
+	}
+	for i, sample := range gentle.Samples[0] {
+		if e := c.Samples[0][i]; sample-e > 1 || e-sample > 1 {
+			t.Errorf("Expected a low drive to be near linear: %d instead of %d at offset %d\n", sample, e, i)
+		}
+	}
+	if err := c.SoftClip(5); err != nil {
+		t.Fatal(err)
+	}
+	if c.Samples[0][3] <= 8000*2 || c.Samples[0][4] >= -16000 || c.Samples[0][5] != MaxInt16 {
+		t.Errorf("Expected a high drive to boost quieter samples more than louder samples: %v\n",
+			c.Samples[0])
+	}
+	if c.Samples[0][1] != -c.Samples[0][2] {
+		t.Errorf("Expected a symmetric curve instead of %d and %d\n", c.Samples[0][1], c.Samples[0][2])
+	}
+	if err := c.SoftClip(0); err == nil {
+		t.Errorf("Expected an error for a drive of 0.")
+	}
+}
+
+func TestMakeSeamless(t *testing.T) {
+	c := NewClip(1)
+	c.SampleRate = 1000
+	c.Samples[0] = []int16{100, 200, 300, 400, 500, 600, 700, 800}
+	if d := c.LoopDiscontinuity(); math.Abs(d-700.0/65535) > 1e-9 {
+		t.Errorf("Expected a discontinuity of %v instead of %v\n", 700.0/65535, d)
+	}
+	if err := c.MakeSeamless(3 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// The tail of 600, 700, 800 fades into the head of 100, 200, 300,
+	// which continues on to the new start of 400.
+	expected := []int16{400, 500, 475, 450, 425}
+	for i, e := range expected {
+		if actual := c.Samples[0][i]; actual != e {
+			t.Errorf("Expected %d instead of %d at offset %d\n", e, actual, i)
+		}
+	}
+	if d := c.LoopDiscontinuity(); d >= 700.0/65535 {
+		t.Errorf("Expected a smaller discontinuity instead of %v\n", d)
+	}
+	if err := c.MakeSeamless(3 * time.Millisecond); err == nil {
+		t.Errorf("Expected an error for a crossfade longer than half the clip.")
+	}
+	if NewClip(2).LoopDiscontinuity() != 0 {
+		t.Errorf("Expected no discontinuity for an empty clip.")
+	}
+}
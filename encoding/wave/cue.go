@@ -0,0 +1,136 @@
+package wave
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A cue point marks a position in the samples of a file, as stored in the
+// cue chunk ("cue ") and labeled in the associated data list chunk ("LIST" "adtl").
+type CuePoint struct {
+	SamplePos int32 // Offset of the sample (block) the cue point marks.
+	Label     string
+}
+
+// A cue point as laid out in a cue chunk.
+type cuePointFields struct {
+	ID           uint32
+	Position     uint32
+	DataChunkID  [4]byte
+	ChunkStart   int32
+	BlockStart   int32
+	SampleOffset int32
+}
+
+// Returns the size of the contents of a cue chunk with cue points.
+func cueChunkSize(cuePoints []CuePoint) int32 {
+	return 4 + int32(len(cuePoints))*int32(binary.Size(cuePointFields{}))
+}
+
+// Returns the size of the contents of an associated data list chunk labeling cue points.
+func labelChunkSize(cuePoints []CuePoint) int32 {
+	size := int32(4) // The list type, "adtl".
+	for _, c := range cuePoints {
+		if c.Label != "" {
+			labelSize := 4 + int32(len(c.Label)) + 1 // The cue point ID and NUL terminated label.
+			size += 8 + labelSize + labelSize%2
+		}
+	}
+	return size
+}
+
+// Reads the contents of a cue chunk of the specified size, returning the cue
+// points by ID, and the IDs in the order the cue points appear.
+func readCueChunk(r io.Reader, size int32) (map[uint32]*CuePoint, []uint32, error) {
+	var numCuePoints int32
+	if err := binary.Read(r, binary.LittleEndian, &numCuePoints); err != nil {
+		return nil, nil, err
+	}
+	if numCuePoints < 0 || size != 4+numCuePoints*int32(binary.Size(cuePointFields{})) {
+		return nil, nil, errors.New(
+			fmt.Sprintf("Cue chunk size %v does not match its %v cue points", size, numCuePoints))
+	}
+	fields := make([]cuePointFields, numCuePoints)
+	if err := binary.Read(r, binary.LittleEndian, &fields); err != nil {
+		return nil, nil, err
+	}
+	cuePoints := make(map[uint32]*CuePoint, numCuePoints)
+	ids := make([]uint32, numCuePoints)
+	for i, f := range fields {
+		cuePoints[f.ID] = &CuePoint{SamplePos: f.SampleOffset}
+		ids[i] = f.ID
+	}
+	return cuePoints, ids, nil
+}
+
+// Returns whether the contents of a list chunk are an associated data list,
+// which labels cue points.
+func isLabelList(contents []byte) bool {
+	return len(contents) >= 4 && string(contents[:4]) == "adtl"
+}
+
+// Reads the contents of a list chunk of the specified size, returning the
+// labels of cue points by ID. Lists other than associated data lists, and
+// sub-chunks other than labels, are skipped.
+func readListChunk(r io.Reader, size int32) (map[uint32]string, error) {
+	contents := make([]byte, size)
+	if _, err := io.ReadFull(r, contents); err != nil {
+		return nil, err
+	}
+	labels := make(map[uint32]string)
+	if !isLabelList(contents) {
+		return labels, nil
+	}
+	for b := contents[4:]; len(b) >= 8; {
+		id, subSize := string(b[:4]), int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+		if subSize > len(b) {
+			return nil, errors.New(
+				fmt.Sprintf("List sub-chunk %q size %v exceeds the %v bytes remaining", id, subSize, len(b)))
+		}
+		if id == "labl" && subSize >= 4 {
+			labels[binary.LittleEndian.Uint32(b[:4])] = cString(b[4:subSize])
+		}
+		if subSize%2 == 1 && subSize < len(b) {
+			subSize++
+		}
+		b = b[subSize:]
+	}
+	return labels, nil
+}
+
+// Writes a cue chunk and an associated data list chunk labeling the cue points,
+// including the chunks' IDs and sizes. Cue points are identified by their position, from 1.
+func writeCueChunks(wr io.Writer, cuePoints []CuePoint) error {
+	fields := make([]cuePointFields, len(cuePoints))
+	for i, c := range cuePoints {
+		fields[i] = cuePointFields{
+			ID:           uint32(i + 1),
+			Position:     uint32(c.SamplePos),
+			DataChunkID:  [4]byte{'d', 'a', 't', 'a'},
+			SampleOffset: c.SamplePos,
+		}
+	}
+	cue := chunkHeader{[4]byte{'c', 'u', 'e', ' '}, cueChunkSize(cuePoints)}
+	list := chunkHeader{[4]byte{'L', 'I', 'S', 'T'}, labelChunkSize(cuePoints)}
+	data := []interface{}{cue, int32(len(cuePoints)), fields, list, [4]byte{'a', 'd', 't', 'l'}}
+	for i, c := range cuePoints {
+		if c.Label == "" {
+			continue
+		}
+		labelSize := 4 + int32(len(c.Label)) + 1
+		label := append([]byte(c.Label), 0)
+		if labelSize%2 == 1 {
+			label = append(label, 0)
+		}
+		data = append(data, chunkHeader{[4]byte{'l', 'a', 'b', 'l'}, labelSize}, uint32(i+1), label)
+	}
+	for _, d := range data {
+		if err := binary.Write(wr, binary.LittleEndian, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
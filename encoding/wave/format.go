@@ -0,0 +1,181 @@
+package wave
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The bytes of a sub-format GUID (of an extensible file) following its format code,
+// as per KSDATAFORMAT_SUBTYPE_PCM, KSDATAFORMAT_SUBTYPE_IEEE_FLOAT, etc.
+var subFormatGUIDSuffix = [14]byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+// Returns the sub-format GUID of an extensible file for a format code, such as FormatPCM.
+func SubFormatGUID(format int) (guid [16]byte) {
+	binary.LittleEndian.PutUint16(guid[:2], uint16(format))
+	copy(guid[2:], subFormatGUIDSuffix[:])
+	return
+}
+
+// Returns the format code of the samples of a file, which for an extensible file
+// is the format code of its sub-format GUID (or -1 for unknown sub-formats).
+func sampleFormat(h *Header, ext *ExtensionChunk) int {
+	format := int(uint16(h.AudioFormatCode))
+	if format != FormatExtensible {
+		return format
+	}
+	if ext == nil || string(ext.SubFormatGUID[2:]) != string(subFormatGUIDSuffix[:]) {
+		return -1
+	}
+	return int(binary.LittleEndian.Uint16(ext.SubFormatGUID[:2]))
+}
+
+// Returns the format code of the samples, resolving the sub-format of extensible files.
+func (w *File) Format() int {
+	return sampleFormat(w.Header, w.ExtensionChunk)
+}
+
+// Converts the file to the extensible format, keeping the format of its samples,
+// with a mask of the speaker positions of its channels (or 0 for unspecified positions).
+// The extensible format is expected of files with more than 2 channels.
+func (w *File) MakeExtensible(channelMask int32) {
+	format := w.Format()
+	extensible := uint16(FormatExtensible)
+	w.Header.AudioFormatCode = int16(extensible)
+	w.Header.FormatChunkSize = 40
+	w.ExtensionChunk = &ExtensionChunk{
+		ExtensionChunkSize: 22,
+		ValidBitsPerSample: w.Header.BitsPerSample,
+		ChannelMask:        channelMask,
+		SubFormatGUID:      SubFormatGUID(format),
+	}
+}
+
+// Changes the format and bit depth of the samples as they are written, such as to
+// FormatIEEEFloat with 32 bits per sample for the headroom of floating point samples,
+// keeping extensible files extensible. Non-PCM formats have a format chunk of 18 bytes.
+func (w *File) SetFormat(format int, bitsPerSample int16) error {
+	if err := checkSampleFormat(format, bitsPerSample); err != nil {
+		return err
+	}
+	w.Header.BitsPerSample = bitsPerSample
+	switch {
+	case uint16(w.Header.AudioFormatCode) == FormatExtensible && w.ExtensionChunk != nil:
+		w.ExtensionChunk.ValidBitsPerSample = bitsPerSample
+		w.ExtensionChunk.SubFormatGUID = SubFormatGUID(format)
+	case format == FormatPCM:
+		w.Header.AudioFormatCode = FormatPCM
+		w.Header.FormatChunkSize = 16
+	default:
+		w.Header.AudioFormatCode = int16(format)
+		w.Header.FormatChunkSize = 18
+		w.ExtensionChunk = &ExtensionChunk{}
+	}
+	return w.UpdateHeader()
+}
+
+// Returns the mask of the speaker positions of the channels of an extensible file,
+// or 0 for other files.
+func (w *File) ChannelMask() int32 {
+	if w.Header.FormatChunkSize != 40 || w.ExtensionChunk == nil {
+		return 0
+	}
+	return w.ExtensionChunk.ChannelMask
+}
+
+// Returns an error if samples of a format and bit depth can't be encoded or decoded.
+func checkSampleFormat(format int, bitsPerSample int16) error {
+	switch {
+	case format == FormatPCM && (bitsPerSample == 8 || bitsPerSample == 16 ||
+		bitsPerSample == 24 || bitsPerSample == 32):
+		return nil
+	case format == FormatIEEEFloat && (bitsPerSample == 32 || bitsPerSample == 64):
+		return nil
+	}
+	return errors.New(fmt.Sprintf("Unsupported format %v with %v bits per sample",
+		format, bitsPerSample))
+}
+
+// Decodes samples of a format and bit depth into 16-bit samples, discarding
+// any lesser significant bits and clipping floating point samples beyond [-1, 1].
+func decodeSamples(data []byte, format int, bitsPerSample int16) ([]int16, error) {
+	if err := checkSampleFormat(format, bitsPerSample); err != nil {
+		return nil, err
+	}
+	samples := make([]int16, len(data)/int(bitsPerSample/8))
+	decodeSamplesInto(samples, data, format, bitsPerSample)
+	return samples, nil
+}
+
+// Decodes as many samples as fit from data into a slice of samples,
+// of a format and bit depth already checked to be supported.
+func decodeSamplesInto(samples []int16, data []byte, format int, bitsPerSample int16) {
+	size := int(bitsPerSample / 8)
+	if len(data)/size < len(samples) {
+		samples = samples[:len(data)/size]
+	}
+	for i := range samples {
+		b := data[i*size : (i+1)*size]
+		switch {
+		case format == FormatIEEEFloat && size == 4:
+			samples[i] = floatToSample(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+		case format == FormatIEEEFloat:
+			samples[i] = floatToSample(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		case size == 1: // 8-bit samples are unsigned.
+			samples[i] = int16(b[0]-128) << 8
+		default: // The most significant two bytes are last.
+			samples[i] = int16(binary.LittleEndian.Uint16(b[size-2:]))
+		}
+	}
+}
+
+// Encodes 16-bit samples as samples of a format and bit depth.
+func encodeSamples(samples []int16, format int, bitsPerSample int16) ([]byte, error) {
+	if err := checkSampleFormat(format, bitsPerSample); err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(samples)*int(bitsPerSample/8))
+	encodeSamplesInto(data, samples, format, bitsPerSample)
+	return data, nil
+}
+
+// Encodes as many samples as fit into data, as samples of a format and bit depth
+// already checked to be supported.
+func encodeSamplesInto(data []byte, samples []int16, format int, bitsPerSample int16) {
+	size := int(bitsPerSample / 8)
+	if len(data)/size < len(samples) {
+		samples = samples[:len(data)/size]
+	}
+	for i, sample := range samples {
+		b := data[i*size : (i+1)*size]
+		f := float64(sample) / -math.MinInt16
+		switch {
+		case format == FormatIEEEFloat && size == 4:
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(f)))
+		case format == FormatIEEEFloat:
+			binary.LittleEndian.PutUint64(b, math.Float64bits(f))
+		case size == 1:
+			b[0] = byte(sample>>8) + 128
+		default: // Lesser significant bytes (if any) are zero.
+			for j := range b[:size-2] {
+				b[j] = 0
+			}
+			binary.LittleEndian.PutUint16(b[size-2:], uint16(sample))
+		}
+	}
+}
+
+// Converts a floating point sample in the range [-1, 1] to a 16-bit sample,
+// clipping values beyond the range.
+func floatToSample(f float64) int16 {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f >= 1:
+		return math.MaxInt16
+	case f <= -1:
+		return math.MinInt16
+	}
+	return int16(f * -math.MinInt16)
+}
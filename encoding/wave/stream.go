@@ -0,0 +1,235 @@
+package wave
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// The size of the RIFF and data chunks of wave data written by an Encoder
+// whose writer can't seek back to fill them in once the length is known,
+// as written by other streaming wave encoders.
+const unknownSize = -1 // 0xFFFFFFFF
+
+// A Decoder reads the samples of wave data incrementally, such as to process
+// files too large to read in entirety into memory.
+type Decoder struct {
+	Header         Header
+	ExtensionChunk ExtensionChunk
+	r              io.Reader
+	format         int
+	remaining      int64 // Bytes of the data chunk not yet read, or unknownSize to read until the end.
+	buf            []byte
+}
+
+// Creates a new Decoder reading wave data from a reader, having read the meta-data
+// preceding the samples. Chunks preceding the data chunk other than the format
+// chunk are skipped, as are any chunks following it.
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	d := &Decoder{r: r}
+	if err := binary.Read(r, binary.LittleEndian, &d.Header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errors.New("Wave data is too short for a wave header")
+		}
+		return nil, err
+	}
+	if err := d.Header.validate(); err != nil {
+		return nil, err
+	}
+	var err error
+	if d.ExtensionChunk, err = readExtension(r, &d.Header); err != nil {
+		return nil, err
+	}
+	d.format = sampleFormat(&d.Header, &d.ExtensionChunk)
+	if err := checkSampleFormat(d.format, d.Header.BitsPerSample); err != nil {
+		return nil, err
+	}
+	for {
+		var c chunkHeader
+		if err := binary.Read(r, binary.LittleEndian, &c); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = errors.New("No data chunk in wave data")
+			}
+			return nil, err
+		}
+		if string(c.ID[:]) == "data" {
+			if c.Size == unknownSize {
+				d.remaining = unknownSize
+				return d, nil
+			}
+			if err := validateDataChunkSize(c.Size, &d.Header); err != nil {
+				return nil, err
+			}
+			d.remaining = int64(c.Size)
+			return d, nil
+		}
+		if c.Size < 0 {
+			return nil, errors.New(fmt.Sprintf("Chunk %q size %v is negative", c.ID[:], c.Size))
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, int64(c.Size)+int64(c.Size%2)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Returns the number of channels of interleaved samples read.
+func (d *Decoder) NumChannels() int {
+	return int(d.Header.NumChannels)
+}
+
+// Reads interleaved samples, as many whole blocks (of a sample per channel) as fit
+// into samples, returning the number of samples read. Returns 0 and io.EOF once
+// every sample has been read.
+func (d *Decoder) Read(samples []int16) (int, error) {
+	size := int(d.Header.BitsPerSample / 8)
+	numChannels := d.NumChannels()
+	if len(samples) < numChannels {
+		return 0, errors.New(fmt.Sprintf("Buffer of %v samples is too short for a block of %v channels",
+			len(samples), numChannels))
+	}
+	n := int64(len(samples) - len(samples)%numChannels)
+	if d.remaining != unknownSize && n*int64(size) > d.remaining {
+		n = d.remaining / int64(size)
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	if int64(cap(d.buf)) < n*int64(size) {
+		d.buf = make([]byte, n*int64(size))
+	}
+	buf := d.buf[:n*int64(size)]
+	read, err := io.ReadFull(d.r, buf)
+	switch {
+	case err == io.EOF && d.remaining == unknownSize:
+		return 0, io.EOF
+	case err == io.ErrUnexpectedEOF && d.remaining == unknownSize:
+		// The last samples of wave data of unknown length, with any partial block discarded.
+		buf = buf[:read-read%(size*numChannels)]
+		d.remaining = 0
+		if len(buf) == 0 {
+			return 0, io.EOF
+		}
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return 0, errors.New(fmt.Sprintf("Data chunk truncated with %v bytes of samples unread",
+			d.remaining-int64(read)))
+	case err != nil:
+		return 0, err
+	case d.remaining != unknownSize:
+		d.remaining -= int64(len(buf))
+	}
+	decodeSamplesInto(samples, buf, d.format, d.Header.BitsPerSample)
+	return len(buf) / size, nil
+}
+
+// An Encoder writes the samples of wave data incrementally, such as to write
+// files too large to hold in entirety in memory.
+type Encoder struct {
+	Header         Header
+	ExtensionChunk *ExtensionChunk
+	w              io.Writer
+	format         int
+	start          int64 // The offset the wave data begins at, if the writer can seek.
+	dataSize       int64 // The bytes of samples written so far.
+	buf            []byte
+}
+
+// Creates a new Encoder writing wave data with the format of a header (such as from
+// NewHeader) to a writer, beginning with the meta-data. Headers with a format chunk
+// for an extension (of 18 or 40 bytes) are followed by the extension chunk, if any.
+// The lengths of the data are filled in when the Encoder is closed if the writer
+// is an io.WriteSeeker (such as an *os.File), and are otherwise left unknown.
+func NewEncoder(w io.Writer, h Header, ext *ExtensionChunk) (*Encoder, error) {
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	if h.FormatChunkSize != 16 && h.FormatChunkSize != 18 && h.FormatChunkSize != 40 {
+		return nil, errors.New(fmt.Sprintf("Format chunk size %v is not 16, 18, or 40", h.FormatChunkSize))
+	}
+	format := sampleFormat(&h, ext)
+	if err := checkSampleFormat(format, h.BitsPerSample); err != nil {
+		return nil, err
+	}
+	if ext == nil {
+		ext = &ExtensionChunk{}
+	}
+	h.ChunkSize = unknownSize
+	e := &Encoder{Header: h, ExtensionChunk: ext, w: w, format: format}
+	if ws, ok := w.(io.WriteSeeker); ok {
+		var err error
+		if e.start, err = ws.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	data := []interface{}{h}
+	switch h.FormatChunkSize {
+	case 18:
+		data = append(data, ext.ExtensionChunkSize)
+	case 40:
+		data = append(data, ext)
+	}
+	data = append(data, chunkHeader{[4]byte{'d', 'a', 't', 'a'}, unknownSize})
+	for _, d := range data {
+		if err := binary.Write(w, binary.LittleEndian, d); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Writes interleaved samples, which must be a whole number of blocks (of a sample per channel).
+func (e *Encoder) Write(samples []int16) error {
+	if len(samples)%int(e.Header.NumChannels) != 0 {
+		return errors.New(fmt.Sprintf("%v samples are not a whole number of blocks of %v channels",
+			len(samples), e.Header.NumChannels))
+	}
+	n := len(samples) * int(e.Header.BitsPerSample/8)
+	if cap(e.buf) < n {
+		e.buf = make([]byte, n)
+	}
+	buf := e.buf[:n]
+	encodeSamplesInto(buf, samples, e.format, e.Header.BitsPerSample)
+	if _, err := e.w.Write(buf); err != nil {
+		return err
+	}
+	e.dataSize += int64(n)
+	return nil
+}
+
+// Finishes writing the wave data, padding the data chunk to an even number of bytes,
+// and filling in the lengths of the RIFF and data chunks if the writer can seek.
+// The writer itself is left open.
+func (e *Encoder) Close() error {
+	if e.dataSize%2 == 1 {
+		if _, err := e.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	if ws, ok := e.w.(io.WriteSeeker); ok {
+		riffSize := 4 + 8 + int64(e.Header.FormatChunkSize) + 8 + e.dataSize + e.dataSize%2
+		if riffSize > int64(^uint32(0)>>1) {
+			return errors.New(fmt.Sprintf("Data chunk length %v exceeds the maximum of a wave file",
+				e.dataSize))
+		}
+		e.Header.ChunkSize = int32(riffSize)
+		for _, field := range []struct {
+			offset int64
+			size   int32
+		}{
+			{4, e.Header.ChunkSize},
+			{20 + int64(e.Header.FormatChunkSize) + 4, int32(e.dataSize)},
+		} {
+			if _, err := ws.Seek(e.start+field.offset, io.SeekStart); err != nil {
+				return err
+			}
+			if err := binary.Write(ws, binary.LittleEndian, field.size); err != nil {
+				return err
+			}
+		}
+		if _, err := ws.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,9 +5,12 @@ package wave
 // http://www-mmsp.ece.mcgill.ca/Documents/AudioFormats/WAVE/WAVE.html
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"time"
 	"unsafe"
@@ -29,7 +32,7 @@ type Header struct {
 	ChunkSize       int32
 	WaveID          [4]byte
 	FormatChunkID   [4]byte
-	FormatChunkSize int32 // Chunk size of this meta-data in bytes: 16, 17, or 40.
+	FormatChunkSize int32 // Chunk size of this meta-data in bytes: 16, 18, or 40.
 	AudioFormatCode int16 // Format code, refer to consntants for enum values.
 	NumChannels     int16 // Number of interleaved channels.
 	SampleRate      int32 // Blocks per second.
@@ -52,12 +55,227 @@ type DataChunk struct {
 	DataChunkSize int32
 }
 
-// Recalculates Header meta-data fields based on the current number of samples.
-func (w *File) UpdateHeader() {
-	w.DataChunk.DataChunkSize = int32(len(w.Samples) * int(w.Header.NumChannels))
-	w.Header.ChunkSize = int32(unsafe.Sizeof(w.Header)) + 28 + w.DataChunk.DataChunkSize
+// The ID and size that precede the contents of every chunk in a RIFF file.
+type chunkHeader struct {
+	ID   [4]byte
+	Size int32
+}
+
+// A chunk that is not otherwise interpreted, such as a list of INFO meta-data
+// or ID3 tags, preserved verbatim so that it is written back unchanged.
+type Chunk struct {
+	ID   [4]byte
+	Data []byte
+}
+
+// Returns the size of the chunk in a file, including its ID, size, and padding.
+func (c *Chunk) size() int32 {
+	return 8 + int32(len(c.Data)) + int32(len(c.Data)%2)
+}
+
+// Writes the chunk, including its ID and size.
+func writeChunk(wr io.Writer, c *Chunk) error {
+	data := c.Data
+	if len(data)%2 == 1 {
+		data = append(data[:len(data):len(data)], 0)
+	}
+	for _, d := range []interface{}{chunkHeader{c.ID, int32(len(c.Data))}, data} {
+		if err := binary.Write(wr, binary.LittleEndian, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Equivalent to enums for sample loop types.
+const (
+	LoopForward     = 0
+	LoopAlternating = 1 // a.k.a. "ping-pong"
+	LoopBackward    = 2
+)
+
+// Optional sampler chunk ("smpl") describing how a sampler should play back a file.
+type SamplerChunk struct {
+	Manufacturer      int32
+	Product           int32
+	SamplePeriod      int32 // Duration of one sample in nanoseconds.
+	MIDIUnityNote     int32 // MIDI note number that plays back the samples at their original pitch.
+	MIDIPitchFraction int32
+	SMPTEFormat       int32
+	SMPTEOffset       int32
+	Loops             []SampleLoop
+	SamplerData       []byte // Manufacturer specific data, passed through verbatim.
+}
+
+// The fixed-size portion of a sampler chunk, as laid out in a file.
+type samplerChunkFields struct {
+	Manufacturer      int32
+	Product           int32
+	SamplePeriod      int32
+	MIDIUnityNote     int32
+	MIDIPitchFraction int32
+	SMPTEFormat       int32
+	SMPTEOffset       int32
+	NumSampleLoops    int32
+	SamplerDataSize   int32
+}
+
+// A sustain loop of a sampler chunk.
+type SampleLoop struct {
+	CuePointID int32
+	Type       int32 // Refer to the Loop constants for enum values.
+	Start      int32 // Offset of the first sample (block) of the loop.
+	End        int32 // Offset of the last sample (block) of the loop.
+	Fraction   int32
+	PlayCount  int32 // Number of times to play the loop, 0 for infinitely.
+}
+
+// Returns the size of the sampler chunk's contents in bytes.
+func (s *SamplerChunk) size() int32 {
+	return int32(binary.Size(samplerChunkFields{})) +
+		int32(len(s.Loops))*int32(binary.Size(SampleLoop{})) +
+		int32(len(s.SamplerData))
+}
+
+// Optional Broadcast Wave Format (BWF) extension chunk ("bext").
+type BroadcastChunk struct {
+	Description          string // Up to 256 characters.
+	Originator           string // Up to 32 characters.
+	OriginatorReference  string // Up to 32 characters.
+	OriginationDate      string // Formatted as yyyy-mm-dd.
+	OriginationTime      string // Formatted as hh:mm:ss.
+	TimeReference        uint64 // First sample's offset (in samples) since midnight.
+	Version              int16
+	UMID                 [64]byte // SMPTE unique material identifier.
+	LoudnessValue        int16    // Integrated loudness in hundredths of LUFS.
+	LoudnessRange        int16    // In hundredths of LU.
+	MaxTruePeakLevel     int16    // In hundredths of dBTP.
+	MaxMomentaryLoudness int16    // In hundredths of LUFS.
+	MaxShortTermLoudness int16    // In hundredths of LUFS.
+	CodingHistory        string
+}
+
+// The fixed-size portion of a broadcast chunk, as laid out in a file.
+type broadcastChunkFields struct {
+	Description          [256]byte
+	Originator           [32]byte
+	OriginatorReference  [32]byte
+	OriginationDate      [10]byte
+	OriginationTime      [8]byte
+	TimeReference        uint64
+	Version              int16
+	UMID                 [64]byte
+	LoudnessValue        int16
+	LoudnessRange        int16
+	MaxTruePeakLevel     int16
+	MaxMomentaryLoudness int16
+	MaxShortTermLoudness int16
+	Reserved             [180]byte
+}
+
+// Returns the size of the broadcast chunk's contents in bytes.
+func (b *BroadcastChunk) size() int32 {
+	return int32(binary.Size(broadcastChunkFields{})) + int32(len(b.CodingHistory))
+}
+
+// Recalculates Header meta-data fields based on the current number of samples,
+// unless the header has no channels or sample rate, which would make the file unplayable.
+func (w *File) UpdateHeader() error {
+	if err := w.Header.checkPlayable(); err != nil {
+		return err
+	}
+	w.DataChunk.DataChunkSize = int32(len(w.Samples) * int(w.Header.BitsPerSample/8))
+	w.Header.ChunkSize = int32(unsafe.Sizeof(w.Header)) + 28 + w.DataChunk.DataChunkSize +
+		w.DataChunk.DataChunkSize%2
+	if w.Header.FormatChunkSize == 18 || w.Header.FormatChunkSize == 40 {
+		w.Header.ChunkSize += w.Header.FormatChunkSize - 16
+	}
+	if w.BroadcastChunk != nil {
+		w.Header.ChunkSize += 8 + w.BroadcastChunk.size() + w.BroadcastChunk.size()%2
+	}
+	if w.SamplerChunk != nil {
+		w.Header.ChunkSize += 8 + w.SamplerChunk.size() + w.SamplerChunk.size()%2
+	}
+	if len(w.CuePoints) > 0 {
+		w.Header.ChunkSize += 8 + cueChunkSize(w.CuePoints) + 8 + labelChunkSize(w.CuePoints)
+	}
+	for i := range w.Chunks {
+		w.Header.ChunkSize += w.Chunks[i].size()
+	}
 	h := w.Header
+	w.Header.BytesPerBlock = h.NumChannels * (h.BitsPerSample / 8)
 	w.Header.ByteRate = h.SampleRate * int32(h.BitsPerSample/8) * int32(h.NumChannels)
+	return nil
+}
+
+// Returns an error if the header has no channels or sample rate, as a new header might
+// if they were never set, without which other software can't play the file.
+func (h *Header) checkPlayable() error {
+	switch {
+	case h.NumChannels <= 0:
+		return errors.New(fmt.Sprintf("Number of channels %v is not positive", h.NumChannels))
+	case h.SampleRate <= 0:
+		return errors.New(fmt.Sprintf("Sample rate %v is not positive", h.SampleRate))
+	}
+	return nil
+}
+
+// Returns an error describing the first malformed or insane field of the header.
+func (h *Header) validate() error {
+	switch {
+	case string(h.ChunkID[:]) != "RIFF":
+		return errors.New(fmt.Sprintf("Chunk ID %q is not \"RIFF\"", h.ChunkID[:]))
+	case string(h.WaveID[:]) != "WAVE":
+		return errors.New(fmt.Sprintf("Wave ID %q is not \"WAVE\"", h.WaveID[:]))
+	case string(h.FormatChunkID[:]) != "fmt ":
+		return errors.New(fmt.Sprintf("Format chunk ID %q is not \"fmt \"", h.FormatChunkID[:]))
+	}
+	if err := h.checkPlayable(); err != nil {
+		return err
+	}
+	switch {
+	case h.BitsPerSample <= 0 || h.BitsPerSample%8 != 0 || h.BitsPerSample > 64:
+		return errors.New(fmt.Sprintf("Bits per sample %v is not a whole number of bytes from 1 to 8",
+			h.BitsPerSample))
+	case h.BytesPerBlock != h.NumChannels*(h.BitsPerSample/8):
+		return errors.New(fmt.Sprintf("Block align %v does not match %v channels of %v bits per sample",
+			h.BytesPerBlock, h.NumChannels, h.BitsPerSample))
+	}
+	return nil
+}
+
+// Returns an error if a data chunk's size is not a whole number of blocks.
+func validateDataChunkSize(size int32, h *Header) error {
+	if size < 0 || size%int32(h.BytesPerBlock) != 0 {
+		return errors.New(fmt.Sprintf("Data chunk length %v is not a multiple of block align %v",
+			size, h.BytesPerBlock))
+	}
+	return nil
+}
+
+// Validate checks that the wave file's meta-data is well-formed and consistent
+// with its samples, returning an error describing the first problem found.
+func (w *File) Validate() error {
+	if w.Header == nil {
+		return errors.New("Missing header")
+	}
+	if err := w.Header.validate(); err != nil {
+		return err
+	}
+	if w.DataChunk == nil {
+		return errors.New("Missing data chunk")
+	}
+	if id := w.DataChunk.DataChunkID; string(id[:]) != "data" {
+		return errors.New(fmt.Sprintf("Data chunk ID %q is not \"data\"", id[:]))
+	}
+	if err := validateDataChunkSize(w.DataChunk.DataChunkSize, w.Header); err != nil {
+		return err
+	}
+	if size := len(w.Samples) * int(w.Header.BitsPerSample/8); int(w.DataChunk.DataChunkSize) != size {
+		return errors.New(fmt.Sprintf("Data chunk length %v does not match the %v bytes of samples",
+			w.DataChunk.DataChunkSize, size))
+	}
+	return nil
 }
 
 // Creates meta-data for new stereo PCM file with default settings.
@@ -70,7 +288,7 @@ func NewHeader() (h Header) {
 	h.AudioFormatCode = FormatPCM
 	h.NumChannels = 2 // Guessing stereo.
 	h.SampleRate = 44100
-	h.ByteRate = 0
+	h.ByteRate = 44100 * 4
 	h.BytesPerBlock = 4
 	h.BitsPerSample = 16
 	return h
@@ -83,6 +301,10 @@ type File struct {
 	Header         *Header
 	ExtensionChunk *ExtensionChunk
 	DataChunk      *DataChunk
+	SamplerChunk   *SamplerChunk   // Only present for files with sampler meta-data.
+	BroadcastChunk *BroadcastChunk // Only present for Broadcast Wave Format files.
+	CuePoints      []CuePoint
+	Chunks         []Chunk // Chunks not otherwise interpreted, in the order read; written after all others.
 	Samples        []int16
 	startOffset    int // Hack for portaudio-go
 	// Maybe add nice, user-friendly fields like sample rate, bit depth, etc.
@@ -93,13 +315,13 @@ func (w *File) Duration() time.Duration {
 	return time.Duration(int64(len(w.Samples)) / int64(w.Header.NumChannels) / int64(w.Header.SampleRate) * 1000000000)
 }
 
-// Creates new, empty wave file structure.
+// Creates new, empty wave file structure, of 2 channels of 16-bit PCM samples at 44100 Hz
+// (as per NewHeader) until otherwise set.
 func NewFile(fileName string) *File {
 	header := NewHeader()
 	w := File{FileName: fileName,
-		Header: &header,
-		DataChunk: &DataChunk{DataChunkID: [4]byte{'d', 'a', 't', 'a'},
-			DataChunkSize: 4},
+		Header:      &header,
+		DataChunk:   &DataChunk{DataChunkID: [4]byte{'d', 'a', 't', 'a'}},
 		startOffset: 0}
 	return &w
 }
@@ -114,6 +336,25 @@ func OpenFile(fileName string) (*File, error) {
 	return w, nil
 }
 
+// Reads wave data in entirety from a reader, such as the body of an HTTP response,
+// without a file on disk. No more than BytesToReadThreshold bytes are read.
+func OpenReader(r io.Reader) (*File, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, BytesToReadThreshold+1))
+	if err != nil {
+		return nil, err
+	}
+	return OpenBytes(b)
+}
+
+// Reads wave data in entirety from memory, such as a file embedded with go:embed.
+func OpenBytes(b []byte) (*File, error) {
+	w := NewFile("")
+	if err := w.decode(bytes.NewReader(b), int64(len(b))); err != nil {
+		return w, err
+	}
+	return w, nil
+}
+
 // Convenience method for iterating (and looping) through samples.
 func (w *File) NextSample() int16 {
 	next := w.Samples[w.startOffset]
@@ -131,71 +372,412 @@ func (w *File) Read() (err error) {
 		return
 	}
 	defer f.Close()
-	if info, err := f.Stat(); err != nil || info.Size() > BytesToReadThreshold {
-		if err != nil {
-			return err
-		}
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if err = w.decode(f, info.Size()); err != nil {
+		return
+	}
+	(*w).Handle = f
+	return
+}
+
+// Returns the name of the file the wave data is read from, for error messages.
+func (w *File) source() string {
+	if w.FileName == "" {
+		return "(in memory)"
+	}
+	return w.FileName
+}
+
+// Decodes wave data of the specified size in bytes in entirety into the structure.
+func (w *File) decode(f io.ReadSeeker, fileSize int64) (err error) {
+	if fileSize > BytesToReadThreshold {
 		return errors.New(fmt.Sprintf("More bytes in sound file (%v) than allowed threshold (%v)",
-			info.Size(), BytesToReadThreshold))
+			fileSize, BytesToReadThreshold))
 	}
 	var header Header
-	var extChunkSize int16
 	var extChunk ExtensionChunk
 	var dataChunk DataChunk
 
 	if err = binary.Read(f, binary.LittleEndian, &header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errors.New(fmt.Sprintf("File %v is too short (%v bytes) for a wave header",
+				w.source(), fileSize))
+		}
 		return
 	}
-
-	switch header.FormatChunkSize {
-	case 18:
-		if err = binary.Read(f, binary.LittleEndian, &extChunkSize); err != nil {
-			return
-		}
-		extChunk.ExtensionChunkSize = extChunkSize
-	case 40:
-		if err = binary.Read(f, binary.LittleEndian, &extChunk); err != nil {
-			return
-		}
+	if err = header.validate(); err != nil {
+		return
+	}
+	if int64(header.ChunkSize)+8 > fileSize {
+		return errors.New(fmt.Sprintf("RIFF chunk size %v exceeds the %v bytes of file %v",
+			header.ChunkSize, fileSize, w.source()))
 	}
+	// Anything following the RIFF chunk, such as an ID3 tag appended to the file, is not wave data.
+	riffEnd := int64(header.ChunkSize) + 8
 
-	if err = binary.Read(f, binary.LittleEndian, &dataChunk); err != nil {
+	if extChunk, err = readExtension(f, &header); err != nil {
+		return
+	}
+	format := sampleFormat(&header, &extChunk)
+	if err = checkSampleFormat(format, header.BitsPerSample); err != nil {
 		return
 	}
 
-	if dataChunk.DataChunkSize > BytesToReadThreshold {
-		return errors.New(
-			fmt.Sprintf("Bad data chuck size %v in file %v (beyond threshold %v)",
-				dataChunk, w.FileName, BytesToReadThreshold))
+	// Walk the remaining chunks to the end of the RIFF chunk, which may appear in any order,
+	// including meta-data following the data chunk.
+	var samples []int16
+	var samplerChunk *SamplerChunk
+	var broadcastChunk *BroadcastChunk
+	var cuePoints map[uint32]*CuePoint
+	var cueIDs []uint32
+	var chunks []Chunk
+	labels := make(map[uint32]string)
+	foundData := false
+	for {
+		var offset int64
+		if offset, err = f.Seek(0, io.SeekCurrent); err != nil {
+			return
+		}
+		var c chunkHeader
+		if offset >= riffEnd {
+			err = io.EOF
+		} else if offset+8 > riffEnd {
+			err = io.ErrUnexpectedEOF
+		} else {
+			err = binary.Read(f, binary.LittleEndian, &c)
+		}
+		if err == io.EOF {
+			if foundData {
+				err = nil
+				break
+			}
+			err = errors.New(fmt.Sprintf("No data chunk in file %v", w.source()))
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = errors.New(fmt.Sprintf("Truncated chunk header in file %v", w.source()))
+		}
+		if err != nil {
+			return
+		}
+		offset += 8
+		if c.Size < 0 || offset+int64(c.Size) > riffEnd {
+			return errors.New(fmt.Sprintf("Chunk %q size %v exceeds the %v bytes remaining in file %v",
+				c.ID[:], c.Size, riffEnd-offset, w.source()))
+		}
+		switch string(c.ID[:]) {
+		case "data":
+			if c.Size > BytesToReadThreshold {
+				return errors.New(
+					fmt.Sprintf("Bad data chuck size %v in file %v (beyond threshold %v)",
+						c.Size, w.source(), BytesToReadThreshold))
+			}
+			if err = validateDataChunkSize(c.Size, &header); err != nil {
+				return
+			}
+			dataChunk = DataChunk{c.ID, c.Size}
+			data := make([]byte, c.Size)
+			if _, err = io.ReadFull(f, data); err != nil {
+				return
+			}
+			if samples, err = decodeSamples(data, format, header.BitsPerSample); err != nil {
+				return
+			}
+			foundData = true
+		case "smpl":
+			if samplerChunk, err = readSamplerChunk(f, c.Size); err != nil {
+				return
+			}
+		case "cue ":
+			if cuePoints, cueIDs, err = readCueChunk(f, c.Size); err != nil {
+				return
+			}
+		case "LIST":
+			contents := make([]byte, c.Size)
+			if _, err = io.ReadFull(f, contents); err != nil {
+				return
+			}
+			if !isLabelList(contents) {
+				chunks = append(chunks, Chunk{c.ID, contents})
+				break
+			}
+			var l map[uint32]string
+			if l, err = readListChunk(bytes.NewReader(contents), c.Size); err != nil {
+				return
+			}
+			for id, label := range l {
+				labels[id] = label
+			}
+		case "bext":
+			if broadcastChunk, err = readBroadcastChunk(f, c.Size); err != nil {
+				return
+			}
+		default:
+			contents := make([]byte, c.Size)
+			if _, err = io.ReadFull(f, contents); err != nil {
+				return
+			}
+			chunks = append(chunks, Chunk{c.ID, contents})
+		}
+		if c.Size%2 == 1 && offset+int64(c.Size) < riffEnd { // Chunks are padded to an even number of bytes.
+			if _, err = f.Seek(1, io.SeekCurrent); err != nil {
+				return
+			}
+		}
 	}
 
-	(*w).Handle = f
 	(*w).Header = &header
 	(*w).ExtensionChunk = &extChunk
 	(*w).DataChunk = &dataChunk
+	(*w).SamplerChunk = samplerChunk
+	(*w).BroadcastChunk = broadcastChunk
+	(*w).Chunks = chunks
+	(*w).CuePoints = nil
+	for _, id := range cueIDs {
+		cuePoint := cuePoints[id]
+		cuePoint.Label = labels[id]
+		(*w).CuePoints = append((*w).CuePoints, *cuePoint)
+	}
+	(*w).Samples = samples
+	return
+}
 
-	numSamples := int(dataChunk.DataChunkSize / int32(header.BitsPerSample/8))
-	(*w).Samples = make([]int16, numSamples)
-	err = binary.Read(f, binary.LittleEndian, &(*w).Samples)
+// Reads the remainder of a format chunk following its header, returning the extension
+// of the format chunk, if any. Any other contents of the format chunk are skipped,
+// and the header changed to that of a 16 byte format chunk, as it is then written.
+func readExtension(r io.Reader, h *Header) (ext ExtensionChunk, err error) {
+	switch h.FormatChunkSize {
+	case 16:
+	case 18:
+		err = binary.Read(r, binary.LittleEndian, &ext.ExtensionChunkSize)
+	case 40:
+		err = binary.Read(r, binary.LittleEndian, &ext)
+	default:
+		if h.FormatChunkSize < 16 {
+			return ext, errors.New(fmt.Sprintf("Format chunk size %v is less than the minimum of 16",
+				h.FormatChunkSize))
+		}
+		skipped := h.FormatChunkSize - 16 + h.FormatChunkSize%2
+		if _, err = io.CopyN(ioutil.Discard, r, int64(skipped)); err == nil {
+			h.ChunkSize -= skipped
+			h.FormatChunkSize = 16
+		}
+	}
 	return
 }
 
+// Reads the contents of a sampler chunk of the specified size.
+func readSamplerChunk(r io.Reader, size int32) (*SamplerChunk, error) {
+	var fields samplerChunkFields
+	if err := binary.Read(r, binary.LittleEndian, &fields); err != nil {
+		return nil, err
+	}
+	// Checked before allocating, in 64 bits so that huge counts can't overflow to match the size.
+	expected := int64(binary.Size(fields)) +
+		int64(fields.NumSampleLoops)*int64(binary.Size(SampleLoop{})) + int64(fields.SamplerDataSize)
+	if fields.NumSampleLoops < 0 || fields.SamplerDataSize < 0 || expected != int64(size) {
+		return nil, errors.New(
+			fmt.Sprintf("Sampler chunk size %v does not match its %v loops and %v bytes of data",
+				size, fields.NumSampleLoops, fields.SamplerDataSize))
+	}
+	s := &SamplerChunk{
+		Manufacturer:      fields.Manufacturer,
+		Product:           fields.Product,
+		SamplePeriod:      fields.SamplePeriod,
+		MIDIUnityNote:     fields.MIDIUnityNote,
+		MIDIPitchFraction: fields.MIDIPitchFraction,
+		SMPTEFormat:       fields.SMPTEFormat,
+		SMPTEOffset:       fields.SMPTEOffset,
+		Loops:             make([]SampleLoop, fields.NumSampleLoops),
+		SamplerData:       make([]byte, fields.SamplerDataSize),
+	}
+	if err := binary.Read(r, binary.LittleEndian, &s.Loops); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, s.SamplerData); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Writes a sampler chunk, including the chunk's ID and size.
+func writeSamplerChunk(wr io.Writer, s *SamplerChunk) error {
+	c := chunkHeader{[4]byte{'s', 'm', 'p', 'l'}, s.size()}
+	fields := samplerChunkFields{
+		Manufacturer:      s.Manufacturer,
+		Product:           s.Product,
+		SamplePeriod:      s.SamplePeriod,
+		MIDIUnityNote:     s.MIDIUnityNote,
+		MIDIPitchFraction: s.MIDIPitchFraction,
+		SMPTEFormat:       s.SMPTEFormat,
+		SMPTEOffset:       s.SMPTEOffset,
+		NumSampleLoops:    int32(len(s.Loops)),
+		SamplerDataSize:   int32(len(s.SamplerData)),
+	}
+	for _, data := range []interface{}{c, fields, s.Loops, s.SamplerData} {
+		if err := binary.Write(wr, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	if c.Size%2 == 1 {
+		_, err := wr.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// Reads the contents of a broadcast chunk of the specified size.
+func readBroadcastChunk(r io.Reader, size int32) (*BroadcastChunk, error) {
+	var fields broadcastChunkFields
+	historySize := size - int32(binary.Size(fields))
+	if historySize < 0 {
+		return nil, errors.New(
+			fmt.Sprintf("Broadcast chunk size %v is less than the minimum of %v",
+				size, binary.Size(fields)))
+	}
+	if err := binary.Read(r, binary.LittleEndian, &fields); err != nil {
+		return nil, err
+	}
+	history := make([]byte, historySize)
+	if _, err := io.ReadFull(r, history); err != nil {
+		return nil, err
+	}
+	return &BroadcastChunk{
+		Description:          cString(fields.Description[:]),
+		Originator:           cString(fields.Originator[:]),
+		OriginatorReference:  cString(fields.OriginatorReference[:]),
+		OriginationDate:      cString(fields.OriginationDate[:]),
+		OriginationTime:      cString(fields.OriginationTime[:]),
+		TimeReference:        fields.TimeReference,
+		Version:              fields.Version,
+		UMID:                 fields.UMID,
+		LoudnessValue:        fields.LoudnessValue,
+		LoudnessRange:        fields.LoudnessRange,
+		MaxTruePeakLevel:     fields.MaxTruePeakLevel,
+		MaxMomentaryLoudness: fields.MaxMomentaryLoudness,
+		MaxShortTermLoudness: fields.MaxShortTermLoudness,
+		CodingHistory:        cString(history),
+	}, nil
+}
+
+// Writes a broadcast chunk, including the chunk's ID and size.
+// Text fields longer than their fixed size in the file are truncated.
+func writeBroadcastChunk(wr io.Writer, b *BroadcastChunk) error {
+	c := chunkHeader{[4]byte{'b', 'e', 'x', 't'}, b.size()}
+	fields := broadcastChunkFields{
+		TimeReference:        b.TimeReference,
+		Version:              b.Version,
+		UMID:                 b.UMID,
+		LoudnessValue:        b.LoudnessValue,
+		LoudnessRange:        b.LoudnessRange,
+		MaxTruePeakLevel:     b.MaxTruePeakLevel,
+		MaxMomentaryLoudness: b.MaxMomentaryLoudness,
+		MaxShortTermLoudness: b.MaxShortTermLoudness,
+	}
+	copy(fields.Description[:], b.Description)
+	copy(fields.Originator[:], b.Originator)
+	copy(fields.OriginatorReference[:], b.OriginatorReference)
+	copy(fields.OriginationDate[:], b.OriginationDate)
+	copy(fields.OriginationTime[:], b.OriginationTime)
+	for _, data := range []interface{}{c, fields, []byte(b.CodingHistory)} {
+		if err := binary.Write(wr, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	if c.Size%2 == 1 {
+		_, err := wr.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// Returns the text of a fixed-size, NUL padded character array.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
 // Write writes the wave file in entirety to disk.
 func (w *File) Write() (err error) {
-	f, err := os.OpenFile((*w).FileName, (os.O_WRONLY | os.O_CREATE | os.O_TRUNC), 0644)
-	defer f.Close()
+	b, err := w.Bytes()
 	if err != nil {
 		return
 	}
-	if err = binary.Write(f, binary.LittleEndian, w.Header); err != nil {
+	return ioutil.WriteFile((*w).FileName, b, 0644)
+}
+
+// Bytes returns the wave file in entirety as it is written to disk.
+func (w *File) Bytes() ([]byte, error) {
+	var b bytes.Buffer
+	if err := w.encode(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Writes the wave file in entirety.
+func (w *File) encode(wr io.Writer) (err error) {
+	if err = w.Header.checkPlayable(); err != nil {
 		return
 	}
-	// TODO: Writing out the extension data chunk is not addressed here.
-	if err = binary.Write(f, binary.LittleEndian, w.DataChunk); err != nil {
+	data, err := encodeSamples(w.Samples, w.Format(), w.Header.BitsPerSample)
+	if err != nil {
 		return
 	}
-	if err = binary.Write(f, binary.LittleEndian, w.Samples); err != nil {
+	if err = binary.Write(wr, binary.LittleEndian, w.Header); err != nil {
 		return
 	}
+	switch w.Header.FormatChunkSize {
+	case 18:
+		var extChunkSize int16
+		if w.ExtensionChunk != nil {
+			extChunkSize = w.ExtensionChunk.ExtensionChunkSize
+		}
+		err = binary.Write(wr, binary.LittleEndian, extChunkSize)
+	case 40:
+		extChunk := w.ExtensionChunk
+		if extChunk == nil {
+			extChunk = &ExtensionChunk{}
+		}
+		err = binary.Write(wr, binary.LittleEndian, extChunk)
+	}
+	if err != nil {
+		return
+	}
+	if w.BroadcastChunk != nil {
+		if err = writeBroadcastChunk(wr, w.BroadcastChunk); err != nil {
+			return
+		}
+	}
+	if err = binary.Write(wr, binary.LittleEndian, w.DataChunk); err != nil {
+		return
+	}
+	if len(data)%2 == 1 { // Padded to an even number of bytes, as are all chunks.
+		data = append(data, 0)
+	}
+	if _, err = wr.Write(data); err != nil {
+		return
+	}
+	if w.SamplerChunk != nil {
+		if err = writeSamplerChunk(wr, w.SamplerChunk); err != nil {
+			return
+		}
+	}
+	if len(w.CuePoints) > 0 {
+		if err = writeCueChunks(wr, w.CuePoints); err != nil {
+			return
+		}
+	}
+	for i := range w.Chunks {
+		if err = writeChunk(wr, &w.Chunks[i]); err != nil {
+			return
+		}
+	}
 	return
 }
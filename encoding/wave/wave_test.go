@@ -1,7 +1,12 @@
 package wave
 
 import (
+	"bytes"
+	"encoding/binary"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -98,3 +103,530 @@ func TestHeader(t *testing.T) {
 		t.Errorf("Value %q for %q instead of %q", actual, "encoding type", FormatPCM)
 	}
 }
+
+func TestSamplerChunk(t *testing.T) {
+	fileName := filepath.Join(os.TempDir(), "sampler_loop.wav")
+	w := NewFile(fileName)
+	w.Samples = []int16{0, 0, 1, 1, 2, 2, 3, 3}
+	w.SamplerChunk = &SamplerChunk{
+		MIDIUnityNote: 60,
+		Loops:         []SampleLoop{{Type: LoopForward, Start: 1, End: 3}},
+		SamplerData:   []byte{7, 7, 7},
+	}
+	w.UpdateHeader()
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+	w2, err := OpenFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w2.SamplerChunk == nil {
+		t.Fatalf("Expected a sampler chunk and found none.")
+	}
+	if actual := w2.SamplerChunk.MIDIUnityNote; actual != 60 {
+		t.Errorf("Value %d for %q instead of %d", actual, "MIDIUnityNote", 60)
+	}
+	if len(w2.SamplerChunk.Loops) != 1 {
+		t.Fatalf("Expected %d loops instead of %d", 1, len(w2.SamplerChunk.Loops))
+	}
+	if actual, expected := w2.SamplerChunk.Loops[0], w.SamplerChunk.Loops[0]; actual != expected {
+		t.Errorf("Loop %+v instead of %+v", actual, expected)
+	}
+	if actual := string(w2.SamplerChunk.SamplerData); actual != string(w.SamplerChunk.SamplerData) {
+		t.Errorf("Sampler data %v instead of %v", actual, w.SamplerChunk.SamplerData)
+	}
+	if len(w2.Samples) != len(w.Samples) {
+		t.Errorf("Expected %d samples instead of %d", len(w.Samples), len(w2.Samples))
+	}
+}
+
+func TestMalformedSamplerChunk(t *testing.T) {
+	w := NewFile("")
+	w.Samples = []int16{0, 0}
+	w.SamplerChunk = &SamplerChunk{}
+	w.UpdateHeader()
+	b, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(b, []byte("smpl"))
+	if i < 0 {
+		t.Fatalf("Expected a sampler chunk and found none.")
+	}
+	for _, counts := range [][2]int32{{-1, 0}, {0, -1}, {1 << 30, 0}, {0, 1 << 30}} {
+		malformed := append([]byte(nil), b...)
+		binary.LittleEndian.PutUint32(malformed[i+8+28:], uint32(counts[0]))
+		binary.LittleEndian.PutUint32(malformed[i+8+32:], uint32(counts[1]))
+		if _, err := OpenBytes(malformed); err == nil {
+			t.Errorf("Expected an error for a sampler chunk of %d loops and %d bytes of data", counts[0], counts[1])
+		}
+	}
+}
+
+func TestBroadcastChunk(t *testing.T) {
+	fileName := filepath.Join(os.TempDir(), "broadcast.wav")
+	w := NewFile(fileName)
+	w.Samples = []int16{0, 0, 1, 1}
+	w.BroadcastChunk = &BroadcastChunk{
+		Description:     "Take 3",
+		Originator:      "aoeu",
+		OriginationDate: "2015-06-01",
+		OriginationTime: "12:30:00",
+		TimeReference:   44100 * 3600,
+		Version:         1,
+		CodingHistory:   "A=PCM,F=44100,W=16,M=stereo\r\n",
+	}
+	w.UpdateHeader()
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+	w2, err := OpenFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w2.BroadcastChunk == nil {
+		t.Fatalf("Expected a broadcast chunk and found none.")
+	}
+	if actual, expected := *w2.BroadcastChunk, *w.BroadcastChunk; actual != expected {
+		t.Errorf("Broadcast chunk %+v instead of %+v", actual, expected)
+	}
+	if len(w2.Samples) != len(w.Samples) {
+		t.Errorf("Expected %d samples instead of %d", len(w.Samples), len(w2.Samples))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fileName := filepath.Join(os.TempDir(), "valid.wav")
+	w := NewFile(fileName)
+	w.Samples = []int16{0, 0, 1, 1, 2, 2}
+	w.UpdateHeader()
+	if err := w.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+	valid, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	malformed := map[string]func([]byte) []byte{
+		"magic":          func(b []byte) []byte { b[0] = 'X'; return b },
+		"channels":       func(b []byte) []byte { b[22] = 0; return b },
+		"bits":           func(b []byte) []byte { b[34] = 0; return b },
+		"truncated data": func(b []byte) []byte { return b[:len(b)-2] },
+		"truncated head": func(b []byte) []byte { return b[:20] },
+		"block align":    func(b []byte) []byte { b[40] -= 2; b[4] -= 2; return b[:len(b)-2] },
+	}
+	for name, malform := range malformed {
+		b := malform(append([]byte{}, valid...))
+		fileName := filepath.Join(os.TempDir(), "malformed.wav")
+		if err := ioutil.WriteFile(fileName, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenFile(fileName); err == nil {
+			t.Errorf("Expected an error for a malformed file (%v) and got none.", name)
+		}
+	}
+	w.Samples = w.Samples[1:]
+	if err := w.Validate(); err == nil {
+		t.Errorf("Expected an error for samples not matching the data chunk.")
+	}
+	w.UpdateHeader()
+	if err := w.Validate(); err == nil {
+		t.Errorf("Expected an error for samples that are not a whole number of blocks.")
+	}
+}
+
+func TestNewFileDefaults(t *testing.T) {
+	w := NewFile(filepath.Join(os.TempDir(), "defaults.wav"))
+	if err := w.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	h := w.Header
+	if h.NumChannels != 2 || h.SampleRate != 44100 || h.BitsPerSample != 16 || h.ByteRate != 44100*4 {
+		t.Errorf("Expected 2 channels of 16 bits at 44100 Hz instead of %v channels of %v bits at %v Hz "+
+			"(%v bytes per second)", h.NumChannels, h.BitsPerSample, h.SampleRate, h.ByteRate)
+	}
+	for name, unplayable := range map[string]func(h *Header){
+		"no channels":    func(h *Header) { h.NumChannels = 0 },
+		"no sample rate": func(h *Header) { h.SampleRate = 0 },
+	} {
+		w := NewFile(filepath.Join(os.TempDir(), "unplayable.wav"))
+		w.Samples = []int16{0, 0}
+		unplayable(w.Header)
+		if err := w.UpdateHeader(); err == nil {
+			t.Errorf("Expected an error updating the header of a file with %v.", name)
+		}
+		if err := w.Write(); err == nil {
+			t.Errorf("Expected an error writing a file with %v.", name)
+		}
+	}
+}
+
+func TestExtensibleFormat(t *testing.T) {
+	fileName := filepath.Join(os.TempDir(), "extensible.wav")
+	w := NewFile(fileName)
+	w.Header.AudioFormatCode = -2 // FormatExtensible, as an int16.
+	w.Header.FormatChunkSize = 40
+	w.Header.BitsPerSample = 24
+	w.ExtensionChunk = &ExtensionChunk{
+		ExtensionChunkSize: 22,
+		ValidBitsPerSample: 24,
+		ChannelMask:        0x3, // Front left and front right.
+		SubFormatGUID:      SubFormatGUID(FormatPCM),
+	}
+	w.Samples = []int16{0, -1, 32767, -32768, 256, -256}
+	w.UpdateHeader()
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+	w2, err := OpenFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := w2.Format(); actual != FormatPCM {
+		t.Errorf("Value %d for %q instead of %d", actual, "format", FormatPCM)
+	}
+	if actual := *w2.ExtensionChunk; actual != *w.ExtensionChunk {
+		t.Errorf("Extension chunk %+v instead of %+v", actual, *w.ExtensionChunk)
+	}
+	if actual := w2.DataChunk.DataChunkSize; actual != int32(len(w.Samples)*3) {
+		t.Errorf("Value %d for %q instead of %d", actual, "DataChunkSize", len(w.Samples)*3)
+	}
+	for i, sample := range w2.Samples {
+		if sample != w.Samples[i] {
+			t.Errorf("Expected %d instead of %d at offset %d", w.Samples[i], sample, i)
+		}
+	}
+	w.ExtensionChunk.SubFormatGUID = [16]byte{1}
+	if err := w.Write(); err == nil {
+		t.Errorf("Expected an error for an unknown sub-format.")
+	}
+}
+
+func TestDecodeSamples(t *testing.T) {
+	float32Data := []byte{
+		0x00, 0x00, 0x00, 0x3F, // 0.5
+		0x00, 0x00, 0x80, 0xBF, // -1.0
+		0x00, 0x00, 0x00, 0x40, // 2.0
+	}
+	tests := []struct {
+		data     []byte
+		format   int
+		bits     int16
+		expected []int16
+	}{
+		{[]byte{0x80, 0xFF, 0x00}, FormatPCM, 8, []int16{0, 32512, -32768}},
+		{[]byte{0x34, 0x12, 0xFF, 0x80}, FormatPCM, 16, []int16{0x1234, -32513}},
+		{[]byte{0xAA, 0x34, 0x12, 0xAA, 0x00, 0x80}, FormatPCM, 24, []int16{0x1234, -32768}},
+		{[]byte{0xAA, 0xAA, 0x34, 0x12}, FormatPCM, 32, []int16{0x1234}},
+		{float32Data, FormatIEEEFloat, 32, []int16{16384, -32768, 32767}},
+	}
+	for _, test := range tests {
+		samples, err := decodeSamples(test.data, test.format, test.bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, sample := range samples {
+			if sample != test.expected[i] {
+				t.Errorf("Expected %d instead of %d at offset %d for %d-bit samples of format %d",
+					test.expected[i], sample, i, test.bits, test.format)
+			}
+		}
+		data, err := encodeSamples(test.expected, test.format, test.bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roundTrip, _ := decodeSamples(data, test.format, test.bits)
+		for i, sample := range roundTrip {
+			if sample != test.expected[i] {
+				t.Errorf("Expected %d instead of %d at offset %d after encoding %d-bit samples of format %d",
+					test.expected[i], sample, i, test.bits, test.format)
+			}
+		}
+	}
+	if _, err := decodeSamples(nil, FormatMuLAW, 8); err == nil {
+		t.Errorf("Expected an error for an unsupported format.")
+	}
+	for _, bits := range []int16{0, 12} {
+		if err := NewFile("").SetFormat(FormatPCM, bits); err == nil {
+			t.Errorf("Expected an error for %d-bit PCM samples.", bits)
+		}
+	}
+}
+
+func TestCuePoints(t *testing.T) {
+	fileName := filepath.Join(os.TempDir(), "cue_points.wav")
+	w := NewFile(fileName)
+	w.Samples = make([]int16, 200)
+	w.SamplerChunk = &SamplerChunk{MIDIUnityNote: 60}
+	w.CuePoints = []CuePoint{{10, "Verse"}, {50, ""}, {90, "Chorus!"}}
+	w.UpdateHeader()
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+	w2, err := OpenFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w2.CuePoints) != len(w.CuePoints) {
+		t.Fatalf("Expected %d cue points instead of %d", len(w.CuePoints), len(w2.CuePoints))
+	}
+	for i, c := range w.CuePoints {
+		if w2.CuePoints[i] != c {
+			t.Errorf("Cue point %+v instead of %+v", w2.CuePoints[i], c)
+		}
+	}
+	if w2.SamplerChunk == nil || len(w2.Samples) != len(w.Samples) {
+		t.Errorf("Expected chunks preceding the cue points to be read.")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	fileName := filepath.Join(os.TempDir(), "bytes.wav")
+	w := NewFile(fileName)
+	w.Samples = []int16{0, 0, 1, -1, 2, -2}
+	w.UpdateHeader()
+	b, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		t.Errorf("Expected a RIFF WAVE header instead of % X", b[:12])
+	}
+	if len(b) != int(w.Header.ChunkSize)+8 {
+		t.Errorf("Expected %d bytes instead of %d", w.Header.ChunkSize+8, len(b))
+	}
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != string(b) {
+		t.Errorf("Expected the bytes written to disk to match the bytes returned.")
+	}
+}
+
+func TestOddDataChunkPadding(t *testing.T) {
+	w := NewFile("")
+	w.Header.NumChannels = 1
+	if err := w.SetFormat(FormatPCM, 8); err != nil {
+		t.Fatal(err)
+	}
+	w.Samples = []int16{-32768, 0, 32512}
+	w.Chunks = []Chunk{{[4]byte{'I', 'D', '3', ' '}, []byte{1, 2, 3, 4}}}
+	w.UpdateHeader()
+	b, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != int(w.Header.ChunkSize)+8 {
+		t.Errorf("Expected %d bytes instead of %d", w.Header.ChunkSize+8, len(b))
+	}
+	w2, err := OpenBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, sample := range w.Samples {
+		if i >= len(w2.Samples) || w2.Samples[i] != sample {
+			t.Fatalf("Expected samples %v instead of %v", w.Samples, w2.Samples)
+		}
+	}
+	if len(w2.Chunks) != 1 || w2.Chunks[0].ID != w.Chunks[0].ID ||
+		string(w2.Chunks[0].Data) != string(w.Chunks[0].Data) {
+		t.Errorf("Expected chunks %q instead of %q", w.Chunks, w2.Chunks)
+	}
+}
+
+func TestUnusualFormatChunkSize(t *testing.T) {
+	w := NewFile("")
+	w.Samples = []int16{0, 0, 1, -1, 2, -2}
+	w.UpdateHeader()
+	b, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A 20 byte format chunk, with 4 bytes following the 16 that are understood.
+	b = append(b[:36:36], append([]byte{1, 2, 3, 4}, b[36:]...)...)
+	binary.LittleEndian.PutUint32(b[4:], uint32(w.Header.ChunkSize+4))
+	binary.LittleEndian.PutUint32(b[16:], 20)
+	w2, err := OpenBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w2.Header.FormatChunkSize != 16 {
+		t.Errorf("Expected a format chunk size of %d instead of %d", 16, w2.Header.FormatChunkSize)
+	}
+	for _, update := range []bool{false, true} {
+		if update {
+			w2.UpdateHeader()
+		}
+		b2, err := w2.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w3, err := OpenBytes(b2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b2) != int(w3.Header.ChunkSize)+8 {
+			t.Errorf("Expected %d bytes instead of %d", w3.Header.ChunkSize+8, len(b2))
+		}
+		for i, sample := range w.Samples {
+			if i >= len(w3.Samples) || w3.Samples[i] != sample {
+				t.Fatalf("Expected samples %v instead of %v", w.Samples, w3.Samples)
+			}
+		}
+	}
+}
+
+func TestOpenReader(t *testing.T) {
+	w := NewFile("")
+	w.Samples = []int16{0, 0, 1, -1, 2, -2}
+	w.CuePoints = []CuePoint{{1, "Start"}}
+	w.UpdateHeader()
+	b, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := OpenReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w2.Samples) != len(w.Samples) {
+		t.Fatalf("Expected %d samples instead of %d", len(w.Samples), len(w2.Samples))
+	}
+	for i, sample := range w.Samples {
+		if w2.Samples[i] != sample {
+			t.Errorf("Sample %d instead of %d at offset %d", w2.Samples[i], sample, i)
+		}
+	}
+	if len(w2.CuePoints) != 1 || w2.CuePoints[0] != w.CuePoints[0] {
+		t.Errorf("Cue points %+v instead of %+v", w2.CuePoints, w.CuePoints)
+	}
+	if _, err := OpenBytes(b[:20]); err == nil {
+		t.Errorf("Expected an error for truncated wave data.")
+	}
+}
+
+func TestTrailingChunks(t *testing.T) {
+	fileName := "testdata/trailing_chunks.wav"
+	w, err := OpenFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int16{0, 0, 100, -100, 200, -200, 300, -300}
+	if len(w.Samples) != len(expected) {
+		t.Fatalf("Expected %d samples instead of %d", len(expected), len(w.Samples))
+	}
+	for i, sample := range expected {
+		if w.Samples[i] != sample {
+			t.Errorf("Sample %d instead of %d at offset %d", w.Samples[i], sample, i)
+		}
+	}
+	if len(w.Chunks) != 2 {
+		t.Fatalf("Expected %d chunks following the data instead of %d", 2, len(w.Chunks))
+	}
+	if id, data := string(w.Chunks[0].ID[:]), string(w.Chunks[0].Data); id != "LIST" ||
+		data != "INFOINAM\x07\x00\x00\x00Take 1\x00\x00" {
+		t.Errorf("Chunk %q with data %q instead of a list of INFO", id, data)
+	}
+	if id, size := string(w.Chunks[1].ID[:]), len(w.Chunks[1].Data); id != "id3 " || size != 11 {
+		t.Errorf("Chunk %q of %d bytes instead of %q of %d bytes", id, size, "id3 ", 11)
+	}
+	w.UpdateHeader()
+	b, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if riffLen := len(b); riffLen > len(orig) || string(orig[:riffLen]) != string(b) {
+		t.Errorf("Expected the chunks to be written back unchanged, without what follows the RIFF chunk.")
+	}
+}
+
+func TestEncoderDecoder(t *testing.T) {
+	h := NewHeader()
+	h.BitsPerSample, h.BytesPerBlock = 24, 6
+	samples := make([]int16, 2*1001)
+	for i := range samples {
+		samples[i] = int16(i * 31)
+	}
+	encode := func(w io.Writer) {
+		e, err := NewEncoder(w, h, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for start := 0; start < len(samples); start += 100 {
+			end := start + 100
+			if end > len(samples) {
+				end = len(samples)
+			}
+			if err := e.Write(samples[start:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := e.Write(samples[:1]); err == nil {
+			t.Errorf("Expected an error for writing part of a block.")
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decode := func(r io.Reader) {
+		d, err := NewDecoder(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]int16, 33) // Reads 16 blocks at a time.
+		var decoded []int16
+		for {
+			n, err := d.Read(buf)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			decoded = append(decoded, buf[:n]...)
+		}
+		if len(decoded) != len(samples) {
+			t.Fatalf("Expected %d samples instead of %d", len(samples), len(decoded))
+		}
+		for i, sample := range samples {
+			if decoded[i] != sample {
+				t.Fatalf("Sample %d instead of %d at offset %d", decoded[i], sample, i)
+			}
+		}
+	}
+
+	fileName := filepath.Join(os.TempDir(), "encoder.wav")
+	f, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode(f)
+	f.Close()
+	w, err := OpenFile(fileName) // The lengths are filled in, as expected of a whole file.
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Samples) != len(samples) {
+		t.Errorf("Expected %d samples instead of %d", len(samples), len(w.Samples))
+	}
+	if f, err = os.Open(fileName); err != nil {
+		t.Fatal(err)
+	}
+	decode(f)
+	f.Close()
+
+	var b bytes.Buffer // Can't seek, so the lengths are unknown.
+	encode(&b)
+	decode(&b)
+}
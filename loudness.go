@@ -0,0 +1,152 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+// A second order IIR filter.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// Filters samples in place (as per the transposed direct form II).
+func (f biquad) filter(x []float64) {
+	var z1, z2 float64
+	for i, in := range x {
+		out := f.b0*in + z1
+		z1 = f.b1*in - f.a1*out + z2
+		z2 = f.b2*in - f.a2*out
+		x[i] = out
+	}
+}
+
+// Returns the two stages of the K-weighting filter of ITU-R BS.1770 for a sample rate:
+// a high shelf modeling the acoustic effects of the head, then a high pass.
+func kWeighting(sampleRate int) (shelf, highPass biquad) {
+	fs := float64(sampleRate)
+	k := math.Tan(math.Pi * 1681.974450955533 / fs)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	k = math.Tan(math.Pi * 38.13547087602444 / fs)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return
+}
+
+// Returns how much each channel of speakers contributes to loudness as per ITU-R BS.1770,
+// which excludes the LFE and weights surround channels more heavily.
+// Channels of unknown speakers (in a nil slice) are weighted equally.
+func loudnessWeights(speakers []ChannelLayout, numChannels int) []float64 {
+	weights := make([]float64, numChannels)
+	for i := range weights {
+		weights[i] = 1
+		switch {
+		case speakers == nil:
+		case speakers[i] == SpeakerLowFrequency:
+			weights[i] = 0
+		case speakers[i]&speakersSurrounding != 0:
+			weights[i] = 1.41
+		}
+	}
+	return weights
+}
+
+// Returns the integrated loudness of the clip in LUFS (loudness units relative
+// to full scale), as measured per ITU-R BS.1770 with K-weighting and gating.
+// Clips that are silent, shorter than the 400 ms gating block, without channels,
+// or without a sample rate (of at least 10 Hz) measure as negative infinity.
+func (c *Clip) LUFS() float64 {
+	const blockLen, step = 400, 100 // Gating blocks, in milliseconds, overlap by 75%.
+	if c.SampleRate <= 0 {
+		return math.Inf(-1)
+	}
+	blockSamples, stepSamples := c.SampleRate*blockLen/1000, c.SampleRate*step/1000
+	if stepSamples == 0 {
+		return math.Inf(-1) // Too low a sample rate for a sample per step.
+	}
+	numBlocks := 0
+	if n := c.maxLenPerChannel(); n >= blockSamples {
+		numBlocks = (n-blockSamples)/stepSamples + 1
+	}
+	if numBlocks == 0 {
+		return math.Inf(-1)
+	}
+	// The mean square of each block (of each channel) of K-weighted samples.
+	powers := make([][]float64, len(c.Samples))
+	c.forEachChannel(func(chanNum int) {
+		x := make([]float64, len(c.Samples[chanNum]))
+		for i, sample := range c.Samples[chanNum] {
+			x[i] = float64(sample) / -float64(MinInt16)
+		}
+		shelf, highPass := kWeighting(c.SampleRate)
+		shelf.filter(x)
+		highPass.filter(x)
+		powers[chanNum] = make([]float64, numBlocks)
+		for j := range powers[chanNum] {
+			start := j * stepSamples
+			var sum float64
+			for i := start; i < start+blockSamples && i < len(x); i++ {
+				sum += x[i] * x[i]
+			}
+			powers[chanNum][j] = sum / float64(blockSamples)
+		}
+	})
+	weights := loudnessWeights(c.speakers(), len(c.Samples))
+	blockLoudness := make([]float64, numBlocks)
+	for j := range blockLoudness {
+		var sum float64
+		for chanNum := range powers {
+			sum += weights[chanNum] * powers[chanNum][j]
+		}
+		blockLoudness[j] = -0.691 + 10*math.Log10(sum)
+	}
+	// Returns the loudness of the blocks louder than a gate.
+	gated := func(gate float64) float64 {
+		var sum float64
+		var n int
+		for j, l := range blockLoudness {
+			if l <= gate {
+				continue
+			}
+			n++
+			for chanNum := range powers {
+				sum += weights[chanNum] * powers[chanNum][j]
+			}
+		}
+		if n == 0 {
+			return math.Inf(-1)
+		}
+		return -0.691 + 10*math.Log10(sum/float64(n))
+	}
+	const absoluteGate, relativeGate = -70, -10
+	return gated(math.Max(absoluteGate, gated(absoluteGate)+relativeGate))
+}
+
+// Applies gain to the clip so its integrated loudness (as measured by LUFS)
+// is the target loudness, such as -14 LUFS for streaming services.
+// Samples exceeding the range of 16-bit audio clip, and a *ClippingError
+// is returned if any did.
+func (c *Clip) NormalizeLUFS(targetLUFS float64) error {
+	loudness := c.LUFS()
+	if math.IsInf(loudness, -1) {
+		return fmt.Errorf("Loudness of the clip can't be measured, as it is silent or too short.")
+	}
+	return c.Gain(targetLUFS - loudness)
+}
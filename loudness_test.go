@@ -0,0 +1,68 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestKWeighting(t *testing.T) {
+	// Coefficients at 48 kHz as published in ITU-R BS.1770.
+	shelf, highPass := kWeighting(48000)
+	expected := []biquad{
+		{1.53512485958697, -2.69169618940638, 1.19839281085285, -1.69065929318241, 0.73248077421585},
+		{1, -2, 1, -1.99004745483398, 0.99007225036621},
+	}
+	for i, actual := range []biquad{shelf, highPass} {
+		e := expected[i]
+		for j, pair := range [][2]float64{
+			{actual.b0, e.b0}, {actual.b1, e.b1}, {actual.b2, e.b2}, {actual.a1, e.a1}, {actual.a2, e.a2}} {
+			if math.Abs(pair[0]-pair[1]) > 1e-6 {
+				t.Errorf("Expected coefficient %d of stage %d to be %v instead of %v", j, i+1, pair[1], pair[0])
+			}
+		}
+	}
+}
+
+// Returns a stereo clip of a 1 kHz sine wave with a peak amplitude in the range [0, 1].
+func newSineClip(amplitude float64, sampleRate, lenPerChannel int) *Clip {
+	c := NewClip(2)
+	c.SampleRate = sampleRate
+	for chanNum := range c.Samples {
+		c.Samples[chanNum] = make([]int16, lenPerChannel)
+		for i := range c.Samples[chanNum] {
+			v := amplitude * math.Sin(2*math.Pi*1000*float64(i)/float64(sampleRate))
+			c.Samples[chanNum][i] = int16(v * float64(MaxInt16))
+		}
+	}
+	return c
+}
+
+func TestLUFS(t *testing.T) {
+	// A 1 kHz sine wave at -6 dBFS on both channels of a stereo clip measures -6 LUFS.
+	c := newSineClip(0.5, 48000, 48000*2)
+	if actual, expected := c.LUFS(), -6.02; math.Abs(actual-expected) > 0.1 {
+		t.Errorf("Expected %v LUFS instead of %v", expected, actual)
+	}
+	if err := c.NormalizeLUFS(-14); err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := c.LUFS(), -14.0; math.Abs(actual-expected) > 0.1 {
+		t.Errorf("Expected %v LUFS after normalizing instead of %v", expected, actual)
+	}
+	if actual := newSineClip(0.5, 48000, 100).LUFS(); !math.IsInf(actual, -1) {
+		t.Errorf("Expected a clip shorter than a gating block to measure %v instead of %v LUFS",
+			math.Inf(-1), actual)
+	}
+	noChannels := NewClip(0)
+	noChannels.SampleRate = 48000
+	lowRate := newSineClip(0.5, 5, 100)
+	for name, c := range map[string]*Clip{"without channels": noChannels, "at 5 Hz": lowRate} {
+		if actual := c.LUFS(); !math.IsInf(actual, -1) {
+			t.Errorf("Expected a clip %v to measure %v instead of %v LUFS", name, math.Inf(-1), actual)
+		}
+	}
+	silent := newSineClip(0, 44100, 44100)
+	if err := silent.NormalizeLUFS(-14); err == nil {
+		t.Errorf("Expected an error normalizing a silent clip.")
+	}
+}
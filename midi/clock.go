@@ -0,0 +1,230 @@
+package midi
+
+/*
+A Clock is a tempo source that other devices, like sequencers and external gear,
+can synchronize to. It sends TimingClock messages 24 times per quarter note
+while playing, along with Start, Stop, and Continue messages to control playback.
+*/
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The number of TimingClock messages sent per quarter note.
+const ClockResolution = 24
+
+// A Clock sends MIDI clock messages at an adjustable tempo.
+// Implements Device.
+type Clock struct {
+	processor
+	mu      sync.Mutex
+	bpm     float64
+	control chan RealTime
+}
+
+// Creates a new Clock with a tempo in quarter notes per minute,
+// or 120 BPM for a tempo that is not positive. The clock is stopped until started.
+func NewClock(bpm float64) *Clock {
+	if bpm <= 0 {
+		bpm = 120
+	}
+	return &Clock{
+		processor: newProcessor(),
+		bpm:       bpm,
+		control:   make(chan RealTime),
+	}
+}
+
+// Returns the tempo of the clock, in quarter notes per minute.
+func (c *Clock) Tempo() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bpm
+}
+
+// Changes the tempo of the clock, in quarter notes per minute, starting from the next tick.
+func (c *Clock) SetTempo(bpm float64) error {
+	if bpm <= 0 {
+		return fmt.Errorf("Tempo must be positive, not %v BPM.", bpm)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bpm = bpm
+	return nil
+}
+
+// Returns the duration between ticks at the current tempo.
+func (c *Clock) interval() time.Duration {
+	return time.Duration(float64(time.Minute) / (c.Tempo() * ClockResolution))
+}
+
+// Sends a Start message and begins ticking from the beginning.
+// Blocks until the clock is connected, and returns false if the clock is closed first.
+func (c *Clock) Start() bool {
+	return c.command(Start)
+}
+
+// Sends a Stop message and stops ticking.
+// Blocks until the clock is connected, and returns false if the clock is closed first.
+func (c *Clock) Stop() bool {
+	return c.command(Stop)
+}
+
+// Sends a Continue message and resumes ticking.
+// Blocks until the clock is connected, and returns false if the clock is closed first.
+func (c *Clock) Continue() bool {
+	return c.command(Continue)
+}
+
+func (c *Clock) command(r RealTime) bool {
+	select {
+	case c.control <- r:
+		return true
+	case <-c.done():
+		return false
+	}
+}
+
+// Begins sending MIDI clock messages until the clock is closed.
+// The first tick is sent immediately after starting or continuing,
+// and each tick is scheduled from the last so that ticks do not drift.
+func (c *Clock) Connect() {
+	done := c.done()
+	var tick <-chan time.Time
+	var next time.Time
+	for {
+		select {
+		case r := <-c.control:
+			if !send(c.Out, r, done) {
+				return
+			}
+			if r == Stop {
+				tick = nil
+				continue
+			}
+			next = time.Now()
+			tick = time.After(0)
+		case <-tick:
+			if !send(c.Out, TimingClock, done) {
+				return
+			}
+			next = next.Add(c.interval())
+			tick = time.After(next.Sub(time.Now()))
+		case <-done:
+			return
+		}
+	}
+}
+
+// The number of tick intervals averaged to estimate the tempo of a followed clock.
+const tempoWindow = ClockResolution
+
+// A ClockFollower follows the MIDI clock messages it receives, such as from a DAW,
+// tracking the tempo and position of playback. All MIDI data received is passed through.
+// Implements Device.
+type ClockFollower struct {
+	processor
+	mu        sync.Mutex
+	playing   bool
+	ticks     int             // Ticks since playback started, or -1 before the first.
+	last      time.Time       // When the last tick was received, or zero if not since a change in playback.
+	intervals []time.Duration // The most recent intervals between ticks, up to the tempo window.
+	now       func() time.Time
+}
+
+// Creates a new ClockFollower, which is stopped until it receives a Start or Continue message.
+func NewClockFollower() *ClockFollower {
+	return &ClockFollower{
+		processor: newProcessor(),
+		ticks:     -1,
+		now:       time.Now,
+	}
+}
+
+// Returns the tempo estimated from the intervals between recent ticks,
+// in quarter notes per minute, or 0 until at least two ticks are received.
+func (f *ClockFollower) Tempo() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.intervals) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range f.intervals {
+		total += d
+	}
+	if total <= 0 {
+		return 0
+	}
+	return float64(time.Minute) * float64(len(f.intervals)) / (float64(total) * ClockResolution)
+}
+
+// Returns the number of whole quarter notes played since playback started.
+func (f *ClockFollower) Beat() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.ticks < 0 {
+		return 0
+	}
+	return f.ticks / ClockResolution
+}
+
+// Returns how far playback is through the current quarter note, from 0 up to 1.
+func (f *ClockFollower) Phase() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.ticks < 0 {
+		return 0
+	}
+	return float64(f.ticks%ClockResolution) / ClockResolution
+}
+
+// Returns whether the followed clock is playing, between a Start or Continue and a Stop.
+func (f *ClockFollower) Playing() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.playing
+}
+
+// Updates the tempo and position of playback for a real-time message.
+func (f *ClockFollower) follow(r RealTime) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r {
+	case TimingClock:
+		now := f.now()
+		if !f.last.IsZero() {
+			f.intervals = append(f.intervals, now.Sub(f.last))
+			if len(f.intervals) > tempoWindow {
+				f.intervals = f.intervals[1:]
+			}
+		}
+		f.last = now
+		if f.playing {
+			f.ticks++
+		}
+	case Start:
+		f.playing, f.ticks = true, -1
+	case Continue:
+		f.playing = true
+	case Stop:
+		f.playing = false
+	}
+	if r != TimingClock {
+		// The interval to the next tick may include a pause, so it is not measured.
+		f.last = time.Time{}
+	}
+}
+
+// Begins following MIDI clock messages. Ticks received while stopped update the tempo
+// but not the position, which starts from the first tick after a Start.
+func (f *ClockFollower) Connect() {
+	f.process(func(m Message) []Message {
+		if r, ok := m.(RealTime); ok {
+			f.follow(r)
+		}
+		return []Message{m}
+	})
+}
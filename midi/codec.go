@@ -0,0 +1,173 @@
+package midi
+
+/*
+MIDI messages are sent "on the wire" as a status byte (the command and channel)
+followed by one or two data bytes. Consecutive messages with the same status
+may omit the status byte, which is known as "running status."
+*/
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Returns the number of data bytes that follow a status byte,
+// or -1 for status bytes of unsupported messages.
+func dataLen(status byte) int {
+	if status >= 0xF8 {
+		return 0 // Real-time messages are a lone status byte.
+	}
+	switch int(status) & 0xF0 {
+	case NOTE_OFF, NOTE_ON, CONTROL_CHANGE, PITCH_BEND:
+		return 2
+	case CHANNEL_PRESSURE:
+		return 1
+	}
+	return -1
+}
+
+// Encodes a message into bytes, as sent over the wire.
+func encode(m Message) []byte {
+	u := m.Uint32()
+	status := byte(u & 0xFF)
+	b := []byte{status, byte((u >> 8) & 0x7F), byte((u >> 16) & 0x7F)}
+	if n := dataLen(status); n >= 0 && n < 2 {
+		b = b[:1+n]
+	}
+	return b
+}
+
+func (n NoteOn) Encode() []byte {
+	return encode(n)
+}
+
+func (n NoteOff) Encode() []byte {
+	return encode(n)
+}
+
+func (c ControlChange) Encode() []byte {
+	return encode(c)
+}
+
+func (p PitchBend) Encode() []byte {
+	return encode(p)
+}
+
+func (c ChannelPressure) Encode() []byte {
+	return encode(c)
+}
+
+func (r RealTime) Encode() []byte {
+	return encode(r)
+}
+
+// Converts a message of unspecified type into a specific message.
+func (m message) decode() (Message, error) {
+	switch m.Command {
+	case NOTE_ON:
+		return NoteOn{m.Channel, m.Data1, m.Data2}, nil
+	case NOTE_OFF:
+		return NoteOff{m.Channel, m.Data1, m.Data2}, nil
+	case CONTROL_CHANGE:
+		name, ok := ControlChangeNames[m.Data1]
+		if !ok {
+			name = "Unknown"
+		}
+		return ControlChange{m.Channel, m.Data1, m.Data2, name}, nil
+	case CHANNEL_PRESSURE:
+		return ChannelPressure{m.Channel, m.Data1}, nil
+	case PITCH_BEND:
+		return PitchBend{m.Channel, (m.Data2<<7 | m.Data1) - 8192}, nil
+	case 0xF0:
+		switch r := RealTime(m.Command + m.Channel); r {
+		case TimingClock, Start, Continue, Stop:
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("Unsupported MIDI message type: %+v", m)
+}
+
+// Decodes a message from a status byte and the data bytes that follow it.
+func DecodeMessage(status byte, data []byte) (Message, error) {
+	if status&0x80 == 0 {
+		return nil, fmt.Errorf("Invalid MIDI status byte: %#x", status)
+	}
+	n := dataLen(status)
+	if n < 0 {
+		return nil, fmt.Errorf("Unsupported MIDI status byte: %#x", status)
+	}
+	if len(data) != n {
+		return nil, fmt.Errorf("MIDI status byte %#x requires %d data bytes, not %d",
+			status, n, len(data))
+	}
+	m := message{Channel: int(status & 0x0F), Command: int(status & 0xF0)}
+	for i, b := range data {
+		if b&0x80 != 0 {
+			return nil, errors.New("MIDI data bytes must be less than 128.")
+		}
+		if i == 0 {
+			m.Data1 = int(b)
+		} else {
+			m.Data2 = int(b)
+		}
+	}
+	return m.decode()
+}
+
+// A Decoder decodes messages from a stream of bytes, which may be split
+// across calls to Decode and may use running status.
+type Decoder struct {
+	status byte   // The running status, or 0 if none.
+	data   []byte // Data bytes received for the running status.
+}
+
+// Decodes the messages completed by the bytes, retaining incomplete messages
+// for subsequent calls. Bytes of unsupported messages are skipped.
+// Real-time messages are decoded wherever they occur, even between the data bytes of another message.
+func (d *Decoder) Decode(b []byte) ([]Message, error) {
+	var messages []Message
+	for _, c := range b {
+		switch {
+		case c >= 0xF8: // Real-time messages may interrupt others, and do not alter the status.
+			if m, err := DecodeMessage(c, nil); err == nil {
+				messages = append(messages, m)
+			}
+			continue
+		case c&0x80 != 0:
+			d.status = c
+			d.data = d.data[:0]
+			if dataLen(c) < 0 {
+				d.status = 0
+			}
+			continue
+		case d.status == 0: // Data bytes without a status, or of unsupported messages.
+			continue
+		}
+		d.data = append(d.data, c)
+		if len(d.data) < dataLen(d.status) {
+			continue
+		}
+		m, err := DecodeMessage(d.status, d.data)
+		d.data = d.data[:0]
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// Decodes a message from a PortMidi event, which packs the bytes of a message
+// into an integer and omits the status byte of messages using running status.
+func (d *Decoder) decodeEvent(e uint32) ([]Message, error) {
+	b := []byte{byte(e), byte(e >> 8), byte(e >> 16)}
+	status, skip := d.status, 0
+	if b[0]&0x80 != 0 {
+		status, skip = b[0], 1
+	}
+	n := dataLen(status)
+	if n < 0 {
+		n = 0
+	}
+	return d.Decode(b[:skip+n])
+}
@@ -5,7 +5,11 @@ package midi
 // #include <portmidi.h>
 import "C"
 
-//import "fmt"
+import (
+	"fmt"
+	"sync"
+	"time"
+)
 
 /*
 A Connector is made by associating 2 or more Devices.
@@ -19,20 +23,50 @@ Connector implementations:
 TODO: All of this could be replaced with the io package.
 */
 
+/*
+Connections between devices hold MIDI data in buffers, so that a device slow to receive
+(or a burst of notes) doesn't hold up the device sending to it, until the buffer fills.
+Larger buffers absorb longer bursts, at the cost of the latency of messages queued behind
+them when a device falls behind (and of more data to flush, as per Drain, before closing).
+An unbuffered connection (of a buffer size of 0) passes each message on as soon as it
+is received, but the sending device waits on the receiving device for every message.
+*/
+
+// The number of messages a Pipe holds for the device it transmits to, unless created
+// with NewPipeBuffered: enough for a chord or two without adding much latency.
+const DefaultBufferSize = 16
+
 // A Pipe transmits MIDI data from a device's MIDI output to another device's MIDI input.
 // Implements Connector, one to one.
 type Pipe struct {
 	From       *Device
 	To         *Device
-	disconnect chan bool
+	disconnect *disconnection
+	bufferSize int            // Messages received from From held while To has yet to receive them.
+	drain      chan chan bool // Requests to drain the pipe, closed once drained.
+	mu         sync.Mutex     // Guards forwarding, and is held while draining a pipe not yet forwarding.
+	forwarding bool
+	guard      sync.Locker // Guards To, if it is changed while connected (as by a Chain), or nil.
 }
 
-// Creates a new Pipe, opening the devices sent as parameters.
+// Creates a new Pipe, opening the devices sent as parameters,
+// with a buffer of DefaultBufferSize messages.
 func NewPipe(from, to *Device) *Pipe {
+	return NewPipeBuffered(from, to, DefaultBufferSize)
+}
+
+// Creates a new Pipe holding up to a number of messages received from one device
+// that the other has yet to receive, or none for a size of 0.
+func NewPipeBuffered(from, to *Device, bufferSize int) *Pipe {
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
 	return &Pipe{
 		From:       from,
 		To:         to,
-		disconnect: make(chan bool, 1),
+		disconnect: newDisconnection(),
+		bufferSize: bufferSize,
+		drain:      make(chan chan bool),
 	}
 }
 
@@ -43,34 +77,191 @@ func (p *Pipe) Open() error {
 	return p.To.Open()
 }
 
+// Returns the device the pipe transmits to at the moment.
+func (p *Pipe) destination() *Device {
+	if p.guard != nil {
+		p.guard.Lock()
+		defer p.guard.Unlock()
+	}
+	return p.To
+}
+
 // Ends transmission of MIDI data and closes the connected MIDI devices.
-func (p Pipe) Close() error {
-	p.disconnect <- true
+func (p *Pipe) Close() error {
+	p.disconnect.disconnect()
 	if err := p.From.Close(); err != nil {
 		return err
 	}
-	return p.To.Close()
+	return p.destination().Close()
 }
 
 // Begins transmission of MIDI data between the connected MIDI devices.
-func (p Pipe) Connect() {
+func (p *Pipe) Connect() {
 	go p.From.Connect()
-	go p.To.Connect()
+	go p.destination().Connect()
+	p.forward(p.destination)
+}
+
+// Forwards messages from the device the pipe transmits from to the device returned by to,
+// holding those the device has yet to receive, and drains the pipe when requested,
+// until disconnected.
+func (p *Pipe) forward(to func() *Device) {
+	p.mu.Lock()
+	p.forwarding = true
+	p.mu.Unlock()
+	done := p.disconnect.done()
+	from := p.From.Out
+	var held []Message // In order of receipt, including the message being sent.
+	for {
+		in := from
+		if len(held) > p.bufferSize {
+			in = nil
+		}
+		var out chan<- Message
+		var next Message
+		if len(held) > 0 {
+			out, next = to().In, held[0]
+		}
+		select {
+		case m, ok := <-in:
+			if !ok {
+				from = nil
+			} else {
+				held = append(held, m)
+			}
+		case out <- next:
+			held = held[1:]
+		case drained := <-p.drain:
+			p.flush(held, to, done)
+			held = nil
+			close(drained)
+		case <-done:
+			return
+		}
+	}
+}
+
+// Sends onward any messages held in the pipe's buffer or waiting to be received from the device
+// the pipe transmits from, then releases all notes on every channel of the device it transmits to,
+// so that no notes are left hanging once the pipe is closed. Call before Close.
+func (p *Pipe) Drain() {
+	done := p.disconnect.done()
+	p.mu.Lock()
+	if !p.forwarding {
+		defer p.mu.Unlock()
+		p.flush(nil, p.destination, done)
+		return
+	}
+	p.mu.Unlock()
+	// The forwarding loop drains the pipe, so that nothing it holds follows the release of notes.
+	drained := make(chan bool)
+	select {
+	case p.drain <- drained:
+	case <-done:
+		return
+	}
+	select {
+	case <-drained:
+	case <-done:
+	}
+}
+
+// Sends held messages, then any waiting to be received from the device the pipe transmits from,
+// then releases all notes, to the device returned by to, returning false if done first.
+func (p *Pipe) flush(held []Message, to func() *Device, done <-chan bool) bool {
+	for _, m := range held {
+		if !send(to().In, m, done) {
+			return false
+		}
+	}
+	for waiting := true; waiting; {
+		select {
+		case m, ok := <-p.From.Out:
+			if !ok {
+				waiting = false
+			} else if !send(to().In, m, done) {
+				return false
+			}
+		default:
+			waiting = false
+		}
+	}
+	for _, m := range allNotesOff() {
+		if !send(to().In, m, done) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns messages releasing the notes sounding on every channel (All Notes Off).
+func allNotesOff() []Message {
+	messages := make([]Message, 16)
+	for channel := range messages {
+		messages[channel] = ControlChange{channel, 123, 0, ControlChangeNames[123]}
+	}
+	return messages
+}
+
+// Returns messages silencing every channel, stopping all sound (All Sound Off)
+// and releasing all notes (All Notes Off), to recover from stuck notes.
+func panicMessages() []Message {
+	messages := make([]Message, 0, 32)
+	for channel := 0; channel < 16; channel++ {
+		messages = append(messages,
+			ControlChange{channel, 120, 0, ControlChangeNames[120]},
+			ControlChange{channel, 123, 0, ControlChangeNames[123]})
+	}
+	return messages
+}
+
+// How long Panic waits for each message to be received.
+const panicTimeout = time.Second
+
+// Sends messages silencing every channel to the In of a device, such as for a
+// "kill all notes" button during a performance. Blocks until all are received,
+// returning an error if any isn't received in time (as by a device not connected).
+func Panic(in chan<- Message) error {
+	for _, m := range panicMessages() {
+		select {
+		case in <- m:
+		case <-time.After(panicTimeout):
+			return fmt.Errorf("Message %q silencing the device was not received.", m)
+		}
+	}
+	return nil
+}
+
+// Forwards messages from one channel to another until done.
+func forward(from <-chan Message, to chan<- Message, done <-chan bool) {
 	for {
 		select {
-		case p.To.In <- <-p.From.Out:
-		case <-p.disconnect:
+		case m, ok := <-from:
+			if !ok || !send(to, m, done) {
+				return
+			}
+		case <-done:
 			return
 		}
 	}
 }
 
+// Sends a message on a channel, returning false if done before the message was sent.
+func send(to chan<- Message, m Message, done <-chan bool) bool {
+	select {
+	case to <- m:
+		return true
+	case <-done:
+		return false
+	}
+}
+
 // A Router transmits MIDI data from one MIDI device to many MIDI devices.
 // Implements Connector, one to many.
 type Router struct {
 	From       Device
 	To         []Device
-	disconnect chan bool
+	disconnect *disconnection
 }
 
 // Creates a new Router and opens MIDI devices sent as parameters.
@@ -78,7 +269,7 @@ func NewRouter(from Device, to ...Device) *Router {
 	return &Router{
 		From:       from,
 		To:         to,
-		disconnect: make(chan bool, 1),
+		disconnect: newDisconnection(),
 	}
 }
 
@@ -93,7 +284,7 @@ func (r *Router) Open() error {
 
 // Ends transmission of MIDI data and closes the connected MIDI devices.
 func (r *Router) Close() (err error) {
-	r.disconnect <- true
+	r.disconnect.disconnect()
 	err = r.From.Close()
 	if err != nil {
 		return
@@ -109,40 +300,145 @@ func (r *Router) Close() (err error) {
 
 // Begins transmission of MIDI data between the connected MIDI devices.
 func (r *Router) Connect() {
-	go r.From.Connect()
-	for _, to := range r.To {
-		go to.Connect()
+	route(r.From, r.To, r.disconnect.done(), func(Message) []Device { return r.To })
+}
+
+// Transmits MIDI data from one device to the destination devices chosen for each message,
+// until disconnected. Each message is sent to its destinations in turn before the next
+// is received, so every destination receives messages in the order they were sent.
+func route(from Device, to []Device, done <-chan bool, destinations func(Message) []Device) {
+	go from.Connect()
+	for _, d := range to {
+		go d.Connect()
 	}
 	for {
 		select {
-		case e, ok := <-r.From.Out:
+		case e, ok := <-from.Out:
 			if !ok {
 				return
 			}
-			go func() {
-				for _, to := range r.To {
-					to.In <- e
+			for _, to := range destinations(e) {
+				if !send(to.In, e, done) {
+					return
 				}
-			}()
-		case <-r.disconnect:
+			}
+		case <-done:
 			return
 		}
 	}
 }
 
+// A Rule matches MIDI data that should be transmitted to a MIDI device.
+type Rule struct {
+	Matches func(Message) bool // A nil Matches matches all messages.
+	To      Device
+}
+
+// Returns a function matching MIDI data sent on the specified channel.
+func MatchChannel(channel int) func(Message) bool {
+	return func(m Message) bool {
+		c, ok := getChannel(m)
+		return ok && c == channel
+	}
+}
+
+// Returns a function matching notes with keys within an inclusive range.
+func MatchKeys(low, high int) func(Message) bool {
+	return func(m Message) bool {
+		var key int
+		switch n := m.(type) {
+		case NoteOn:
+			key = n.Key
+		case NoteOff:
+			key = n.Key
+		default:
+			return false
+		}
+		return low <= key && key <= high
+	}
+}
+
+// A RuleRouter transmits MIDI data from one MIDI device to each MIDI device with a matching rule.
+// Implements Connector, one to many.
+type RuleRouter struct {
+	From       Device
+	Rules      []Rule
+	disconnect *disconnection
+}
+
+// Creates a new RuleRouter from a device and the rules for where to transmit its MIDI data.
+func NewRuleRouter(from Device, rules []Rule) *RuleRouter {
+	return &RuleRouter{
+		From:       from,
+		Rules:      rules,
+		disconnect: newDisconnection(),
+	}
+}
+
+// Returns each distinct device the rules transmit MIDI data to.
+func (r *RuleRouter) destinations() []Device {
+	seen := make(map[Device]bool)
+	to := make([]Device, 0, len(r.Rules))
+	for _, rule := range r.Rules {
+		if !seen[rule.To] {
+			seen[rule.To] = true
+			to = append(to, rule.To)
+		}
+	}
+	return to
+}
+
+func (r *RuleRouter) Open() error {
+	for _, to := range r.destinations() {
+		if err := to.Open(); err != nil {
+			return err
+		}
+	}
+	return r.From.Open()
+}
+
+// Ends transmission of MIDI data and closes the connected MIDI devices.
+func (r *RuleRouter) Close() (err error) {
+	r.disconnect.disconnect()
+	err = r.From.Close()
+	if err != nil {
+		return
+	}
+	for _, to := range r.destinations() {
+		err = to.Close()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Begins transmission of MIDI data between the connected MIDI devices.
+func (r *RuleRouter) Connect() {
+	route(r.From, r.destinations(), r.disconnect.done(), func(m Message) []Device {
+		to := make([]Device, 0, len(r.Rules))
+		for _, rule := range r.Rules {
+			if rule.Matches == nil || rule.Matches(m) {
+				to = append(to, rule.To)
+			}
+		}
+		return to
+	})
+}
+
 // A Funnel merges MIDI data from many MIDI devices and transmits the data to one MIDI device.
 // Implements Connector, many to one.
 type Funnel struct {
 	From       []*Device
 	To         *Device
-	disconnect chan bool
+	disconnect *disconnection
 }
 
 // Creates a new Funnel and open's the MIDI devices sent as parameters.
 func NewFunnel(to *Device, from ...*Device) *Funnel {
 	return &Funnel{From: from,
 		To:         to,
-		disconnect: make(chan bool, 1),
+		disconnect: newDisconnection(),
 	}
 }
 
@@ -157,7 +453,7 @@ func (f *Funnel) Open() error {
 
 // Ends transmission of MIDI data and closes the connected MIDI devices.
 func (f *Funnel) Close() error {
-	f.disconnect <- true
+	f.disconnect.disconnect()
 	for _, from := range f.From {
 		if err := from.Close(); err != nil {
 			return err
@@ -168,16 +464,25 @@ func (f *Funnel) Close() error {
 
 // Begins transmission of MIDI data between the associated MIDI devices.
 func (f *Funnel) Connect() {
+	f.connect(func(from *Device, m Message) Message { return m })
+}
+
+// Begins transmission of MIDI data between the associated MIDI devices,
+// altering each message transmitted with the specified function.
+func (f *Funnel) connect(alter func(from *Device, m Message) Message) {
 	go f.To.Connect()
 	for i := 0; i < len(f.From); i++ { // Perplexing bug: range doesn't work here.
 		from := f.From[i]
 		go from.Connect()
 		go func() {
+			done := f.disconnect.done()
 			for {
 				select {
-				case f.To.In <- <-from.Out:
-				case <-f.disconnect:
-					f.disconnect <- true // Send disconnect again for the next goroutine.
+				case m, ok := <-from.Out:
+					if !ok || !send(f.To.In, alter(from, m), done) {
+						return
+					}
+				case <-done:
 					return
 				}
 			}
@@ -185,24 +490,62 @@ func (f *Funnel) Connect() {
 	}
 }
 
+// A Merger merges MIDI data from many MIDI devices onto distinct channels of one MIDI device.
+// Implements Connector, many to one.
+type Merger struct {
+	Funnel
+	Channels map[*Device]int // The channel each device's MIDI data is merged onto.
+}
+
+// Creates a new Merger from MIDI devices and the channels to merge their data onto.
+func NewMerger(to *Device, channels map[*Device]int) *Merger {
+	from := make([]*Device, 0, len(channels))
+	for d := range channels {
+		from = append(from, d)
+	}
+	return &Merger{
+		Funnel:   *NewFunnel(to, from...),
+		Channels: channels,
+	}
+}
+
+// Begins transmission of MIDI data between the associated MIDI devices.
+func (m *Merger) Connect() {
+	m.connect(func(from *Device, msg Message) Message {
+		return setChannel(msg, m.Channels[from])
+	})
+}
+
 // A Chain connects a series of MIDI devices (like creating many, serially chained pipes).
+// Devices can be inserted into and removed from a connected Chain, such as to add
+// or remove an effect during a performance.
 // Implements Connector, serially chained pipes.
 type Chain struct {
-	Devices []*Device
-	pipes   []*Pipe
+	Devices   []*Device
+	pipes     []*Pipe
+	mu        sync.Mutex // Guards the devices and pipes, and the destinations of the pipes.
+	connected bool
 }
 
 // Creates a new Chain and open's the attached devices.
 func NewChain(devices ...*Device) *Chain {
-	numDevices := len(devices)
-	c := Chain{devices, make([]*Pipe, numDevices-1)}
-	for i := 1; i < numDevices; i++ {
-		c.pipes[i-1] = NewPipe(c.Devices[i-1], c.Devices[i])
+	c := &Chain{Devices: devices}
+	for i := 1; i < len(devices); i++ {
+		c.pipes = append(c.pipes, c.newPipe(c.Devices[i-1], c.Devices[i]))
 	}
-	return &c
+	return c
+}
+
+// Creates a new pipe of the chain, whose destination is guarded by the chain.
+func (c *Chain) newPipe(from, to *Device) *Pipe {
+	p := NewPipe(from, to)
+	p.guard = &c.mu
+	return p
 }
 
 func (c *Chain) Open() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	for _, p := range c.pipes {
 		if err := p.Open(); err != nil {
 			return err
@@ -211,10 +554,24 @@ func (c *Chain) Open() error {
 	return nil
 }
 
+// Returns the pipes of the chain at the moment.
+func (c *Chain) currentPipes() []*Pipe {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Pipe(nil), c.pipes...)
+}
+
+// Drains each pipe of the chain in order, as per Pipe.Drain. Call before Close.
+func (c *Chain) Drain() {
+	for _, p := range c.currentPipes() {
+		p.Drain()
+	}
+}
+
 // Ends transmission of MIDI data and closes the connected MIDI devices.
 func (c *Chain) Close() error {
 	var err error
-	for _, p := range c.pipes {
+	for _, p := range c.currentPipes() {
 		err = p.Close()
 	}
 	return err
@@ -222,7 +579,93 @@ func (c *Chain) Close() error {
 
 // Begins transmission of MIDI data between the connected MIDI devices.
 func (c *Chain) Connect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = true
+	for _, d := range c.Devices {
+		go d.Connect()
+	}
 	for _, p := range c.pipes {
-		go p.Connect()
+		go c.forward(p)
+	}
+}
+
+// Forwards messages through a pipe of the chain until the pipe is disconnected,
+// sending each to the current destination of the pipe, which changes as devices
+// are inserted or removed.
+func (c *Chain) forward(p *Pipe) {
+	p.forward(p.destination)
+}
+
+// Inserts a device into the chain before the device at an index (or after the last device
+// for the index of the number of devices), opening the device. If the chain is connected,
+// MIDI data flows through the device as soon as it is inserted.
+func (c *Chain) Insert(index int, d *Device) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if index < 0 || index > len(c.Devices) {
+		return fmt.Errorf("Cannot insert a device at index %d of a chain of %d devices.",
+			index, len(c.Devices))
+	}
+	if err := d.Open(); err != nil {
+		return err
+	}
+	var p *Pipe
+	switch {
+	case len(c.Devices) == 0:
+	case index == 0:
+		p = c.newPipe(d, c.Devices[0])
+		c.pipes = append([]*Pipe{p}, c.pipes...)
+	case index == len(c.Devices):
+		p = c.newPipe(c.Devices[index-1], d)
+		c.pipes = append(c.pipes, p)
+	default:
+		// The pipe into the device at the index now leads into the inserted device.
+		into := c.pipes[index-1]
+		p = c.newPipe(d, into.To)
+		into.To = d
+		c.pipes = append(c.pipes[:index], append([]*Pipe{p}, c.pipes[index:]...)...)
+	}
+	c.Devices = append(c.Devices[:index], append([]*Device{d}, c.Devices[index:]...)...)
+	if c.connected {
+		go d.Connect()
+		if p != nil {
+			go c.forward(p)
+		}
+	}
+	return nil
+}
+
+// Removes the device at an index from the chain, connecting the devices on either side of it,
+// and returns the device. The device is not closed, so it can be inserted elsewhere, but any
+// MIDI data it has yet to send onward when removed is dropped, and notes that it sent onward
+// may be left sounding (see Panic).
+func (c *Chain) Remove(index int) (*Device, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if index < 0 || index >= len(c.Devices) {
+		return nil, fmt.Errorf("Cannot remove the device at index %d of a chain of %d devices.",
+			index, len(c.Devices))
+	}
+	d := c.Devices[index]
+	var removed *Pipe
+	switch {
+	case len(c.Devices) == 1:
+	case index == 0:
+		removed = c.pipes[0]
+		c.pipes = c.pipes[1:]
+	case index == len(c.Devices)-1:
+		removed = c.pipes[index-1]
+		c.pipes = c.pipes[:index-1]
+	default:
+		// The pipe into the device now leads where the pipe out of the device did.
+		removed = c.pipes[index]
+		c.pipes[index-1].To = removed.To
+		c.pipes = append(c.pipes[:index], c.pipes[index+1:]...)
+	}
+	if removed != nil {
+		removed.disconnect.disconnect()
 	}
+	c.Devices = append(c.Devices[:index], c.Devices[index+1:]...)
+	return d, nil
 }
@@ -2,15 +2,18 @@
 package controller
 
 import (
-	"github.com/aoeu/audio/midi"
 	"fmt"
+	"github.com/aoeu/audio/midi"
 	"time"
 )
 
 func ExampleLaunchpad() {
 	devices, _ := midi.GetDevices()
-	launchpad := NewLaunchpad(devices["Launchpad"], map[int]int{})
-	launchpad.Open()
+	launchpad, err := FindLaunchpad(devices)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	launchpad.Reset()
 	time.Sleep(2 * time.Second)
@@ -41,6 +44,10 @@ func ExampleLaunchpad() {
 func ExamplLaunchpad2() {
 	devices, _ := midi.GetDevices()
 	nanopad := devices["nanoPAD2 PAD"]
+	nanopad.Open()
+	go nanopad.Connect()
+	aux := midi.NewDevice()
+	aux.Wires = &nanopad.Wires
 	// A nanopad does its own transposition.
 	launchpad := NewLaunchpad(devices["Launchpad"],
 		map[int]int{
@@ -60,12 +67,15 @@ func ExamplLaunchpad2() {
 			117: 46,
 			118: 48,
 			119: 50},
-		nanopad)
+		aux)
 	iac1 := devices["IAC Driver Bus 1"]
-	pipe, _ := midi.NewPipe(launchpad, iac1)
-	go pipe.Run()
-	c := make(chan bool, 1)
-	<-c
+	iac1.Open()
+	go iac1.Connect()
+	launchpad.Open()
+	go launchpad.Run()
+	for m := range launchpad.Out {
+		iac1.In <- m
+	}
 }
 
 func ExampleMonome() {
@@ -74,11 +84,33 @@ func ExampleMonome() {
 		fmt.Println("Error: ", err)
 	}
 	iac1 := devices["IAC Driver Bus 1"]
-	monome, err := NewMonome()
-	monome.Open()
+	iac1.Open()
+	go iac1.Connect()
+	monome := NewMonome()
+	if err := monome.Open(); err != nil {
+		fmt.Println("Error: ", err)
+		return
+	}
 	go monome.Connect()
-	pipe, _ := midi.NewPipe(monome, iac1)
-	go pipe.Run()
-	c := make(chan bool, 1)
-	<-c
+	for m := range monome.Out {
+		iac1.In <- m
+	}
+}
+
+func ExampleStepSequencer() {
+	devices, _ := midi.GetDevices()
+	launchpad := NewLaunchpad(devices["Launchpad"], map[int]int{})
+	launchpad.MomentaryButtons = false
+	launchpad.Open()
+	go launchpad.Run()
+	sequencer, err := NewStepSequencer(launchpad, 120)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	sequencer.Toggle(0, 0) // Bass drum on the downbeat.
+	go sequencer.Run()
+	for m := range sequencer.Out {
+		fmt.Println(m)
+	}
 }
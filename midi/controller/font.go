@@ -0,0 +1,78 @@
+package controller
+
+import "strings"
+
+// A font five lights tall, for rendering text onto grids of lights.
+// Each glyph is a row of lights from top to bottom, with '#' lit.
+var font = map[rune][]string{
+	'A':  {".#.", "#.#", "###", "#.#", "#.#"},
+	'B':  {"##.", "#.#", "##.", "#.#", "##."},
+	'C':  {".##", "#..", "#..", "#..", ".##"},
+	'D':  {"##.", "#.#", "#.#", "#.#", "##."},
+	'E':  {"###", "#..", "##.", "#..", "###"},
+	'F':  {"###", "#..", "##.", "#..", "#.."},
+	'G':  {".##", "#..", "#.#", "#.#", ".##"},
+	'H':  {"#.#", "#.#", "###", "#.#", "#.#"},
+	'I':  {"###", ".#.", ".#.", ".#.", "###"},
+	'J':  {"..#", "..#", "..#", "#.#", ".#."},
+	'K':  {"#.#", "#.#", "##.", "#.#", "#.#"},
+	'L':  {"#..", "#..", "#..", "#..", "###"},
+	'M':  {"#...#", "##.##", "#.#.#", "#...#", "#...#"},
+	'N':  {"#..#", "##.#", "#.##", "#..#", "#..#"},
+	'O':  {".#.", "#.#", "#.#", "#.#", ".#."},
+	'P':  {"##.", "#.#", "##.", "#..", "#.."},
+	'Q':  {".#..", "#.#.", "#.#.", "#.#.", ".#.#"},
+	'R':  {"##.", "#.#", "##.", "#.#", "#.#"},
+	'S':  {".##", "#..", ".#.", "..#", "##."},
+	'T':  {"###", ".#.", ".#.", ".#.", ".#."},
+	'U':  {"#.#", "#.#", "#.#", "#.#", "###"},
+	'V':  {"#.#", "#.#", "#.#", "#.#", ".#."},
+	'W':  {"#...#", "#...#", "#.#.#", "##.##", "#...#"},
+	'X':  {"#.#", "#.#", ".#.", "#.#", "#.#"},
+	'Y':  {"#.#", "#.#", ".#.", ".#.", ".#."},
+	'Z':  {"###", "..#", ".#.", "#..", "###"},
+	'0':  {"###", "#.#", "#.#", "#.#", "###"},
+	'1':  {".#.", "##.", ".#.", ".#.", "###"},
+	'2':  {"##.", "..#", ".#.", "#..", "###"},
+	'3':  {"##.", "..#", ".#.", "..#", "##."},
+	'4':  {"#.#", "#.#", "###", "..#", "..#"},
+	'5':  {"###", "#..", "##.", "..#", "##."},
+	'6':  {".##", "#..", "###", "#.#", "###"},
+	'7':  {"###", "..#", ".#.", ".#.", ".#."},
+	'8':  {"###", "#.#", "###", "#.#", "###"},
+	'9':  {"###", "#.#", "###", "..#", "##."},
+	' ':  {"..", "..", "..", "..", ".."},
+	'.':  {".", ".", ".", ".", "#"},
+	',':  {"..", "..", "..", ".#", "#."},
+	'!':  {"#", "#", "#", ".", "#"},
+	'?':  {"##.", "..#", ".#.", "...", ".#."},
+	'-':  {"...", "...", "###", "...", "..."},
+	'+':  {"...", ".#.", "###", ".#.", "..."},
+	':':  {".", "#", ".", "#", "."},
+	'\'': {"#", "#", ".", ".", "."},
+	'/':  {"..#", "..#", ".#.", "#..", "#.."},
+	'#':  {"#.#", "###", "#.#", "###", "#.#"},
+}
+
+// Renders text as columns of lights, each a row of lights from top to bottom,
+// with a column of unlit lights between characters. Lowercase letters are
+// rendered as uppercase, and characters missing from the font as '?'.
+func renderText(text string) (columns [][]bool) {
+	for i, r := range strings.ToUpper(text) {
+		glyph, ok := font[r]
+		if !ok {
+			glyph = font['?']
+		}
+		if i > 0 {
+			columns = append(columns, make([]bool, len(glyph)))
+		}
+		for x := 0; x < len(glyph[0]); x++ {
+			column := make([]bool, len(glyph))
+			for y, row := range glyph {
+				column[y] = row[x] == '#'
+			}
+			columns = append(columns, column)
+		}
+	}
+	return
+}
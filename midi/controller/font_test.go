@@ -0,0 +1,46 @@
+package controller
+
+import "testing"
+
+// Returns columns of lights as rows of '#' for lit and '.' for unlit, for comparison with the font.
+func rows(columns [][]bool) []string {
+	if len(columns) == 0 {
+		return nil
+	}
+	rows := make([]string, len(columns[0]))
+	for _, column := range columns {
+		for y, lit := range column {
+			if lit {
+				rows[y] += "#"
+			} else {
+				rows[y] += "."
+			}
+		}
+	}
+	return rows
+}
+
+func TestRenderText(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"", nil},
+		{"T", font['T']},
+		{"hi", []string{"#.#.###", "#.#..#.", "###..#.", "#.#..#.", "#.#.###"}},
+		{"~", font['?']},
+	}
+	for _, test := range tests {
+		actual := rows(renderText(test.text))
+		if len(actual) != len(test.expected) {
+			t.Errorf("Rendered %q as %q instead of %q", test.text, actual, test.expected)
+			continue
+		}
+		for y := range actual {
+			if actual[y] != test.expected[y] {
+				t.Errorf("Rendered %q as %q instead of %q", test.text, actual, test.expected)
+				break
+			}
+		}
+	}
+}
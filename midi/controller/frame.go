@@ -0,0 +1,38 @@
+package controller
+
+import "sync"
+
+// The colors of the grid as last drawn by DrawFrame.
+type frameBuffer struct {
+	sync.Mutex
+	colors [8][8]int
+	drawn  bool // Whether colors reflect the lights, as they do not until the first frame is drawn.
+}
+
+// Marks the lights as changed other than by drawing frames, so the next frame is drawn in entirety.
+func (f *frameBuffer) invalidate() {
+	if f == nil {
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.drawn = false
+}
+
+// The number of changed lights beyond which a frame is drawn with the LED update mode,
+// which sets all 64 lights of the grid in 32 MIDI events, rather than light by light.
+const rapidUpdateThreshold = 32
+
+// Returns the row and column of each light of a frame that differs from the last frame drawn
+// (every light, if none has been), and whether so many differ that the entire grid
+// is faster to redraw. The caller must hold the lock of the frame buffer.
+func (f *frameBuffer) changed(frame [8][8]int) (changed [][2]int, redraw bool) {
+	for row := range frame {
+		for column, color := range frame[row] {
+			if !f.drawn || f.colors[row][column] != color {
+				changed = append(changed, [2]int{row, column})
+			}
+		}
+	}
+	return changed, len(changed) > rapidUpdateThreshold
+}
@@ -0,0 +1,36 @@
+package controller
+
+import "testing"
+
+func TestFrameBufferChanged(t *testing.T) {
+	f := new(frameBuffer)
+	var frame [8][8]int
+	if changed, redraw := f.changed(frame); len(changed) != 64 || !redraw {
+		t.Errorf("Expected all 64 lights to be redrawn before any frame is drawn instead of %d (redraw %v)", len(changed), redraw)
+	}
+	f.colors, f.drawn = frame, true
+	frame[2][5], frame[7][0] = 1, 2
+	changed, redraw := f.changed(frame)
+	if redraw {
+		t.Errorf("Expected lights to be changed one by one instead of the grid redrawn.")
+	}
+	expected := [][2]int{{2, 5}, {7, 0}}
+	if len(changed) != len(expected) {
+		t.Fatalf("Expected %v to be changed instead of %v", expected, changed)
+	}
+	for i, light := range expected {
+		if changed[i] != light {
+			t.Errorf("Expected %v to be changed instead of %v", expected, changed)
+		}
+	}
+	for i := 0; i < rapidUpdateThreshold; i++ {
+		frame[i/8][i%8] = 3
+	}
+	if changed, redraw := f.changed(frame); len(changed) != rapidUpdateThreshold+1 || !redraw {
+		t.Errorf("Expected %d changed lights to redraw the grid instead of %d (redraw %v)", rapidUpdateThreshold+1, len(changed), redraw)
+	}
+	f.invalidate()
+	if changed, _ := f.changed(f.colors); len(changed) != 64 {
+		t.Errorf("Expected all 64 lights to be changed once invalidated instead of %d", len(changed))
+	}
+}
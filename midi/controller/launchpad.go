@@ -1,37 +1,129 @@
 package controller
 
-import "github.com/aoeu/audio/midi"
+import (
+	"fmt"
+	"github.com/aoeu/audio/midi"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
 
+// A Launchpad sends the notes of its buttons, as transposed, from the Out of its Wires,
+// and lights its buttons as per the messages sent to the In of its Wires.
 type Launchpad struct {
-	device           midi.Device
-	inPort           *midi.SystemPort
+	*midi.Wires
+	device           midi.SystemDevice
 	transposer       *midi.Transposer // For transposition of the launchpad buttons.
-	auxIns           midi.Funnel      // Auxilary input devices that mimic touching launchpad buttons.
+	auxIns           *midi.Funnel     // Auxilary input devices that mimic touching launchpad buttons.
 	stop             chan bool
 	lightStatus      map[int]bool
 	ButtonPressColor int
 	MomentaryButtons bool
+	handlers         *buttonHandlers
+	frame            *frameBuffer
+}
+
+// Functions called when buttons of the grid are pressed or released.
+type buttonHandlers struct {
+	sync.Mutex
+	press   func(x, y, velocity int)
+	release func(x, y, velocity int)
+}
+
+// Calls the press handler (if any) with the position of a button, without blocking.
+func (b *buttonHandlers) pressed(x, y, velocity int) {
+	b.Lock()
+	h := b.press
+	b.Unlock()
+	if h != nil {
+		go h(x, y, velocity)
+	}
 }
 
-func NewLaunchpad(d midi.SystemDevice, noteMap map[int]int, auxIns ...midi.Device) (
+// Calls the release handler (if any) with the position of a button, without blocking.
+func (b *buttonHandlers) released(x, y, velocity int) {
+	b.Lock()
+	h := b.release
+	b.Unlock()
+	if h != nil {
+		go h(x, y, velocity)
+	}
+}
+
+func NewLaunchpad(d midi.SystemDevice, noteMap map[int]int, auxIns ...*midi.Device) (
 	l Launchpad) {
-	if d.Name != "Launchpad" {
+	if !strings.Contains(d.Name, "Launchpad") {
 		return Launchpad{}
 	}
 	l = Launchpad{device: d}
-	l.inPort = d.InPort().(*midi.SystemPort)
 	l.transposer = midi.NewTransposer(noteMap, nil)
-	l.auxIns, _ = midi.NewFunnel(midi.NewThruDevice(), auxIns...)
+	l.Wires = &midi.Wires{In: d.In, Out: l.transposer.Out}
+	l.auxIns = midi.NewFunnel(midi.NewDevice(), auxIns...)
 	l.stop = make(chan bool, 1)
 	l.lightStatus = make(map[int]bool)
 	l.ButtonPressColor = Green
 	l.MomentaryButtons = true
+	l.handlers = new(buttonHandlers)
+	l.frame = new(frameBuffer)
 	return l
 }
 
+// Finds, opens, and returns the Launchpad among the system's devices: the device with the
+// specified name if one is given (to choose among many Launchpads), or else the only device
+// whose name contains "Launchpad", as operating systems may name it "Launchpad MK2 MIDI 1" or similar.
+func FindLaunchpad(devices midi.SystemDevices, name ...string) (l Launchpad, err error) {
+	var found []string
+	if len(name) > 0 {
+		if _, err = devices.Get(name[0]); err != nil {
+			return
+		}
+		found = name[:1]
+	} else {
+		for n := range devices {
+			if strings.Contains(n, "Launchpad") {
+				found = append(found, n)
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return l, fmt.Errorf("No Launchpad found among %d devices.", len(devices))
+	case 1:
+	default:
+		sort.Strings(found)
+		return l, fmt.Errorf("Found %d Launchpads (%v), specify one by name.",
+			len(found), strings.Join(found, ", "))
+	}
+	l = NewLaunchpad(devices[found[0]], map[int]int{})
+	err = l.Open()
+	return
+}
+
+// Sets a function to call whenever a button of the grid is pressed, with the
+// button's position (as per XY) and velocity. The function is called on its own
+// goroutine, so slow handlers do not delay reading MIDI data from the Launchpad.
+func (l Launchpad) OnPress(handler func(x, y int, velocity int)) {
+	l.handlers.Lock()
+	defer l.handlers.Unlock()
+	l.handlers.press = handler
+}
+
+// Sets a function to call whenever a button of the grid is released,
+// called as functions set with OnPress are.
+func (l Launchpad) OnRelease(handler func(x, y int, velocity int)) {
+	l.handlers.Lock()
+	defer l.handlers.Unlock()
+	l.handlers.release = handler
+}
+
+// Opens the Launchpad and connects the underlying device, so that its lights
+// can be set before it is run.
 func (l Launchpad) Open() (err error) {
-	err = l.device.Open()
-	// Don't open the inPort as it is opened by the underlying device.
+	if err = l.device.Open(); err != nil {
+		return
+	}
+	go l.device.Connect()
 	l.transposer.Open()
 	l.Reset()
 	return
@@ -51,42 +143,51 @@ func (l Launchpad) Close() (err error) {
 }
 
 func (l Launchpad) Run() {
-	go l.device.Run()
-	go l.transposer.Run()
-	go l.auxIns.Run()
+	go l.transposer.Connect()
+	go l.auxIns.Connect()
 	l.Reset()
 	for {
 		select {
-		// For the launchpad's buttons.
-		case note := <-l.device.OutPort().NoteOns():
-			l.transposer.InPort().NoteOns() <- note
-			l.LightOn(note.Key, l.ButtonPressColor)
-		case note := <-l.device.OutPort().NoteOffs():
-			l.transposer.InPort().NoteOffs() <- note
-			if l.MomentaryButtons {
-				l.LightOff(note.Key)
-			}
-		case cc := <-l.device.OutPort().ControlChanges():
-			l.transposer.InPort().ControlChanges() <- cc
-			if cc.ID < 108 {
-				if cc.Value == 0 {
-					l.AutomapLightOff(cc.ID)
+		// For the launchpad's buttons, which send notes without velocity when released.
+		case m := <-l.device.Out:
+			switch m := m.(type) {
+			case midi.NoteOn:
+				l.transposer.In <- m
+				if m.Velocity == 0 {
+					l.released(m.Key, m.Velocity)
+					continue
+				}
+				l.LightOn(m.Key, l.ButtonPressColor)
+				x, y := l.XY(m.Key)
+				l.handlers.pressed(x, y, m.Velocity)
+			case midi.NoteOff:
+				l.transposer.In <- m
+				l.released(m.Key, m.Velocity)
+			case midi.ControlChange:
+				l.transposer.In <- m
+				if m.ID < 108 {
+					if m.Value == 0 {
+						l.AutomapLightOff(m.ID)
+					} else {
+						l.AutomapLightOn(m.ID, Red)
+					}
 				} else {
-					l.AutomapLightOn(cc.ID, Red)
+					l.AllAutomapLightsOff()
+					l.AutomapLightOn(m.ID, Red)
 				}
-			} else {
-				l.AllAutomapLightsOff()
-				l.AutomapLightOn(cc.ID, Red)
 			}
 		// For auxilary input devices that mimic pushing launchpad's buttons.
-		case note := <-l.auxIns.To.OutPort().NoteOns():
-			l.transposer.OutPort().NoteOns() <- note // Hack to bypass transposition.
-			key := l.transposer.ReverseMap[note.Key]
-			l.LightOn(key, Green)
-		case note := <-l.auxIns.To.OutPort().NoteOffs():
-			l.transposer.OutPort().NoteOffs() <- note // Hack to bypass transposition.
-			key := l.transposer.ReverseMap[note.Key]
-			l.LightOff(key)
+		case m := <-l.auxIns.To.In:
+			switch m := m.(type) {
+			case midi.NoteOn:
+				l.transposer.Out <- m // Hack to bypass transposition.
+				key := l.transposer.ReverseMap[m.Key]
+				l.LightOn(key, Green)
+			case midi.NoteOff:
+				l.transposer.Out <- m // Hack to bypass transposition.
+				key := l.transposer.ReverseMap[m.Key]
+				l.LightOff(key)
+			}
 		case <-l.stop:
 			l.stop <- true // Push value back on for other go routines.
 			return
@@ -94,17 +195,23 @@ func (l Launchpad) Run() {
 	}
 }
 
-func (l Launchpad) InPort() midi.Port {
-	return l.inPort
+// Turns off the light of a released button (if buttons are momentary) and calls the release handler.
+func (l Launchpad) released(key, velocity int) {
+	if l.MomentaryButtons {
+		l.LightOff(key)
+	}
+	x, y := l.XY(key)
+	l.handlers.released(x, y, velocity)
 }
 
-func (l Launchpad) OutPort() midi.Port {
-	return l.transposer.OutPort()
+func (l *Launchpad) Reset() (err error) {
+	l.frame.invalidate()
+	return l.reset()
 }
 
-func (l *Launchpad) Reset() (err error) {
+func (l *Launchpad) reset() (err error) {
 	// Turns all lights off and clears all buffers.
-	l.inPort.WriteRawEvent(midi.Event{0, 176, 0, 0})
+	l.device.In <- midi.ControlChange{Channel: 0, ID: 0, Value: 0}
 	return
 }
 
@@ -132,37 +239,71 @@ All eighty LEDs may be set (2 at a time)  using only forty consecutive MIDI even
     Keep this in mind for other functions that manipulate the lights.
 */
 func (l Launchpad) AllLightsOn(color int) (err error) {
+	l.frame.invalidate()
 	//l.Reset() // This needs to be called to write colors consecutively. Why?
-	l.inPort.NoteOns() <- midi.Note{Channel: 2, Key: 64, Velocity: 127}
+	l.device.In <- midi.NoteOn{Channel: 2, Key: 64, Velocity: 127}
 	for i := 0; i < 40; i++ {
-		l.inPort.ControlChanges() <- midi.ControlChange{Channel: 2, ID: color, Value: color}
+		l.device.In <- midi.ControlChange{Channel: 2, ID: color, Value: color}
 		if err != nil {
 			return
 		}
 	}
-	l.inPort.NoteOffs() <- midi.Note{Channel: 2, Key: 64, Velocity: 0}
+	l.device.In <- midi.NoteOff{Channel: 2, Key: 64, Velocity: 0}
 	return
 }
 
 func (l *Launchpad) AllGridLightsOn(color int) (err error) {
-	l.Reset()
+	l.frame.invalidate()
+	return l.rapidUpdateGrid(func(row, column int) int { return color })
+}
+
+// Sets the colors of all lights of the grid using the LED update mode (in two lights per
+// MIDI event), which resets all lights and turns off those beside the grid.
+func (l *Launchpad) rapidUpdateGrid(color func(row, column int) int) (err error) {
+	l.reset()
 	// BUG: The Launchpad spec says the next message should be channel 3.
 	// Channel 3 doesn't work, but 4 and up do...
-	l.inPort.WriteRawEvent(midi.Event{3, midi.NOTE_ON, 0, 0})
-	for i := 0; i < 32; i++ {
-		l.inPort.WriteRawEvent(midi.Event{2, midi.NOTE_ON, color, color})
+	l.device.In <- midi.NoteOn{Channel: 3, Key: 0, Velocity: 0}
+	for i := 0; i < 64; i += 2 {
+		first, second := color(i/8, i%8), color((i+1)/8, (i+1)%8)
+		l.device.In <- midi.NoteOn{Channel: 2, Key: first, Velocity: second}
 		if err != nil {
 			return
 		}
 	}
 	// Do not turn on the side buttons. (i.e. "Automap" and "Scene Select" buttons.)
 	for i := 0; i < 8; i++ {
-		l.inPort.WriteRawEvent(midi.Event{2, midi.NOTE_ON, Black, Black})
+		l.device.In <- midi.NoteOn{Channel: 2, Key: Black, Velocity: Black}
 		if err != nil {
 			return
 		}
 	}
-	l.inPort.WriteRawEvent(midi.Event{2, midi.NOTE_OFF, 0, 0})
+	l.device.In <- midi.NoteOff{Channel: 2, Key: 0, Velocity: 0}
+	return
+}
+
+// Sets the colors of all lights of the grid at once, from a frame of colors by row and column.
+// Only the lights that differ from the last frame drawn are changed, to minimize MIDI data sent,
+// unless so many differ that the entire grid is faster to redraw (which turns off the lights
+// beside the grid). Lights changed other than by drawing frames are not accounted for,
+// unless Reset, after which the next frame is drawn in entirety.
+func (l *Launchpad) DrawFrame(frame [8][8]int) (err error) {
+	l.frame.Lock()
+	defer l.frame.Unlock()
+	changed, redraw := l.frame.changed(frame)
+	if redraw {
+		err = l.rapidUpdateGrid(func(row, column int) int { return frame[row][column] })
+	} else {
+		for _, light := range changed {
+			row, column := light[0], light[1]
+			if err = l.LightOn(l.KeyNum(row, column), frame[row][column]); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		l.frame.colors, l.frame.drawn = frame, true
+	}
 	return
 }
 
@@ -177,12 +318,12 @@ func (l Launchpad) XY(keyNum int) (X, Y int) {
 }
 
 func (l Launchpad) LightOn(keyNum, color int) (err error) {
-	l.inPort.NoteOns() <- midi.Note{Channel: 0, Key: keyNum, Velocity: color}
+	l.device.In <- midi.NoteOn{Channel: 0, Key: keyNum, Velocity: color}
 	return
 }
 
 func (l Launchpad) LightOff(keyNum int) (err error) {
-	l.inPort.NoteOffs() <- midi.Note{Channel: 0, Key: keyNum, Velocity: 0}
+	l.device.In <- midi.NoteOff{Channel: 0, Key: keyNum, Velocity: 0}
 	return
 }
 
@@ -223,12 +364,12 @@ func (l Launchpad) ColumnOff(X int) error {
 }
 
 func (l Launchpad) AutomapLightOn(keyNum, color int) (err error) {
-	l.inPort.ControlChanges() <- midi.ControlChange{Channel: 0, ID: keyNum, Value: color}
+	l.device.In <- midi.ControlChange{Channel: 0, ID: keyNum, Value: color}
 	return
 }
 
 func (l Launchpad) AutomapLightOff(keyNum int) (err error) {
-	l.inPort.ControlChanges() <- midi.ControlChange{Channel: 0, ID: keyNum, Value: Black}
+	l.device.In <- midi.ControlChange{Channel: 0, ID: keyNum, Value: Black}
 	return
 }
 
@@ -250,7 +391,7 @@ func (l Launchpad) AutomapLightOnXOR(keyNum, color int) (err error) {
 
 func (l Launchpad) LightOnXY(row, column, color int) (err error) {
 	buttonNum := (16 * row) + column
-	l.inPort.NoteOns() <- midi.Note{Channel: 0, Key: buttonNum, Velocity: color}
+	l.device.In <- midi.NoteOn{Channel: 0, Key: buttonNum, Velocity: color}
 	if err != nil {
 		return
 	}
@@ -259,7 +400,7 @@ func (l Launchpad) LightOnXY(row, column, color int) (err error) {
 
 func (l *Launchpad) LightOffXY(row, column int) (err error) {
 	buttonNum := (16 * row) + column
-	l.inPort.NoteOffs() <- midi.Note{Channel: 0, Key: buttonNum, Velocity: 0}
+	l.device.In <- midi.NoteOff{Channel: 0, Key: buttonNum, Velocity: 0}
 	if err != nil {
 		return
 	}
@@ -294,11 +435,97 @@ func (l Launchpad) ToggleLightXY(row, column, color int) (err error) {
 }
 
 func (l Launchpad) DrumMode() (err error) {
-	l.inPort.ControlChanges() <- midi.ControlChange{Channel: 0, ID: 0, Value: 2}
+	l.device.In <- midi.ControlChange{Channel: 0, ID: 0, Value: 2}
 	return
 }
 
 func (l Launchpad) XYMode() (err error) {
-	l.inPort.ControlChanges() <- midi.ControlChange{Channel: 0, ID: 0, Value: 1}
+	l.device.In <- midi.ControlChange{Channel: 0, ID: 0, Value: 1}
+	return
+}
+
+/*
+The brightness of the LEDs is set by the duty cycle they are multiplexed at, a fraction
+of 1/18 to 16/18 (with a numerator of 1 to 16 and denominator of 3 to 18) defaulting to 1/5.
+Control Change 30 on the first channel sets fractions with numerators of 1 through 8, and
+Control Change 31 those of 9 through 16, with a value of 16 * (numerator - 1 or 9) + (denominator - 3).
+*/
+
+// The brightest level of the LEDs.
+const MaxBrightness = 15
+
+// Sets the brightness of all LEDs, from 0 (dimmest) to MaxBrightness (brightest),
+// such as to dim the lights on a dark stage.
+func (l *Launchpad) SetBrightness(level int) (err error) {
+	id, value, err := dutyCycle(level)
+	if err != nil {
+		return
+	}
+	l.device.In <- midi.ControlChange{Channel: 0, ID: id, Value: value}
+	return
+}
+
+// Returns the ID and value of the Control Change setting the duty cycle of the LEDs
+// for a brightness level, the fraction (level + 1) / 18.
+func dutyCycle(level int) (id, value int, err error) {
+	if level < 0 || level > MaxBrightness {
+		return 0, 0, fmt.Errorf("Brightness %v is not between 0 and %v.", level, MaxBrightness)
+	}
+	const denominator = 18
+	numerator, id := level+1, 30
+	if numerator > 8 {
+		numerator, id = numerator-8, 31
+	}
+	return id, 16*(numerator-1) + (denominator - 3), nil
+}
+
+/*
+Newer Launchpads scroll text natively via SysEx messages: the Launchpad S and
+Mini (F0h 00h 20h 29h 09h <color> <text> F7h) and the Launchpad MK2 and Pro.
+The original Launchpad has no such message, so text is rendered onto its grid
+instead, which works on every model.
+*/
+
+// Scrolls text from right to left across the grid of buttons, lighting them
+// the specified color, at a speed in columns of lights per second.
+// Returns once the text has scrolled off of the grid, or when the Launchpad is closed.
+func (l Launchpad) ScrollText(text string, color int, speed int) (err error) {
+	if speed <= 0 {
+		return fmt.Errorf("Scrolling speed %v is not positive.", speed)
+	}
+	const gridSize, top = 8, 1 // The five lit rows of text are vertically centered.
+	columns := renderText(text)
+	lit := make(map[int]bool)
+	tick := time.NewTicker(time.Second / time.Duration(speed))
+	defer tick.Stop()
+	// Scroll in from the right edge until the last column leaves the left edge.
+	for offset := -gridSize; offset <= len(columns); offset++ {
+		for x := 0; x < gridSize; x++ {
+			var column []bool
+			if i := offset + x; i >= 0 && i < len(columns) {
+				column = columns[i]
+			}
+			for y := 0; y < gridSize; y++ {
+				on := y >= top && y-top < len(column) && column[y-top]
+				if key := l.KeyNum(y, x); on != lit[key] {
+					if on {
+						err = l.LightOn(key, color)
+					} else {
+						err = l.LightOff(key)
+					}
+					if err != nil {
+						return
+					}
+					lit[key] = on
+				}
+			}
+		}
+		select {
+		case <-tick.C:
+		case <-l.stop:
+			l.stop <- true // Push value back on for other go routines.
+			return
+		}
+	}
 	return
 }
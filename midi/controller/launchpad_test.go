@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"github.com/aoeu/audio/midi"
+	"testing"
+)
+
+// Creates a Launchpad without a system MIDI stream, returning it with the channel
+// of messages sent to light it, which holds up to a number of messages not yet received.
+func newTestLaunchpad(bufferSize int) (Launchpad, chan midi.Message) {
+	wires := midi.NewWiresBuffered(bufferSize)
+	return NewLaunchpad(midi.SystemDevice{Name: "Launchpad", Wires: *wires}, map[int]int{}), wires.In
+}
+
+// Returns the messages sent to light a Launchpad but not yet received, without waiting.
+func received(lights chan midi.Message) (messages []midi.Message) {
+	for {
+		select {
+		case m := <-lights:
+			messages = append(messages, m)
+		default:
+			return
+		}
+	}
+}
+
+func TestScrollText(t *testing.T) {
+	l, lights := newTestLaunchpad(1024)
+	if err := l.ScrollText("I", Green, 0); err == nil {
+		t.Errorf("Expected an error for a scrolling speed of 0.")
+	}
+	if err := l.ScrollText("I", Green, 1000); err != nil {
+		t.Fatal(err)
+	}
+	lit, everLit := make(map[int]bool), make(map[int]bool)
+	for _, m := range received(lights) {
+		switch m := m.(type) {
+		case midi.NoteOn:
+			if x, y := l.XY(m.Key); x < 1 || x > 5 || y > 7 || m.Velocity != Green {
+				t.Errorf("Expected the rows 1 to 5 of the grid lit %d instead of %v", Green, m)
+			}
+			lit[m.Key], everLit[m.Key] = true, true
+		case midi.NoteOff:
+			delete(lit, m.Key)
+		default:
+			t.Errorf("Expected only notes lighting the grid instead of %v", m)
+		}
+	}
+	// Each row of the glyph has a lit column, which scrolls across every column of the grid.
+	if expected := 5 * 8; len(everLit) != expected {
+		t.Errorf("Expected %d lights lit while scrolling instead of %d", expected, len(everLit))
+	}
+	if len(lit) != 0 {
+		t.Errorf("Expected no lights left lit once scrolled off instead of %d", len(lit))
+	}
+	if err := l.ScrollText("", Green, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if messages := received(lights); len(messages) != 0 {
+		t.Errorf("Expected no lights lit scrolling no text instead of %v", messages)
+	}
+}
+
+// Returns the messages setting the lights of the grid in the LED update mode,
+// two lights per message, as colored by row and column.
+func rapidUpdateMessages(color func(row, column int) int) []midi.Message {
+	messages := []midi.Message{
+		midi.ControlChange{Channel: 0, ID: 0, Value: 0},
+		midi.NoteOn{Channel: 3, Key: 0, Velocity: 0},
+	}
+	for i := 0; i < 64; i += 2 {
+		messages = append(messages, midi.NoteOn{Channel: 2, Key: color(i/8, i%8), Velocity: color(i/8, i%8+1)})
+	}
+	for i := 0; i < 8; i++ {
+		messages = append(messages, midi.NoteOn{Channel: 2, Key: Black, Velocity: Black})
+	}
+	return append(messages, midi.NoteOff{Channel: 2, Key: 0, Velocity: 0})
+}
+
+// Reports an error unless messages are those expected.
+func expectMessages(t *testing.T, actual, expected []midi.Message) {
+	if len(actual) != len(expected) {
+		t.Errorf("Expected %d messages instead of %d: %v", len(expected), len(actual), actual)
+		return
+	}
+	for i, m := range expected {
+		if actual[i] != m {
+			t.Errorf("Expected %v instead of %v at offset %d", m, actual[i], i)
+		}
+	}
+}
+
+func TestAllGridLightsOn(t *testing.T) {
+	l, lights := newTestLaunchpad(1024)
+	if err := l.AllGridLightsOn(Amber); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, received(lights), rapidUpdateMessages(func(row, column int) int { return Amber }))
+}
+
+func TestDrawFrame(t *testing.T) {
+	l, lights := newTestLaunchpad(1024)
+	var frame [8][8]int
+	for row := range frame {
+		for column := range frame[row] {
+			frame[row][column] = row*8 + column
+		}
+	}
+	if err := l.DrawFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, received(lights), rapidUpdateMessages(func(row, column int) int { return frame[row][column] }))
+	frame[0][3], frame[6][7] = Red, Green
+	if err := l.DrawFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, received(lights), []midi.Message{
+		midi.NoteOn{Channel: 0, Key: l.KeyNum(0, 3), Velocity: Red},
+		midi.NoteOn{Channel: 0, Key: l.KeyNum(6, 7), Velocity: Green},
+	})
+	if err := l.DrawFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, received(lights), nil)
+	l.Reset()
+	received(lights)
+	if err := l.DrawFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, received(lights), rapidUpdateMessages(func(row, column int) int { return frame[row][column] }))
+}
+
+func TestDutyCycle(t *testing.T) {
+	tests := []struct {
+		level, id, value int
+	}{
+		{0, 30, 15},              // 1/18
+		{4, 30, 79},              // 5/18
+		{7, 30, 127},             // 8/18
+		{8, 31, 15},              // 9/18
+		{MaxBrightness, 31, 127}, // 16/18
+	}
+	for _, test := range tests {
+		id, value, err := dutyCycle(test.level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != test.id || value != test.value {
+			t.Errorf("Expected Control Change %d of value %d for brightness %d instead of %d of value %d",
+				test.id, test.value, test.level, id, value)
+		}
+	}
+	for _, level := range []int{-1, MaxBrightness + 1} {
+		if _, _, err := dutyCycle(level); err == nil {
+			t.Errorf("Expected an error for brightness %d", level)
+		}
+	}
+}
+
+func TestSetBrightness(t *testing.T) {
+	l, lights := newTestLaunchpad(1)
+	if err := l.SetBrightness(MaxBrightness + 1); err == nil {
+		t.Errorf("Expected an error for brightness %d", MaxBrightness+1)
+	}
+	if err := l.SetBrightness(8); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, received(lights), []midi.Message{midi.ControlChange{Channel: 0, ID: 31, Value: 15}})
+}
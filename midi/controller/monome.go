@@ -1,13 +1,12 @@
 package controller
 
 import (
-	"fmt"
 	"github.com/aoeu/audio/midi"
-	"github.com/tarm/goserial"
+	"github.com/tarm/serial"
 	"io"
+	"sync"
 )
 
-// TODO(aoeu): Update to github.com/tarm/serial
 // TODO(aoeu): Assert this code even potentially works against hardware.
 
 const (
@@ -16,78 +15,85 @@ const (
 	baudRate   = 115200
 )
 
-// Implements Device
+// Implements Device, sending the notes of the monome's buttons from Out.
 type Monome struct {
 	// TODO(aoeu): Figure out how to write to the monome and implement an input port.
-	out *Port
-}
-
-func NewMonome() *Monome {
-	return &Monome{
-		out: NewPort(),
-	}
-}
-
-type Port struct {
-	midi.Port
+	*midi.Device
 	devicePath string
 	serialPort io.ReadWriteCloser
 	serialData chan []byte
+	disconnect chan bool // Closed when the monome is closed.
+	closeOnce  *sync.Once
 }
 
-func NewPort() *Port {
-	return &Port{
-		midi.Port:  midi.NewPort(false),
+func NewMonome() *Monome {
+	return &Monome{
+		Device:     midi.NewDevice(),
 		devicePath: "/dev/tty.usbserial-m64-0851", // TODO(aoeu): Don't hardcode the device.
 		serialData: make(chan []byte),
+		disconnect: make(chan bool),
+		closeOnce:  new(sync.Once),
 	}
 }
 
-func (p *Port) Open() error {
-	p.isOpen = true
-	c := &serial.Config{Name: p.devicePath, Baud: baudRate}
+func (m *Monome) Open() error {
+	if err := m.Device.Open(); err != nil {
+		return err
+	}
+	c := &serial.Config{Name: m.devicePath, Baud: baudRate}
 	var err error
-	p.serialPort, err = serial.OpenPort(c)
+	m.serialPort, err = serial.OpenPort(c)
 	return err
 }
 
-func (p *Port) Close() error {
-	p.serialPort.Close()
-	p.midi.Port.Close()
+func (m *Monome) Close() error {
+	m.closeOnce.Do(func() { close(m.disconnect) })
+	if m.serialPort != nil {
+		m.serialPort.Close()
+	}
+	return m.Device.Close()
 }
 
-func (p *Port) Connect() {
-	go p.readFromSerialPort()
+func (m *Monome) Connect() {
+	go m.readFromSerialPort()
 	for {
 		select {
-		case <-p.disconnect:
-			// TODO(aoeu): Is this needed? p.disconnect <- true
+		case <-m.disconnect:
 			return
-		case msg := <-p.serialData:
+		case msg := <-m.serialData:
 			msgType := msg[0]
 			buttonNum := int(msg[1])
+			var note midi.Message
 			switch msgType {
 			case 0: // Note On
-				p.messages <- midi.NoteOn{Channel: 0, Key: buttonNum, Velocity: 127}
+				note = midi.NoteOn{Channel: 0, Key: buttonNum, Velocity: 127}
 			case 16: // Note Off
-				p.messages <- midi.NoteOff{Channel: 0, Key: buttonNum}
+				note = midi.NoteOff{Channel: 0, Key: buttonNum}
+			default:
+				continue
+			}
+			select {
+			case m.Out <- note:
+			case <-m.disconnect:
+				return
 			}
 		}
 	}
 }
 
-func (p *Port) readFromSerialPort() {
+func (m *Monome) readFromSerialPort() {
 	buffer := make([]byte, 128)
 	for {
-		select {
-		case <-p.disconnect:
-			p.disconnect <- true
-			return
-		default:
-			n, _ := p.serialPort.Read(buffer)
-			for i := 0; i < n; i += 2 {
-				p.serialData <- []byte{buffer[i], buffer[i+1]}
+		n, err := m.serialPort.Read(buffer)
+		for i := 0; i+1 < n; i += 2 {
+			select {
+			case m.serialData <- []byte{buffer[i], buffer[i+1]}:
+			case <-m.disconnect:
+				return
 			}
 		}
+		if err != nil {
+			return // The serial port was closed.
+		}
 	}
 }
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/aoeu/audio/midi"
+	"sync"
+	"time"
+)
+
+// A Grid is a controller with a matrix of buttons that light up, such as a Launchpad.
+type Grid interface {
+	KeyNum(row, column int) int
+	LightOn(keyNum, color int) error
+	LightOff(keyNum int) error
+	OnPress(handler func(x, y int, velocity int))
+}
+
+const (
+	numSteps  = 8
+	numTracks = 8
+)
+
+// A StepSequencer uses the 8x8 buttons of a grid as 8 tracks (rows) of 8 steps
+// (columns), playing a note for each track at each step that is toggled on,
+// and sending the notes out of its device, such as into a Chain.
+type StepSequencer struct {
+	*midi.Device
+	Grid          Grid
+	Keys          [numTracks]int // The key of the notes played by each track.
+	Channel       int
+	Velocity      int
+	StepColor     int // Color of steps toggled on.
+	PlayheadColor int // Color of the steps being played.
+	mu            *sync.Mutex
+	steps         [numTracks][numSteps]bool
+	bpm           float64
+	stop          chan bool // Closed when the sequencer is stopped.
+	stopOnce      *sync.Once
+}
+
+// Creates a new StepSequencer playing sixteenth notes at the specified tempo,
+// with tracks playing the drum keys of General MIDI from bass drum upward.
+// Returns an error for a tempo that is not positive.
+func NewStepSequencer(g Grid, bpm float64) (*StepSequencer, error) {
+	if bpm <= 0 {
+		return nil, fmt.Errorf("Tempo must be positive, not %v BPM.", bpm)
+	}
+	s := &StepSequencer{
+		Device:        midi.NewDevice(),
+		Grid:          g,
+		Keys:          [numTracks]int{36, 38, 42, 46, 41, 45, 49, 51},
+		Channel:       9, // General MIDI percussion.
+		Velocity:      100,
+		StepColor:     RedLow,
+		PlayheadColor: Green,
+		mu:            new(sync.Mutex),
+		bpm:           bpm,
+		stop:          make(chan bool),
+		stopOnce:      new(sync.Once),
+	}
+	g.OnPress(func(row, column, velocity int) {
+		if row < numTracks && column < numSteps {
+			s.Toggle(row, column)
+		}
+	})
+	return s, nil
+}
+
+// Sets the tempo in quarter notes per minute, taking effect at the next step.
+// Returns an error for a tempo that is not positive.
+func (s *StepSequencer) SetTempo(bpm float64) error {
+	if bpm <= 0 {
+		return fmt.Errorf("Tempo must be positive, not %v BPM.", bpm)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bpm = bpm
+	return nil
+}
+
+// Toggles whether a track plays a note at a step, lighting the step if on.
+func (s *StepSequencer) Toggle(track, step int) {
+	s.mu.Lock()
+	s.steps[track][step] = !s.steps[track][step]
+	on := s.steps[track][step]
+	s.mu.Unlock()
+	s.light(track, step, on)
+}
+
+// Lights a step as toggled on, or turns its light off.
+func (s *StepSequencer) light(track, step int, on bool) {
+	if on {
+		s.Grid.LightOn(s.Grid.KeyNum(track, step), s.StepColor)
+	} else {
+		s.Grid.LightOff(s.Grid.KeyNum(track, step))
+	}
+}
+
+// Plays the steps in a loop, one sixteenth note apart, until stopped.
+// Each note is released at the next step.
+func (s *StepSequencer) Run() {
+	var sounding []midi.NoteOn
+	for step := 0; ; step = (step + 1) % numSteps {
+		s.mu.Lock()
+		interval := time.Duration(float64(time.Minute) / s.bpm / 4)
+		playing := s.steps
+		s.mu.Unlock()
+		for _, n := range sounding {
+			s.Out <- midi.NoteOff{Channel: n.Channel, Key: n.Key}
+		}
+		sounding = sounding[:0]
+		for track := 0; track < numTracks; track++ {
+			s.Grid.LightOn(s.Grid.KeyNum(track, step), s.PlayheadColor)
+			if playing[track][step] {
+				n := midi.NoteOn{Channel: s.Channel, Key: s.Keys[track], Velocity: s.Velocity}
+				s.Out <- n
+				sounding = append(sounding, n)
+			}
+		}
+		select {
+		case <-time.After(interval):
+		case <-s.stop:
+			for _, n := range sounding {
+				s.Out <- midi.NoteOff{Channel: n.Channel, Key: n.Key}
+			}
+			return
+		}
+		for track := 0; track < numTracks; track++ {
+			s.light(track, step, playing[track][step])
+		}
+	}
+}
+
+// Stops the StepSequencer, releasing any notes being played if it is running.
+// A stopped StepSequencer does not run again, and stopping it again does nothing.
+func (s *StepSequencer) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
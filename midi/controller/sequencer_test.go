@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"github.com/aoeu/audio/midi"
+	"testing"
+	"time"
+)
+
+// A grid ignoring lights and presses, for testing without a controller.
+type nullGrid struct{}
+
+func (nullGrid) KeyNum(row, column int) int                   { return 16*row + column }
+func (nullGrid) LightOn(keyNum, color int) error              { return nil }
+func (nullGrid) LightOff(keyNum int) error                    { return nil }
+func (nullGrid) OnPress(handler func(x, y int, velocity int)) {}
+
+func TestStepSequencerTempo(t *testing.T) {
+	for _, bpm := range []float64{0, -120} {
+		if _, err := NewStepSequencer(nullGrid{}, bpm); err == nil {
+			t.Errorf("Expected an error creating a step sequencer at %v BPM.", bpm)
+		}
+	}
+	s, err := NewStepSequencer(nullGrid{}, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTempo(0); err == nil {
+		t.Errorf("Expected an error setting a tempo of 0 BPM.")
+	}
+	if err := s.SetTempo(90); err != nil || s.bpm != 90 {
+		t.Errorf("Expected a tempo of 90 BPM instead of %v (%v)", s.bpm, err)
+	}
+}
+
+func TestStepSequencerStop(t *testing.T) {
+	s, err := NewStepSequencer(nullGrid{}, 6000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Toggle(0, 0)
+	ran := make(chan bool)
+	go func() {
+		s.Run()
+		close(ran)
+	}()
+	receive := func() midi.Message {
+		select {
+		case m := <-s.Out:
+			return m
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a message from the step sequencer.")
+			return nil
+		}
+	}
+	if m, ok := receive().(midi.NoteOn); !ok || m.Key != s.Keys[0] {
+		t.Errorf("Expected the first track's note instead of %v", m)
+	}
+	stopped := make(chan bool)
+	go func() {
+		s.Stop()
+		s.Stop()
+		close(stopped)
+	}()
+	for running := true; running; {
+		select {
+		case <-s.Out: // Releases of the notes played.
+		case <-ran:
+			running = false
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the step sequencer to stop running.")
+		}
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("Expected stopping a stopped step sequencer not to block.")
+	}
+}
@@ -12,7 +12,14 @@ On Device implementations:
         the MIDI data coming through it.
 */
 
-import "github.com/aoeu/audio/midi/portmidi"
+import (
+	"fmt"
+	"github.com/aoeu/audio/midi/portmidi"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Wires struct {
 	In  chan Message // MIDI Messages inbound to the device are received from the In channel.
@@ -20,9 +27,15 @@ type Wires struct {
 }
 
 func NewWires() *Wires {
+	return NewWiresBuffered(0)
+}
+
+// Creates new Wires whose channels each hold up to a number of messages
+// not yet received, as per NewPipeBuffered.
+func NewWiresBuffered(bufferSize int) *Wires {
 	return &Wires{
-		In:  make(chan Message),
-		Out: make(chan Message),
+		In:  make(chan Message, bufferSize),
+		Out: make(chan Message, bufferSize),
 	}
 }
 
@@ -33,10 +46,16 @@ type Device struct {
 }
 
 func NewDevice() *Device {
+	return NewDeviceBuffered(0)
+}
+
+// Creates a new Device whose In and Out each hold up to a number of messages
+// not yet received, so that a burst of messages doesn't wait on a slow receiver.
+func NewDeviceBuffered(bufferSize int) *Device {
 	return &Device{
 		in:    NewPort(false),
 		out:   NewPort(false),
-		Wires: NewWires(),
+		Wires: NewWiresBuffered(bufferSize),
 	}
 }
 
@@ -55,10 +74,10 @@ func (d *Device) Close() (err error) {
 }
 
 func (s Device) Connect() {
-	if s.in.isOpen {
+	if s.in.opened() {
 		go s.in.Connect()
 	}
-	if s.out.isOpen {
+	if s.out.opened() {
 		go s.out.Connect()
 	}
 }
@@ -67,29 +86,39 @@ func (s Device) Connect() {
 type ThruDevice struct {
 	in         *Port
 	out        *Port
-	disconnect chan bool
+	disconnect *disconnection
 	*Wires
 }
 
 // Creates a new thru device.
 func NewThruDevice() *ThruDevice {
 	return &ThruDevice{
-		in:         &Port{},
-		out:        &Port{},
-		disconnect: make(chan bool, 1),
+		in:         NewPort(false),
+		out:        NewPort(false),
+		disconnect: newDisconnection(),
 		Wires:      NewWires(),
 	}
 }
 
+func (t *ThruDevice) Open() error {
+	if err := t.in.Open(); err != nil {
+		return err
+	}
+	return t.out.Open()
+}
+
+// Stops routing data through the thru device.
+func (t *ThruDevice) Close() error {
+	t.disconnect.disconnect()
+	if err := t.in.Close(); err != nil {
+		return err
+	}
+	return t.out.Close()
+}
+
 // Routes data through the thru device.
 func (t ThruDevice) Connect() {
-	for {
-		select {
-		case t.Out <- <-t.In:
-		case <-t.disconnect:
-			return
-		}
-	}
+	forward(t.In, t.Out, t.disconnect.done())
 }
 
 // Represents a software or hardware MIDI device on the system.
@@ -102,31 +131,73 @@ type SystemDevice struct { // Implements Device
 
 func (s SystemDevice) Open() error {
 	// TODO(aoeu): Ramify with Device.Open()
-	err := s.in.Open()
-	if err != nil {
-		return err
+	if s.in != nil {
+		if err := s.in.Open(); err != nil {
+			return err
+		}
 	}
-	return s.out.Open()
+	if s.out != nil {
+		return s.out.Open()
+	}
+	return nil
 }
 
+// Silences every channel of the device, as per Panic, writing directly to the
+// system's MIDI stream (between any messages being written by the connected device).
+// Devices without an open input port are left as they are.
+func (s SystemDevice) Panic() error {
+	if s.in == nil || !s.in.opened() {
+		return nil
+	}
+	for _, m := range panicMessages() {
+		if err := s.in.write(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Silences every channel of the device (so no notes are left sounding) and closes it.
 func (s SystemDevice) Close() error {
-	err := s.in.SystemPort.Close()
-	if err != nil {
+	if err := s.Panic(); err != nil {
 		return err
 	}
-	err = s.out.SystemPort.Close()
-	return err
+	if s.in != nil {
+		if err := s.in.SystemPort.Close(); err != nil {
+			return err
+		}
+	}
+	if s.out != nil {
+		return s.out.SystemPort.Close()
+	}
+	return nil
 }
 
 func (s SystemDevice) Connect() {
-	if s.in.isOpen {
+	if s.in != nil && s.in.opened() {
 		go s.in.Connect()
 	}
-	if s.out.isOpen {
+	if s.out != nil && s.out.opened() {
 		go s.out.Connect()
 	}
 }
 
+// Associates a system MIDI stream with the device's corresponding port.
+func (d *SystemDevice) addStream(id int, streamInfo *portmidi.StreamInfo) {
+	sp := SystemPort{
+		Port: NewPort(streamInfo.IsOpen),
+		id:   id,
+	}
+	switch {
+	case streamInfo.IsOutput: // An output stream is for an input port.
+		d.in = &SystemInPort{SystemPort: sp, Output: portmidi.NewOutput(id)}
+		d.Wires.In = d.in.messages
+	case streamInfo.IsInput: // An input stream is for an output port.
+		d.out = &SystemOutPort{SystemPort: sp, Input: portmidi.NewInput(id)}
+		d.Wires.Out = d.out.messages
+	}
+}
+
 func getSystemDevices() SystemDevices {
 	devices := make(map[string]SystemDevice)
 	for i := 0; i < portmidi.NumStreams(); i++ {
@@ -136,33 +207,74 @@ func getSystemDevices() SystemDevices {
 				Name: streamInfo.Name,
 			}
 		}
-		sp := SystemPort{
-			Port: *NewPort(streamInfo.IsOpen),
-		}
 		d := devices[streamInfo.Name]
-		switch {
-		case streamInfo.IsOutput: // An output stream is for an input port.
-			d.in = &SystemInPort{SystemPort: sp, Output: portmidi.NewOutput(i)}
-			d.Wires.In = d.in.messages
-		case streamInfo.IsInput: // An input stream is for an output port.
-			d.out = &SystemOutPort{SystemPort: sp, Input: portmidi.NewInput(i)}
-			d.Wires.Out = d.out.messages
-		}
+		d.addStream(i, streamInfo)
 		devices[streamInfo.Name] = d
 	}
 	return devices
 }
 
+// Creates a software MIDI device on the system, visible to other applications,
+// without requiring a bus (such as an IAC Driver Bus) to be created beforehand.
+// GetDevices must be called first, and the device remains until Shutdown.
+// Supported on OS X (CoreMIDI) and Linux (ALSA) with PortMidi 2.0 or newer.
+// Windows has no virtual MIDI devices, so an error is returned there.
+func NewVirtualDevice(name string) (SystemDevice, error) {
+	d := SystemDevice{Name: name}
+	inID, err := portmidi.CreateVirtualInput(name)
+	if err != nil {
+		return d, err
+	}
+	outID, err := portmidi.CreateVirtualOutput(name)
+	if err != nil {
+		portmidi.DeleteVirtual(inID)
+		return d, err
+	}
+	d.addStream(inID, portmidi.NewStreamInfo(inID))
+	d.addStream(outID, portmidi.NewStreamInfo(outID))
+	return d, nil
+}
+
 type SystemDevices map[string]SystemDevice
 
-// This function will cause terrible errors if called. Do not use it.
+// Returns the device with the specified name, or an error listing the names
+// of the devices present if there is no such device.
+func (s SystemDevices) Get(name string) (SystemDevice, error) {
+	if d, ok := s[name]; ok {
+		return d, nil
+	}
+	names := make([]string, 0, len(s))
+	for n := range s {
+		names = append(names, n)
+	}
+	return SystemDevice{}, deviceNotFound(name, names)
+}
+
+// Returns an error for a device name not found among the names of the devices present,
+// which are listed in order.
+func deviceNotFound(name string, names []string) error {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = strconv.Quote(n)
+	}
+	sort.Strings(quoted)
+	return fmt.Errorf("Device not found: %q (available: %v)",
+		name, strings.Join(quoted, ", "))
+}
+
+// Closes all devices and terminates the system's MIDI streams.
+// It is safe to call while devices are transmitting MIDI data.
 func (s *SystemDevices) Shutdown() error {
 	var err error
 	m := map[string]SystemDevice(*s)
 	for _, device := range m {
-		err = device.Close()
+		if e := device.Close(); e != nil {
+			err = e
+		}
+	}
+	if e := portmidi.Terminate(); e != nil {
+		err = e
 	}
-	err = portmidi.Terminate()
 	return err
 }
 
@@ -170,6 +282,152 @@ func GetDevices() (SystemDevices, error) {
 	return getSystemDevices(), portmidi.Initialize()
 }
 
+// Re-enumerates the system's MIDI devices, adding newly appeared devices
+// and removing devices that disappeared. Devices that remain keep their ports,
+// so copies of them (and their Wires) stay valid.
+// PortMidi only enumerates devices when initialized, so refreshing re-initializes
+// PortMidi, and returns an error instead if any devices are open.
+func (s SystemDevices) Refresh() error {
+	if err := s.checkClosed("refresh"); err != nil {
+		return err
+	}
+	if err := portmidi.Terminate(); err != nil {
+		return err
+	}
+	if err := portmidi.Initialize(); err != nil {
+		return err
+	}
+	current := getSystemDevices()
+	for name := range s {
+		if _, ok := current[name]; !ok {
+			delete(s, name)
+		}
+	}
+	for name, c := range current {
+		d, ok := s[name]
+		if !ok {
+			s[name] = c
+			continue
+		}
+		// Device IDs may change, so existing ports are updated in place.
+		switch {
+		case c.in == nil:
+		case d.in == nil:
+			d.in = c.in
+			d.Wires.In = c.Wires.In
+		default:
+			d.in.id, d.in.Output = c.in.id, c.in.Output
+		}
+		switch {
+		case c.out == nil:
+		case d.out == nil:
+			d.out = c.out
+			d.Wires.Out = c.Wires.Out
+		default:
+			d.out.id, d.out.Input = c.out.id, c.out.Input
+		}
+		s[name] = d
+	}
+	return nil
+}
+
+// Returns an error naming the open devices, if any, which must be closed
+// before re-initializing PortMidi for an action such as refreshing.
+func (s SystemDevices) checkClosed(action string) error {
+	var open []string
+	for name, d := range s {
+		if (d.in != nil && d.in.opened()) || (d.out != nil && d.out.opened()) {
+			open = append(open, strconv.Quote(name))
+		}
+	}
+	if len(open) > 0 {
+		sort.Strings(open)
+		return fmt.Errorf("Devices must be closed to %v: %v", action, strings.Join(open, ", "))
+	}
+	return nil
+}
+
+// A DeviceEvent reports a MIDI device being added to or removed from the system,
+// or an error polling for devices, in which case only Err is set.
+type DeviceEvent struct {
+	Name  string
+	Added bool // False if the device was removed.
+	Err   error
+}
+
+// Watches for MIDI devices being added to or removed from the system,
+// polling at the specified interval until a value is sent on the stop channel,
+// at which point the returned channel of events is closed.
+// PortMidi only enumerates devices when initialized, so every poll
+// re-initializes PortMidi. Polls while any devices are open are skipped,
+// reporting an error event instead, as are polls PortMidi fails to re-initialize for;
+// close the devices and rebuild routing from the reported events.
+func (s SystemDevices) Watch(interval time.Duration, stop chan bool) <-chan DeviceEvent {
+	events := make(chan DeviceEvent)
+	present := make(map[string]bool, len(s))
+	for name := range s {
+		present[name] = true
+	}
+	go func() {
+		defer close(events)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+			err := s.checkClosed("watch")
+			if err == nil {
+				if err = portmidi.Terminate(); err == nil {
+					err = portmidi.Initialize()
+				}
+			}
+			if err != nil {
+				select {
+				case events <- DeviceEvent{Err: err}:
+				case <-stop:
+					return
+				}
+				continue
+			}
+			current := make(map[string]bool)
+			for name := range getSystemDevices() {
+				current[name] = true
+			}
+			for _, e := range diffDevices(present, current) {
+				select {
+				case events <- e:
+				case <-stop:
+					return
+				}
+			}
+			present = current
+		}
+	}()
+	return events
+}
+
+// Returns events for the device names added to or removed from a set of names.
+func diffDevices(before, after map[string]bool) (events []DeviceEvent) {
+	for name := range after {
+		if !before[name] {
+			events = append(events, DeviceEvent{Name: name, Added: true})
+		}
+	}
+	for name := range before {
+		if !after[name] {
+			events = append(events, DeviceEvent{Name: name, Added: false})
+		}
+	}
+	return
+}
+
+// Identifies a note by its channel and key.
+type noteID struct {
+	channel int
+	key     int
+}
+
 // Implements Device
 type Transposer struct {
 	NoteMap map[int]int // TODO(aoeu): NoteMap isn't generalized enough of a name.
@@ -178,35 +436,23 @@ type Transposer struct {
 	*Wires
 	Transpose  Transposition // TODO(aoeu): What's a better name for a function?
 	ReverseMap map[int]int
+	*bypass
 }
 
+// A Transposition forwards messages from a Transposer's In to its Out.
+// Passing a custom Transposition to NewTransposer overrides the default,
+// which maps keys as per the NoteMap and forwards all other data untouched
+// (or forwards all data untouched while the Transposer is bypassed).
 type Transposition func(Transposer)
 
+// Creates a new Transposer that maps the keys of notes as per a note map.
+// A nil transposeFunc uses the default Transposition.
 func NewTransposer(noteMap map[int]int, transposeFunc Transposition) (t *Transposer) {
-	t = &Transposer{NoteMap: noteMap, Wires: NewWires()}
-	t.in = &Port{}
-	t.out = &Port{}
+	t = &Transposer{NoteMap: noteMap, Wires: NewWires(), bypass: new(bypass)}
+	t.in = NewPort(false)
+	t.out = NewPort(false)
 	if transposeFunc == nil {
-		transposeFunc = func(t1 Transposer) {
-			for {
-				switch e := <-t.In; e.(type) {
-				case NoteOn:
-					n := e.(NoteOn)
-					if key, ok := t.NoteMap[n.Key]; ok {
-						n.Key = key
-					}
-					t.Out <- n
-				case NoteOff:
-					n := e.(NoteOff)
-					if key, ok := t.NoteMap[n.Key]; ok {
-						n.Key = key
-					}
-					t.Out <- n
-				default:
-					t.Out <- e
-				}
-			}
-		}
+		transposeFunc = transpose
 	}
 	t.Transpose = transposeFunc
 	t.ReverseMap = make(map[int]int, len(t.NoteMap))
@@ -216,6 +462,69 @@ func NewTransposer(noteMap map[int]int, transposeFunc Transposition) (t *Transpo
 	return
 }
 
+// The default Transposition, mapping the keys of NoteOns and NoteOffs while
+// preserving their channel and velocity. A note is released (by a NoteOff, or
+// a NoteOn without velocity) with the key it was mapped to when pressed,
+// even if the note map changed since.
+func transpose(t Transposer) {
+	sounding := make(map[noteID]int) // Mapped keys of pressed notes.
+	press := func(channel, key int) int {
+		mapped, ok := t.NoteMap[key]
+		if !ok {
+			mapped = key
+		}
+		sounding[noteID{channel, key}] = mapped
+		return mapped
+	}
+	release := func(channel, key int) int {
+		id := noteID{channel, key}
+		mapped, ok := sounding[id]
+		if !ok {
+			if mapped, ok = t.NoteMap[key]; !ok {
+				mapped = key
+			}
+		}
+		delete(sounding, id)
+		return mapped
+	}
+	var done <-chan bool // Never closed for a Transposer without ports.
+	if t.in != nil {
+		done = t.in.done()
+	}
+	pressed := make(map[noteID]bool) // Whether each sounding note bypassed the Transposer.
+	for {
+		var e Message
+		select {
+		case e = <-t.In:
+		case <-done:
+			return
+		}
+		if t.bypasses(e, pressed) {
+			if !send(t.Out, e, done) {
+				return
+			}
+			continue
+		}
+		switch e.(type) {
+		case NoteOn:
+			n := e.(NoteOn)
+			if n.Velocity == 0 {
+				n.Key = release(n.Channel, n.Key)
+			} else {
+				n.Key = press(n.Channel, n.Key)
+			}
+			e = n
+		case NoteOff:
+			n := e.(NoteOff)
+			n.Key = release(n.Channel, n.Key)
+			e = n
+		}
+		if !send(t.Out, e, done) {
+			return
+		}
+	}
+}
+
 func (t *Transposer) Open() error {
 	if err := t.in.Open(); err != nil {
 		return err
@@ -231,5 +540,8 @@ func (t Transposer) Close() (err error) {
 }
 
 func (t Transposer) Connect() {
+	if t.Transpose == nil {
+		t.Transpose = transpose
+	}
 	t.Transpose(t)
 }
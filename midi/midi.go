@@ -1,14 +1,25 @@
 // Package midi defines high-level data types for MIDI data and high-level interfaces for MIDI Devices.
 package midi
 
+import (
+	"fmt"
+	"sync"
+)
+
 const (
 	BufferSize int = 1
 )
 
 const (
-	NOTE_ON        int = 144
-	NOTE_OFF       int = 128
-	CONTROL_CHANGE int = 176
+	NOTE_ON          int = 144
+	NOTE_OFF         int = 128
+	CONTROL_CHANGE   int = 176
+	CHANNEL_PRESSURE int = 208
+	PITCH_BEND       int = 224
+	TIMING_CLOCK     int = 248
+	START            int = 250
+	CONTINUE         int = 251
+	STOP             int = 252
 )
 
 type Opener interface {
@@ -23,12 +34,39 @@ type Connecter interface {
 	Connect()
 }
 
+// A disconnection signals goroutines transmitting MIDI data to stop.
+// It is safe to disconnect more than once, and from any goroutine.
+type disconnection struct {
+	once sync.Once
+	c    chan bool
+}
+
+func newDisconnection() *disconnection {
+	return &disconnection{c: make(chan bool)}
+}
+
+// Signals all goroutines waiting on the done channel to stop.
+func (d *disconnection) disconnect() {
+	d.once.Do(func() { close(d.c) })
+}
+
+// Returns a channel that is closed once disconnected.
+func (d *disconnection) done() <-chan bool {
+	return d.c
+}
+
 type Uint32er interface {
 	Uint32() uint32
 }
 
+type Encoder interface {
+	Encode() []byte
+}
+
 type Message interface {
 	Uint32er
+	Encoder
+	fmt.Stringer
 }
 
 type message struct {
@@ -51,6 +89,15 @@ func newMessage(u uint32) *message {
 	}
 }
 
+func (m message) String() string {
+	return fmt.Sprintf("Message ch=%d cmd=%d data1=%d data2=%d",
+		m.Channel, m.Command, m.Data1, m.Data2)
+}
+
+func (m message) Encode() []byte {
+	return encode(m)
+}
+
 func (m message) Uint32() uint32 {
 	status := m.Command + m.Channel
 	return ((uint32(m.Data2) << 16) & 0xFF0000) |
@@ -68,12 +115,20 @@ func (n NoteOn) Uint32() uint32 {
 	return message{n.Channel, NOTE_ON, n.Key, n.Velocity}.Uint32()
 }
 
+func (n NoteOn) String() string {
+	return fmt.Sprintf("NoteOn ch=%d key=%d vel=%d", n.Channel, n.Key, n.Velocity)
+}
+
 type NoteOff NoteOn
 
 func (n NoteOff) Uint32() uint32 {
 	return message{n.Channel, NOTE_OFF, n.Key, n.Velocity}.Uint32()
 }
 
+func (n NoteOff) String() string {
+	return fmt.Sprintf("NoteOff ch=%d key=%d vel=%d", n.Channel, n.Key, n.Velocity)
+}
+
 type ControlChange struct {
 	Channel int
 	ID      int // a.k.a. Control Change "number"
@@ -85,6 +140,112 @@ func (c ControlChange) Uint32() uint32 {
 	return message{c.Channel, CONTROL_CHANGE, c.ID, c.Value}.Uint32()
 }
 
+func (c ControlChange) String() string {
+	s := fmt.Sprintf("ControlChange ch=%d id=%d value=%d", c.Channel, c.ID, c.Value)
+	if c.Name != "" {
+		s += " (" + c.Name + ")"
+	}
+	return s
+}
+
+// A PitchBend bends the pitch of every note of a channel, by as much as the receiving
+// device's pitch bend range (usually 2 semitones) up or down.
+type PitchBend struct {
+	Channel int
+	Value   int // From -8192 (bent fully down) to 8191 (bent fully up), or 0 for no bend.
+}
+
+func (p PitchBend) Uint32() uint32 {
+	v := p.Value + 8192
+	return message{p.Channel, PITCH_BEND, v & 0x7F, (v >> 7) & 0x7F}.Uint32()
+}
+
+func (p PitchBend) String() string {
+	return fmt.Sprintf("PitchBend ch=%d value=%d", p.Channel, p.Value)
+}
+
+// A ChannelPressure (a.k.a. "aftertouch") is how firmly the keys of a channel are held down.
+type ChannelPressure struct {
+	Channel  int
+	Pressure int
+}
+
+func (c ChannelPressure) Uint32() uint32 {
+	return message{c.Channel, CHANNEL_PRESSURE, c.Pressure, 0}.Uint32()
+}
+
+func (c ChannelPressure) String() string {
+	return fmt.Sprintf("ChannelPressure ch=%d pressure=%d", c.Channel, c.Pressure)
+}
+
+// A RealTime message synchronizes devices to a tempo, and has no channel or data.
+type RealTime int
+
+const (
+	TimingClock RealTime = RealTime(TIMING_CLOCK) // Sent 24 times per quarter note.
+	Start       RealTime = RealTime(START)        // Starts playback from the beginning.
+	Continue    RealTime = RealTime(CONTINUE)     // Resumes playback from where it stopped.
+	Stop        RealTime = RealTime(STOP)         // Stops playback.
+)
+
+func (r RealTime) Uint32() uint32 {
+	return uint32(r) & 0xFF
+}
+
+func (r RealTime) String() string {
+	switch r {
+	case TimingClock:
+		return "TimingClock"
+	case Start:
+		return "Start"
+	case Continue:
+		return "Continue"
+	case Stop:
+		return "Stop"
+	}
+	return fmt.Sprintf("RealTime status=%#x", int(r))
+}
+
+// Returns the channel of a message, and false for messages without a channel.
+func getChannel(m Message) (int, bool) {
+	switch msg := m.(type) {
+	case NoteOn:
+		return msg.Channel, true
+	case NoteOff:
+		return msg.Channel, true
+	case ControlChange:
+		return msg.Channel, true
+	case PitchBend:
+		return msg.Channel, true
+	case ChannelPressure:
+		return msg.Channel, true
+	}
+	return 0, false
+}
+
+// Returns a copy of a message set to a different channel.
+// Messages without a channel are returned unaltered.
+func setChannel(m Message, channel int) Message {
+	switch msg := m.(type) {
+	case NoteOn:
+		msg.Channel = channel
+		return msg
+	case NoteOff:
+		msg.Channel = channel
+		return msg
+	case ControlChange:
+		msg.Channel = channel
+		return msg
+	case PitchBend:
+		msg.Channel = channel
+		return msg
+	case ChannelPressure:
+		msg.Channel = channel
+		return msg
+	}
+	return m
+}
+
 // General MIDI names for various ControlChange IDs.
 var ControlChangeNames = map[int]string{
 	0:   "Bank Select",
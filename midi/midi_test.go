@@ -8,7 +8,10 @@ These tests require IAC buses to be created on an OS X system, named:
 */
 
 import (
+	"io"
+	"math"
 	"testing"
+	"time"
 )
 
 func testSystemDevice(t *testing.T) {
@@ -20,6 +23,249 @@ func testSystemDevice(t *testing.T) {
 	devices.Shutdown()
 }
 
+func testVirtualDevice(t *testing.T) {
+	devices, _ := GetDevices()
+	virtual, err := NewVirtualDevice("go-audio virtual")
+	if err != nil {
+		t.Fatalf("Could not create virtual device: %v", err)
+	}
+	if err := virtual.Open(); err != nil {
+		t.Errorf("Could not open virtual device: %v", err)
+	}
+	virtual.Connect()
+	virtual.Close()
+	devices.Shutdown()
+}
+
+func TestMessageString(t *testing.T) {
+	tests := []struct {
+		m        Message
+		expected string
+	}{
+		{NoteOn{0, 64, 127}, "NoteOn ch=0 key=64 vel=127"},
+		{NoteOff{9, 36, 0}, "NoteOff ch=9 key=36 vel=0"},
+		{ControlChange{1, 7, 100, ControlChangeNames[7]},
+			"ControlChange ch=1 id=7 value=100 (Channel Volume (formerly Main Volume))"},
+		{ControlChange{Channel: 1, ID: 7, Value: 100}, "ControlChange ch=1 id=7 value=100"},
+	}
+	for _, test := range tests {
+		if actual := test.m.String(); actual != test.expected {
+			t.Errorf("Received %q instead of %q", actual, test.expected)
+		}
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, m := range []Message{
+		NoteOn{0, 64, 127},
+		NoteOff{15, 0, 64},
+		ControlChange{3, 1, 100, ControlChangeNames[1]},
+		TimingClock,
+		Stop,
+		PitchBend{2, -8192},
+		PitchBend{2, 0},
+		PitchBend{2, 8191},
+		ChannelPressure{5, 99},
+	} {
+		b := m.Encode()
+		actual, err := DecodeMessage(b[0], b[1:])
+		if err != nil {
+			t.Errorf("Could not decode %q: %v", m, err)
+		}
+		if actual != m {
+			t.Errorf("Decoded %q instead of %q", actual, m)
+		}
+	}
+	if _, err := DecodeMessage(0x90, []byte{64}); err == nil {
+		t.Errorf("Expected an error decoding a message missing a data byte.")
+	}
+}
+
+func TestDecoderRunningStatus(t *testing.T) {
+	var d Decoder
+	// Three NoteOns with one status byte, split across calls and interrupted by a clock tick.
+	messages, err := d.Decode([]byte{0x90, 60, 100, 64, 0xF8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	more, err := d.Decode([]byte{101, 67, 0, 0xB1, 7, 127})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages = append(messages, more...)
+	expected := []Message{
+		NoteOn{0, 60, 100},
+		TimingClock,
+		NoteOn{0, 64, 101},
+		NoteOn{0, 67, 0},
+		ControlChange{1, 7, 127, ControlChangeNames[7]},
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("Decoded %d messages instead of %d: %q", len(messages), len(expected), messages)
+	}
+	for i, m := range expected {
+		if messages[i] != m {
+			t.Errorf("Decoded %q instead of %q", messages[i], m)
+		}
+	}
+}
+
+func TestDecodeEventRunningStatus(t *testing.T) {
+	var d Decoder
+	// Events as read from a port, the latter two omitting the status byte of the first.
+	events := []uint32{0x643C90, 0x6540, 0x0043, 0x7F07B1, 0x3C80}
+	expected := []Message{
+		NoteOn{0, 60, 100},
+		NoteOn{0, 64, 101},
+		NoteOn{0, 67, 0},
+		ControlChange{1, 7, 127, ControlChangeNames[7]},
+		NoteOff{0, 60, 0},
+	}
+	var messages []Message
+	for _, e := range events {
+		m, err := d.decodeEvent(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m...)
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("Decoded %d messages instead of %d: %q", len(messages), len(expected), messages)
+	}
+	for i, m := range expected {
+		if messages[i] != m {
+			t.Errorf("Decoded %q instead of %q", messages[i], m)
+		}
+	}
+}
+
+func TestNetDevice(t *testing.T) {
+	receiver := NewNetDevice("127.0.0.1:0", "")
+	if err := receiver.Open(); err != nil {
+		t.Fatalf("Could not open network device: %v", err)
+	}
+	sender := NewNetDevice("127.0.0.1:0", receiver.Addr().String())
+	if err := sender.Open(); err != nil {
+		t.Fatalf("Could not open network device: %v", err)
+	}
+	receiver.Connect()
+	sender.Connect()
+	expected := NoteOn{0, 64, 127}
+	sender.In <- expected
+	if actual := <-receiver.Out; actual != expected {
+		t.Errorf("Received %q over the network instead of %q", actual, expected)
+	}
+	sender.Close()
+	receiver.Close()
+}
+
+// Joins a pair of pipes into a stream, as if a serial port.
+type pipeStream struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (p pipeStream) Close() error {
+	p.PipeReader.Close()
+	return p.PipeWriter.Close()
+}
+
+func TestStreamDevice(t *testing.T) {
+	inReader, inWriter := io.Pipe()   // From the "synth" to the device.
+	outReader, outWriter := io.Pipe() // From the device to the "synth".
+	s := newStreamDevice(pipeStream{inReader, outWriter})
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	s.Connect()
+	go inWriter.Write([]byte{0x90, 60, 100, 64, 100, 0x80, 60, 0})
+	expected := []Message{NoteOn{0, 60, 100}, NoteOn{0, 64, 100}, NoteOff{0, 60, 0}}
+	for _, e := range expected {
+		if actual := <-s.Out; actual != e {
+			t.Errorf("Received %q from serial device instead of %q", actual, e)
+		}
+	}
+	s.In <- ControlChange{Channel: 1, ID: 7, Value: 100}
+	b := make([]byte, 3)
+	if _, err := io.ReadFull(outReader, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string([]byte{0xB1, 7, 100}) {
+		t.Errorf("Sent % X over serial instead of % X", b, []byte{0xB1, 7, 100})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffDevices(t *testing.T) {
+	before := map[string]bool{"Launchpad": true, "nanoPAD2 PAD": true}
+	after := map[string]bool{"Launchpad": true, "IAC Driver Bus 1": true}
+	events := diffDevices(before, after)
+	if len(events) != 2 {
+		t.Fatalf("Received %d device events instead of %d: %+v", len(events), 2, events)
+	}
+	expected := []DeviceEvent{{Name: "IAC Driver Bus 1", Added: true}, {Name: "nanoPAD2 PAD", Added: false}}
+	for i, e := range expected {
+		if events[i] != e {
+			t.Errorf("Received %+v device event instead of %+v", events[i], e)
+		}
+	}
+}
+
+func TestSystemDevicesGet(t *testing.T) {
+	devices := SystemDevices{
+		"IAC Driver Bus 1": SystemDevice{Name: "IAC Driver Bus 1"},
+		"Launchpad":        SystemDevice{Name: "Launchpad"},
+	}
+	d, err := devices.Get("Launchpad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "Launchpad" {
+		t.Errorf("Received device %q instead of %q", d.Name, "Launchpad")
+	}
+	_, err = devices.Get("IAC Driver Bus 2")
+	if err == nil {
+		t.Fatalf("Expected an error for a missing device.")
+	}
+	expected := `Device not found: "IAC Driver Bus 2" (available: "IAC Driver Bus 1", "Launchpad")`
+	if err.Error() != expected {
+		t.Errorf("Received error %q instead of %q", err.Error(), expected)
+	}
+}
+
+func TestSystemDevicesRefreshOpenDevice(t *testing.T) {
+	open := SystemDevice{Name: "Launchpad"}
+	open.in = &SystemInPort{SystemPort: SystemPort{Port: NewPort(true)}}
+	devices := SystemDevices{"Launchpad": open}
+	if err := devices.Refresh(); err == nil {
+		t.Errorf("Expected an error refreshing while a device is open.")
+	}
+	if _, ok := devices["Launchpad"]; !ok {
+		t.Errorf("Expected an open device to remain after refreshing failed.")
+	}
+}
+
+func TestSystemDevicesWatchOpenDevice(t *testing.T) {
+	open := SystemDevice{Name: "Launchpad"}
+	open.in = &SystemInPort{SystemPort: SystemPort{Port: NewPort(true)}}
+	devices := SystemDevices{"Launchpad": open}
+	stop := make(chan bool, 1)
+	events := devices.Watch(time.Millisecond, stop)
+	select {
+	case e := <-events:
+		if e.Err == nil {
+			t.Errorf("Expected an error event polling while a device is open instead of %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected an error event polling while a device is open.")
+	}
+	stop <- true
+	for range events {
+	}
+}
+
 func TestPipe(t *testing.T) {
 	src := NewDevice()
 	dst := NewDevice()
@@ -38,6 +284,927 @@ func TestPipe(t *testing.T) {
 	pipe.Close()
 }
 
+func TestPipeBuffered(t *testing.T) {
+	for _, bufferSize := range []int{0, 1, DefaultBufferSize} {
+		src := NewDevice()
+		dst := NewDeviceBuffered(1)
+		pipe := NewPipeBuffered(src, dst, bufferSize)
+		if err := pipe.Open(); err != nil {
+			t.Fatalf("Could not open pipe: %v", err)
+		}
+		go pipe.Connect()
+		// Messages are held by the pipe (and the device) until received, without blocking the sender.
+		n := bufferSize + 1
+		for key := 0; key < n; key++ {
+			select {
+			case src.Out <- NoteOn{0, key, 127}:
+			case <-time.After(time.Second):
+				t.Fatalf("Pipe with a buffer of %d messages blocked on message %d", bufferSize, key)
+			}
+		}
+		for key := 0; key < n; key++ {
+			if actual, expected := <-dst.In, (NoteOn{0, key, 127}); actual != expected {
+				t.Errorf("Received %q from pipe with a buffer of %d messages instead of %q",
+					actual, bufferSize, expected)
+			}
+		}
+		pipe.Close()
+	}
+}
+
+func TestPipeDrain(t *testing.T) {
+	pipe := NewPipe(NewDevice(), NewDevice())
+	if err := pipe.Open(); err != nil {
+		t.Fatalf("Could not open pipe: %v", err)
+	}
+	go pipe.Drain()
+	for channel := 0; channel < 16; channel++ {
+		expected := ControlChange{channel, 123, 0, ControlChangeNames[123]}
+		if actual := <-pipe.To.In; actual != expected {
+			t.Errorf("Received %q from drained pipe instead of %q", actual, expected)
+		}
+	}
+	pipe.Close()
+}
+
+func TestPipeDrainConnected(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		src := NewDevice()
+		dst := NewDevice()
+		pipe := NewPipe(src, dst)
+		if err := pipe.Open(); err != nil {
+			t.Fatalf("Could not open pipe: %v", err)
+		}
+		go pipe.Connect()
+		// Notes are in flight, held by the pipe, when it is drained.
+		const numNotes = 8
+		for key := 0; key < numNotes; key++ {
+			src.Out <- NoteOn{0, key, 127}
+		}
+		go pipe.Drain()
+		for key := 0; key < numNotes; key++ {
+			if actual, expected := <-dst.In, (NoteOn{0, key, 127}); actual != expected {
+				t.Errorf("Received %q from drained pipe instead of %q", actual, expected)
+			}
+		}
+		for channel := 0; channel < 16; channel++ {
+			expected := ControlChange{channel, 123, 0, ControlChangeNames[123]}
+			if actual := <-dst.In; actual != expected {
+				t.Errorf("Received %q from drained pipe instead of %q", actual, expected)
+			}
+		}
+		pipe.Close()
+	}
+}
+
+func TestChainInsertRemove(t *testing.T) {
+	src, dst := NewDevice(), NewDevice()
+	c := NewChain(src, dst)
+	if err := c.Open(); err != nil {
+		t.Fatalf("Could not open chain: %v", err)
+	}
+	go c.Connect()
+	// A device moving MIDI data from its In to its Out on another channel.
+	newRechanneler := func(channel int) *Device {
+		d := NewDevice()
+		go func() {
+			for {
+				select {
+				case m := <-d.In:
+					d.Out <- setChannel(m, channel)
+				case <-d.in.done():
+					return
+				}
+			}
+		}()
+		return d
+	}
+	expect := func(expected Message) {
+		src.Out <- NoteOn{0, 60, 100}
+		if actual := <-dst.In; actual != expected {
+			t.Errorf("Received %q from chain instead of %q", actual, expected)
+		}
+	}
+	expect(NoteOn{0, 60, 100})
+	if err := c.Insert(1, newRechanneler(5)); err != nil {
+		t.Fatal(err)
+	}
+	expect(NoteOn{5, 60, 100})
+	if err := c.Insert(2, newRechanneler(7)); err != nil {
+		t.Fatal(err)
+	}
+	expect(NoteOn{7, 60, 100})
+	if len(c.Devices) != 4 {
+		t.Errorf("Expected %d devices in the chain instead of %d", 4, len(c.Devices))
+	}
+	if _, err := c.Remove(2); err != nil {
+		t.Fatal(err)
+	}
+	expect(NoteOn{5, 60, 100})
+	if d, err := c.Remove(1); err != nil {
+		t.Fatal(err)
+	} else {
+		d.Close()
+	}
+	expect(NoteOn{0, 60, 100})
+	if err := c.Insert(3, NewDevice()); err == nil {
+		t.Errorf("Expected an error for inserting beyond the end of the chain.")
+	}
+	if _, err := c.Remove(-1); err == nil {
+		t.Errorf("Expected an error for removing a device before the start of the chain.")
+	}
+	c.Close()
+}
+
+func TestMockDevices(t *testing.T) {
+	devices := NewMockDevices("keyboard", "synth", "drums")
+	keyboard, _ := devices.Get("keyboard")
+	if _, err := devices.Get("bass"); err == nil {
+		t.Errorf("Expected an error getting a device that doesn't exist.")
+	}
+	expected := Message(NoteOn{0, 64, 127})
+	if err := keyboard.Send(expected); err == nil {
+		t.Errorf("Expected an error sending a message that isn't received.")
+	}
+	if err := devices.Shutdown(); err != nil {
+		t.Error(err)
+	}
+	type connector interface {
+		Open() error
+		Close() error
+		Connect()
+	}
+	for name, connect := range map[string]func(from *MockDevice, to ...*MockDevice) connector{
+		"pipe": func(from *MockDevice, to ...*MockDevice) connector {
+			return NewPipe(from.Device, to[0].Device)
+		},
+		"chain": func(from *MockDevice, to ...*MockDevice) connector {
+			return NewChain(from.Device, to[0].Device)
+		},
+		"router": func(from *MockDevice, to ...*MockDevice) connector {
+			return NewRouter(*from.Device, *to[0].Device, *to[1].Device)
+		},
+		"funnel": func(from *MockDevice, to ...*MockDevice) connector {
+			return NewFunnel(to[0].Device, from.Device)
+		},
+	} {
+		from, to := NewMockDevice("from"), []*MockDevice{NewMockDevice("to"), NewMockDevice("other")}
+		c := connect(from, to...)
+		if err := c.Open(); err != nil {
+			t.Fatalf("Could not open %v: %v", name, err)
+		}
+		go c.Connect()
+		if err := from.Send(expected); err != nil {
+			t.Fatal(err)
+		}
+		if actual, err := to[0].Receive(); err != nil {
+			t.Errorf("Expected a message from %v: %v", name, err)
+		} else if actual != expected {
+			t.Errorf("Received %q from %v instead of %q", actual, name, expected)
+		}
+		if name == "router" {
+			if actual, err := to[1].Receive(); err != nil || actual != expected {
+				t.Errorf("Received %q (%v) from %v instead of %q", actual, err, name, expected)
+			}
+		}
+		if received := to[0].Received(); len(received) != 0 {
+			t.Errorf("Received unexpected messages %q from %v", received, name)
+		}
+		c.Close()
+		for _, d := range append(to, from) {
+			d.Close()
+		}
+	}
+}
+
+func TestChainDrainWhileRewiring(t *testing.T) {
+	stop := make(chan bool)
+	defer close(stop)
+	// Returns a device whose MIDI input is always received.
+	sink := func(d *Device) *Device {
+		go func() {
+			for {
+				select {
+				case <-d.In:
+				case <-stop:
+					return
+				}
+			}
+		}()
+		return d
+	}
+	for _, connect := range []bool{false, true} {
+		c := NewChain(NewDevice(), sink(NewDevice()))
+		if err := c.Open(); err != nil {
+			t.Fatalf("Could not open chain: %v", err)
+		}
+		if connect {
+			c.Connect()
+		}
+		rewired := make(chan bool)
+		go func() {
+			for i := 0; i < 50; i++ {
+				if err := c.Insert(1, sink(NewDevice())); err != nil {
+					t.Error(err)
+				}
+				if _, err := c.Remove(1); err != nil {
+					t.Error(err)
+				}
+			}
+			close(rewired)
+		}()
+		for rewiring := true; rewiring; {
+			select {
+			case <-rewired:
+				rewiring = false
+			default:
+				c.Drain()
+			}
+		}
+		c.Close()
+	}
+}
+
+func TestPanic(t *testing.T) {
+	in := make(chan Message)
+	go Panic(in)
+	for channel := 0; channel < 16; channel++ {
+		for _, id := range []int{120, 123} {
+			expected := ControlChange{channel, id, 0, ControlChangeNames[id]}
+			if actual := <-in; actual != expected {
+				t.Errorf("Received %q from panic instead of %q", actual, expected)
+			}
+		}
+	}
+	if err := Panic(make(chan Message)); err == nil {
+		t.Errorf("Expected an error for a panic that isn't received.")
+	}
+}
+
+func TestPipeCloseWhileConnected(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		src := NewDevice()
+		dst := NewDevice()
+		pipe := NewPipe(src, dst)
+		if err := pipe.Open(); err != nil {
+			t.Errorf("Could not open pipe: %v", err)
+		}
+		go pipe.Connect()
+		go func() {
+			// Keep sending while the pipe is closed out from under the sender.
+			for j := 0; j < 100; j++ {
+				select {
+				case src.Out <- NoteOn{0, j, 127}:
+				case <-src.out.done():
+					return
+				}
+			}
+		}()
+		done := make(chan bool)
+		for j := 0; j < 3; j++ {
+			go func() {
+				pipe.Close()
+				done <- true
+			}()
+		}
+		for j := 0; j < 3; j++ {
+			<-done
+		}
+		devices := SystemDevices{}
+		if err := devices.Shutdown(); err != nil {
+			t.Errorf("Could not shut down: %v", err)
+		}
+	}
+}
+
+func TestMerger(t *testing.T) {
+	keyboard := NewDevice()
+	drums := NewDevice()
+	synth := NewDevice()
+	merger := NewMerger(synth, map[*Device]int{keyboard: 0, drums: 9})
+	if err := merger.Open(); err != nil {
+		t.Errorf("Could not open merger: %v", err)
+	}
+	go merger.Connect()
+	keyboard.Out <- NoteOn{3, 64, 127}
+	if actual, expected := <-synth.In, (NoteOn{0, 64, 127}); actual != expected {
+		t.Errorf("Received %q from merger instead of %q", actual, expected)
+	}
+	drums.Out <- NoteOff{0, 36, 0}
+	if actual, expected := <-synth.In, (NoteOff{9, 36, 0}); actual != expected {
+		t.Errorf("Received %q from merger instead of %q", actual, expected)
+	}
+}
+
+func TestRuleRouter(t *testing.T) {
+	src := NewDevice()
+	bass := NewDevice()
+	drums := NewDevice()
+	router := NewRuleRouter(*src, []Rule{
+		{Matches: MatchKeys(0, 47), To: *bass},
+		{Matches: MatchChannel(9), To: *drums},
+	})
+	if err := router.Open(); err != nil {
+		t.Errorf("Could not open router: %v", err)
+	}
+	go router.Connect()
+	expected := NoteOn{0, 40, 127}
+	src.Out <- expected
+	if actual := <-bass.In; actual != expected {
+		t.Errorf("Received %q from router instead of %q", actual, expected)
+	}
+	expected = NoteOn{9, 60, 127}
+	src.Out <- expected
+	if actual := <-drums.In; actual != expected {
+		t.Errorf("Received %q from router instead of %q", actual, expected)
+	}
+	expected = NoteOn{9, 36, 127} // Matches both rules.
+	src.Out <- expected
+	if actual := <-bass.In; actual != expected {
+		t.Errorf("Received %q from router instead of %q", actual, expected)
+	}
+	if actual := <-drums.In; actual != expected {
+		t.Errorf("Received %q from router instead of %q", actual, expected)
+	}
+}
+
+func TestRuleRouterOrder(t *testing.T) {
+	src := NewDevice()
+	dst := NewDeviceBuffered(mockBufferSize)
+	router := NewRuleRouter(*src, []Rule{{To: *dst}})
+	if err := router.Open(); err != nil {
+		t.Errorf("Could not open router: %v", err)
+	}
+	go router.Connect()
+	defer router.Close()
+	var expected []Message
+	for key := 0; key < 100; key++ {
+		expected = append(expected, NoteOn{0, key, 127}, NoteOff{0, key, 0})
+	}
+	for _, m := range expected {
+		src.Out <- m
+	}
+	for i, m := range expected {
+		select {
+		case actual := <-dst.In:
+			if actual != m {
+				t.Fatalf("Received %q from router instead of %q at offset %d", actual, m, i)
+			}
+		case <-time.After(mockTimeout):
+			t.Fatalf("Received %d of %d messages from router", i, len(expected))
+		}
+	}
+}
+
+func TestQuantizerDelay(t *testing.T) {
+	q := NewQuantizer(120, 16)
+	q.start = time.Now()
+	interval := q.interval()
+	if expected := 125 * time.Millisecond; interval != expected {
+		t.Errorf("Grid interval of %v instead of %v", interval, expected)
+	}
+	for _, offset := range []time.Duration{0, 30 * time.Millisecond, 70 * time.Millisecond, 1010 * time.Millisecond} {
+		landed := offset + q.delay(q.start.Add(offset))
+		if landed < offset {
+			t.Errorf("A note at %v was moved back in time to %v", offset, landed)
+		}
+		if (landed-interval/2)%interval != 0 || landed-offset > interval {
+			t.Errorf("A note at %v landed at %v, off the grid", offset, landed)
+		}
+	}
+}
+
+func TestNewQuantizerDefaults(t *testing.T) {
+	for _, q := range []*Quantizer{NewQuantizer(0, 16), NewQuantizer(-1, 0), NewQuantizer(120, -4)} {
+		if q.Tempo() != 120 || q.Division() != 16 {
+			t.Errorf("Expected a grid of 16 divisions at 120 BPM instead of %d at %v BPM", q.Division(), q.Tempo())
+		}
+		if interval := q.interval(); interval != 125*time.Millisecond {
+			t.Errorf("Grid interval of %v instead of %v", interval, 125*time.Millisecond)
+		}
+	}
+}
+
+func TestQuantizer(t *testing.T) {
+	q := NewQuantizer(6000, 4) // A grid interval of 10 milliseconds.
+	if err := q.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go q.Connect()
+	q.In <- NoteOn{0, 64, 127}
+	q.In <- NoteOff{0, 64, 0}
+	if actual, expected := <-q.Out, (NoteOn{0, 64, 127}); actual != expected {
+		t.Errorf("Received %q from quantizer instead of %q", actual, expected)
+	}
+	if actual, expected := <-q.Out, (NoteOff{0, 64, 0}); actual != expected {
+		t.Errorf("Received %q from quantizer instead of %q", actual, expected)
+	}
+	q.Close()
+}
+
+func TestQuantizerSetTempo(t *testing.T) {
+	q := NewQuantizer(6000, 4)
+	if err := q.SetTempo(0); err == nil {
+		t.Errorf("Expected an error setting a tempo of 0 BPM.")
+	}
+	if err := q.SetDivision(0); err == nil {
+		t.Errorf("Expected an error setting a division of 0.")
+	}
+	if q.Tempo() != 6000 || q.Division() != 4 {
+		t.Errorf("Expected a grid of 4 divisions at 6000 BPM instead of %d at %v BPM", q.Division(), q.Tempo())
+	}
+	if err := q.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go q.Connect()
+	// The grid may change while notes are quantized.
+	for i, bpm := range []float64{3000, 12000} {
+		if err := q.SetTempo(bpm); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.SetDivision(8 * (i + 1)); err != nil {
+			t.Fatal(err)
+		}
+		q.In <- NoteOn{0, 64, 127}
+		if actual, expected := <-q.Out, (NoteOn{0, 64, 127}); actual != expected {
+			t.Errorf("Received %q from quantizer instead of %q", actual, expected)
+		}
+	}
+	if interval := q.interval(); interval != 1250*time.Microsecond {
+		t.Errorf("Grid interval of %v instead of %v", interval, 1250*time.Microsecond)
+	}
+	q.Close()
+}
+
+func TestRateLimiter(t *testing.T) {
+	r := NewRateLimiter(20) // A message every 50 milliseconds.
+	r.BufferSize = 3
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go r.Connect()
+	r.In <- NoteOn{0, 60, 100}
+	<-r.Out
+	sent := time.Now()
+	for _, m := range []Message{
+		NoteOn{0, 64, 100},
+		ControlChange{0, 1, 10, ControlChangeNames[1]},
+		ControlChange{0, 1, 20, ControlChangeNames[1]},
+		NoteOff{0, 64, 0},
+		ControlChange{0, 1, 30, ControlChangeNames[1]},
+	} {
+		r.In <- m
+	}
+	// The oldest Control Changes are dropped once full, rather than the notes.
+	for _, expected := range []Message{
+		NoteOn{0, 64, 100},
+		NoteOff{0, 64, 0},
+		ControlChange{0, 1, 30, ControlChangeNames[1]},
+	} {
+		actual := <-r.Out
+		if actual != expected {
+			t.Errorf("Received %q from rate limiter instead of %q", actual, expected)
+		}
+		if elapsed := time.Since(sent); elapsed < 45*time.Millisecond {
+			t.Errorf("Received %q %v after the last message, faster than the maximum rate", actual, elapsed)
+		}
+		sent = time.Now()
+	}
+	if dropped := r.Dropped(); dropped != 2 {
+		t.Errorf("Expected 2 dropped messages instead of %d", dropped)
+	}
+	r.Close()
+}
+
+func TestChorder(t *testing.T) {
+	c := NewChorder([]int{4, 7})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go c.Connect()
+	c.In <- NoteOn{2, 60, 100}
+	for _, expected := range []Message{NoteOn{2, 60, 100}, NoteOn{2, 64, 100}, NoteOn{2, 67, 100}} {
+		if actual := <-c.Out; actual != expected {
+			t.Errorf("Received %q from chorder instead of %q", actual, expected)
+		}
+	}
+	c.Intervals = []int{3} // The chord must still be released as played.
+	c.In <- NoteOff{2, 60, 0}
+	for _, expected := range []Message{NoteOff{2, 60, 0}, NoteOff{2, 64, 0}, NoteOff{2, 67, 0}} {
+		if actual := <-c.Out; actual != expected {
+			t.Errorf("Received %q from chorder instead of %q", actual, expected)
+		}
+	}
+	c.Close()
+}
+
+func TestOctaveShifter(t *testing.T) {
+	o := NewOctaveShifter(2)
+	if err := o.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go o.Connect()
+	o.In <- NoteOn{0, 120, 100} // Beyond the range of MIDI keys once shifted.
+	o.In <- NoteOn{0, 60, 100}
+	if actual, expected := <-o.Out, (NoteOn{0, 84, 100}); actual != expected {
+		t.Errorf("Received %q from octave shifter instead of %q", actual, expected)
+	}
+	o.Octaves = -1 // The note must still be released as shifted.
+	o.In <- NoteOff{0, 120, 0}
+	o.In <- NoteOff{0, 60, 0}
+	if actual, expected := <-o.Out, (NoteOff{0, 84, 0}); actual != expected {
+		t.Errorf("Received %q from octave shifter instead of %q", actual, expected)
+	}
+	cc := ControlChange{Channel: 0, ID: 1, Value: 64}
+	o.In <- cc
+	if actual := <-o.Out; actual != cc {
+		t.Errorf("Received %q from octave shifter instead of %q", actual, cc)
+	}
+	o.Close()
+}
+
+func TestVelocityCurve(t *testing.T) {
+	tests := []struct {
+		curve    VelocityCurveKind
+		in, out  int
+		describe string
+	}{
+		{Linear, 64, 64, "Linear"},
+		{Soft, 32, 64, "Soft"},
+		{Hard, 64, 32, "Hard"},
+		{Hard, 1, 1, "Hard"},
+		{Fixed(100), 1, 100, "Fixed(100)"},
+		{Fixed(200), 1, 127, "Fixed(200)"},
+	}
+	for _, test := range tests {
+		if actual := clampVelocity(test.curve(test.in)); actual != test.out {
+			t.Errorf("Mapped velocity %d to %d instead of %d with %v", test.in, actual, test.out, test.describe)
+		}
+	}
+	v := NewVelocityCurve(Fixed(90))
+	if err := v.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go v.Connect()
+	for _, e := range []struct{ in, out Message }{
+		{NoteOn{0, 60, 10}, NoteOn{0, 60, 90}},
+		{NoteOn{0, 60, 0}, NoteOn{0, 60, 0}},
+		{NoteOff{0, 60, 10}, NoteOff{0, 60, 10}},
+	} {
+		v.In <- e.in
+		if actual := <-v.Out; actual != e.out {
+			t.Errorf("Received %q from velocity curve instead of %q", actual, e.out)
+		}
+	}
+	v.Close()
+}
+
+func TestVelocitySplit(t *testing.T) {
+	v := NewVelocitySplit([]int{40, 100}, []int{1, 2, 3})
+	if err := v.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go v.Connect()
+	for _, e := range []struct{ in, out Message }{
+		{NoteOn{0, 60, 39}, NoteOn{1, 60, 39}},
+		{NoteOn{0, 62, 40}, NoteOn{2, 62, 40}},
+		{NoteOn{0, 64, 127}, NoteOn{3, 64, 127}},
+		{NoteOff{0, 64, 0}, NoteOff{3, 64, 0}},
+		{NoteOn{0, 62, 0}, NoteOn{2, 62, 0}},
+		{NoteOn{0, 60, 100}, NoteOn{3, 60, 100}}, // Pressed again harder.
+		{NoteOff{0, 60, 0}, NoteOff{3, 60, 0}},
+		{NoteOff{5, 60, 0}, NoteOff{5, 60, 0}}, // Never pressed.
+		{ControlChange{0, 64, 127, ControlChangeNames[64]}, ControlChange{0, 64, 127, ControlChangeNames[64]}},
+	} {
+		v.In <- e.in
+		if actual := <-v.Out; actual != e.out {
+			t.Errorf("Received %q from velocity split instead of %q", actual, e.out)
+		}
+	}
+	v.Close()
+}
+
+func TestKeySplit(t *testing.T) {
+	k := NewKeySplit(60, 1, 2)
+	if err := k.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go k.Connect()
+	send := func(in, out Message) {
+		k.In <- in
+		if actual := <-k.Out; actual != out {
+			t.Errorf("Received %q from key split instead of %q", actual, out)
+		}
+	}
+	send(NoteOn{0, 59, 100}, NoteOn{1, 59, 100})
+	send(NoteOn{0, 60, 100}, NoteOn{2, 60, 100})
+	k.In <- PitchBend{0, 100}
+	<-k.Out // Synchronizes the change of split point with the processing goroutine.
+	k.SplitPoint = 48
+	send(NoteOn{0, 50, 100}, NoteOn{2, 50, 100})
+	send(NoteOff{0, 59, 0}, NoteOff{1, 59, 0})
+	send(NoteOn{0, 60, 0}, NoteOn{2, 60, 0})
+	send(NoteOn{0, 47, 90}, NoteOn{1, 47, 90})
+	k.Close()
+}
+
+func TestClock(t *testing.T) {
+	c := NewClock(120)
+	if expected := time.Minute / 120 / 24; c.interval() != expected {
+		t.Errorf("Expected ticks every %v instead of %v", expected, c.interval())
+	}
+	if err := c.SetTempo(0); err == nil {
+		t.Error("Expected an error setting a tempo of 0 BPM")
+	}
+	if err := c.SetTempo(2500); err != nil || c.Tempo() != 2500 {
+		t.Errorf("Could not set tempo: %v", err)
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go c.Connect()
+	// Commands are sent from another goroutine, as the clock may be sending a tick.
+	for _, r := range []RealTime{Start, Stop, Continue} {
+		go c.command(r)
+		for m := range c.Out {
+			if m == r {
+				break
+			}
+			if m != TimingClock {
+				t.Fatalf("Received %q from clock instead of %q", m, r)
+			}
+		}
+		if r == Stop {
+			continue
+		}
+		for i := 0; i < ClockResolution; i++ {
+			if m := <-c.Out; m != TimingClock {
+				t.Fatalf("Received %q from clock instead of %q", m, TimingClock)
+			}
+		}
+	}
+	c.Close()
+	if c.Start() {
+		t.Error("Expected starting a closed clock to fail")
+	}
+	if actual := TimingClock.Encode(); len(actual) != 1 || actual[0] != 0xF8 {
+		t.Errorf("Encoded %q as %v instead of [248]", TimingClock, actual)
+	}
+}
+
+func TestClockFollower(t *testing.T) {
+	f := NewClockFollower()
+	now := time.Unix(0, 0)
+	f.now = func() time.Time { return now }
+	interval := time.Minute / 100 / ClockResolution
+	tick := func(n int) {
+		for i := 0; i < n; i++ {
+			f.follow(TimingClock)
+			now = now.Add(interval)
+		}
+	}
+	tick(2)
+	if f.Playing() || f.Beat() != 0 || f.Phase() != 0 {
+		t.Errorf("Expected position to not advance while stopped")
+	}
+	if tempo := f.Tempo(); math.Abs(tempo-100) > 1e-6 {
+		t.Errorf("Expected a tempo of 100 BPM instead of %v", tempo)
+	}
+	f.follow(Start)
+	tick(ClockResolution + 7)
+	if beat, phase := f.Beat(), f.Phase(); beat != 1 || phase != 0.25 {
+		t.Errorf("Expected beat 1 at phase 0.25 instead of beat %d at phase %v", beat, phase)
+	}
+	f.follow(Stop)
+	now = now.Add(time.Minute) // A pause does not affect the tempo.
+	f.follow(Continue)
+	interval /= 2
+	tick(2 * ClockResolution)
+	if beat, phase := f.Beat(), f.Phase(); beat != 3 || phase != 0.25 {
+		t.Errorf("Expected beat 3 at phase 0.25 instead of beat %d at phase %v", beat, phase)
+	}
+	if tempo := f.Tempo(); math.Abs(tempo-200) > 1e-6 {
+		t.Errorf("Expected a tempo of 200 BPM instead of %v", tempo)
+	}
+	if err := f.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go f.Connect()
+	for _, m := range []Message{Start, TimingClock, NoteOn{0, 60, 100}} {
+		f.In <- m
+		if actual := <-f.Out; actual != m {
+			t.Errorf("Received %q from clock follower instead of %q", actual, m)
+		}
+	}
+	if !f.Playing() {
+		t.Errorf("Expected clock follower to be playing after Start")
+	}
+	f.Close()
+}
+
+func TestTap(t *testing.T) {
+	observed := make(chan Message)
+	tap := NewTap(func(m Message) { observed <- m })
+	if err := tap.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go tap.Connect()
+	expected := NoteOn{0, 60, 100}
+	tap.In <- expected
+	if actual := <-tap.Out; actual != expected {
+		t.Errorf("Received %q from tap instead of %q", actual, expected)
+	}
+	if actual := <-observed; actual != expected {
+		t.Errorf("Observed %q from tap instead of %q", actual, expected)
+	}
+	// MIDI data keeps flowing while the callback is blocked.
+	n := tapBufferSize + 10
+	for i := 0; i < n; i++ {
+		tap.In <- NoteOn{0, i, 100}
+		<-tap.Out
+	}
+	if dropped := tap.Dropped(); dropped < n-tapBufferSize-1 {
+		t.Errorf("Expected at least %d messages dropped instead of %d", n-tapBufferSize-1, dropped)
+	}
+	tap.Close()
+}
+
+func TestPitchBendTransposer(t *testing.T) {
+	p := NewPitchBendTransposer(map[int]float64{64: -13.7, 67: 2, 60: 150})
+	p.Channels = []int{1, 2}
+	if err := p.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go p.Connect()
+	for _, e := range []struct {
+		in  Message
+		out []Message
+	}{
+		{NoteOn{0, 64, 100}, []Message{PitchBend{1, -561}, NoteOn{1, 64, 100}}},
+		{NoteOn{0, 67, 90}, []Message{PitchBend{2, 82}, NoteOn{2, 67, 90}}},
+		// Every channel is sounding, so the oldest note is released for the next.
+		{NoteOn{0, 60, 80}, []Message{NoteOff{1, 64, 0}, PitchBend{1, -2048}, NoteOn{1, 62, 80}}},
+		{NoteOff{0, 67, 0}, []Message{NoteOff{2, 67, 0}}},
+		{NoteOff{0, 64, 0}, nil},
+		{NoteOn{0, 60, 0}, []Message{NoteOff{1, 62, 0}}},
+		{ControlChange{0, 1, 64, ControlChangeNames[1]}, []Message{ControlChange{0, 1, 64, ControlChangeNames[1]}}},
+	} {
+		p.In <- e.in
+		for _, expected := range e.out {
+			if actual := <-p.Out; actual != expected {
+				t.Errorf("Received %q from pitch bend transposer instead of %q", actual, expected)
+			}
+		}
+	}
+	p.Close()
+}
+
+func TestMPEZone(t *testing.T) {
+	lower, upper := LowerZone(3), UpperZone(2)
+	if lower.Master != 0 || len(lower.Members) != 3 || lower.Members[2] != 3 {
+		t.Errorf("Expected a lower zone of channels 1 through 3 instead of %+v", lower)
+	}
+	if upper.Master != 15 || len(upper.Members) != 2 || upper.Members[1] != 13 {
+		t.Errorf("Expected an upper zone of channels 14 and 13 instead of %+v", upper)
+	}
+	if m := lower.Configure()[2]; m != (ControlChange{0, 6, 3, ControlChangeNames[6]}) {
+		t.Errorf("Expected the configuration to set 3 member channels instead of %q", m)
+	}
+}
+
+func TestMPE(t *testing.T) {
+	e := NewMPE(LowerZone(2))
+	if err := e.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go e.Connect()
+	for _, test := range []struct {
+		in  Message
+		out []Message
+	}{
+		{NoteOn{3, 60, 100}, []Message{PitchBend{1, 0}, ChannelPressure{1, 0}, NoteOn{1, 60, 100}}},
+		{NoteOn{4, 64, 100}, []Message{PitchBend{2, 0}, ChannelPressure{2, 0}, NoteOn{2, 64, 100}}},
+		{PitchBend{3, 100}, []Message{PitchBend{1, 100}}},
+		{ChannelPressure{4, 50}, []Message{ChannelPressure{2, 50}}},
+		{PitchBend{0, 200}, []Message{PitchBend{0, 200}}},
+		{NoteOn{3, 67, 100}, []Message{NoteOff{1, 60, 0}, PitchBend{1, 0}, ChannelPressure{1, 0}, NoteOn{1, 67, 100}}},
+		{NoteOff{4, 64, 10}, []Message{NoteOff{2, 64, 10}}},
+		{PitchBend{4, 300}, []Message{PitchBend{0, 300}}},
+	} {
+		e.In <- test.in
+		for _, expected := range test.out {
+			if actual := <-e.Out; actual != expected {
+				t.Errorf("Received %q from MPE instead of %q", actual, expected)
+			}
+		}
+	}
+	e.Close()
+}
+
+func TestMPECollapser(t *testing.T) {
+	c := NewMPECollapser(0)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go c.Connect()
+	for _, test := range []struct {
+		in  Message
+		out []Message
+	}{
+		{PitchBend{1, 100}, []Message{PitchBend{0, 100}}},
+		{NoteOn{1, 60, 100}, []Message{PitchBend{0, 100}, ChannelPressure{0, 0}, NoteOn{0, 60, 100}}},
+		{NoteOn{2, 64, 90}, []Message{PitchBend{0, 0}, ChannelPressure{0, 0}, NoteOn{0, 64, 90}}},
+		{PitchBend{1, 500}, nil}, // Not of the most recent note.
+		{ChannelPressure{2, 40}, []Message{ChannelPressure{0, 40}}},
+		{NoteOff{2, 64, 0}, []Message{NoteOff{0, 64, 0}, PitchBend{0, 500}, ChannelPressure{0, 0}}},
+		{ControlChange{1, 74, 10, ControlChangeNames[74]}, []Message{ControlChange{0, 74, 10, ControlChangeNames[74]}}},
+	} {
+		c.In <- test.in
+		for _, expected := range test.out {
+			if actual := <-c.Out; actual != expected {
+				t.Errorf("Received %q from MPE collapser instead of %q", actual, expected)
+			}
+		}
+	}
+	c.Close()
+}
+
+func TestBypass(t *testing.T) {
+	transposer := NewTransposer(map[int]int{36: 37}, nil)
+	go transposer.Connect()
+	shifter := NewOctaveShifter(1)
+	if err := shifter.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go shifter.Connect()
+	for _, d := range []struct {
+		name     string
+		wires    *Wires
+		bypasser interface{ SetBypass(bool) }
+		key      int // The key 36 is mapped to when not bypassed.
+	}{
+		{"transposer", transposer.Wires, transposer, 37},
+		{"octave shifter", shifter.Wires, shifter, 48},
+	} {
+		for _, e := range []struct {
+			bypass  bool
+			in, out Message
+		}{
+			{false, NoteOn{0, 36, 100}, NoteOn{0, d.key, 100}},
+			{true, NoteOn{0, 36, 0}, NoteOn{0, d.key, 0}}, // Released as it was pressed.
+			{true, NoteOn{0, 36, 100}, NoteOn{0, 36, 100}},
+			{false, NoteOff{0, 36, 0}, NoteOff{0, 36, 0}},
+			{false, NoteOn{0, 36, 100}, NoteOn{0, d.key, 100}},
+		} {
+			d.bypasser.SetBypass(e.bypass)
+			d.wires.In <- e.in
+			if actual := <-d.wires.Out; actual != e.out {
+				t.Errorf("Received %q from %v (bypassed: %v) instead of %q", actual, d.name, e.bypass, e.out)
+			}
+		}
+	}
+	transposer.Close()
+	shifter.Close()
+}
+
+func TestZeroValueTransposer(t *testing.T) {
+	transposer := &Transposer{Wires: NewWires()}
+	go transposer.Connect()
+	expected := NoteOn{1, 64, 100}
+	transposer.In <- expected
+	if actual := <-transposer.Out; actual != expected {
+		t.Errorf("Received %q from transposer instead of %q", actual, expected)
+	}
+}
+
+func TestTransposer(t *testing.T) {
+	transposer := NewTransposer(map[int]int{36: 37}, nil)
+	go transposer.Connect()
+	transposer.In <- NoteOn{0, 36, 127}
+	if actual, expected := <-transposer.Out, (NoteOn{0, 37, 127}); actual != expected {
+		t.Errorf("Received %q from transposer instead of %q", actual, expected)
+	}
+	// The note must be released with the key it was pressed with.
+	transposer.NoteMap[36] = 38
+	transposer.In <- NoteOff{0, 36, 0}
+	if actual, expected := <-transposer.Out, (NoteOff{0, 37, 0}); actual != expected {
+		t.Errorf("Received %q from transposer instead of %q", actual, expected)
+	}
+	transposer.In <- NoteOn{0, 36, 127}
+	if actual, expected := <-transposer.Out, (NoteOn{0, 38, 127}); actual != expected {
+		t.Errorf("Received %q from transposer instead of %q", actual, expected)
+	}
+	transposer.In <- NoteOn{0, 36, 0}
+	if actual, expected := <-transposer.Out, (NoteOn{0, 38, 0}); actual != expected {
+		t.Errorf("Received %q from transposer instead of %q", actual, expected)
+	}
+	expected := ControlChange{0, 1, 64, "Modulation Wheel or Lever"}
+	transposer.In <- expected
+	if actual := <-transposer.Out; actual != expected {
+		t.Errorf("Received %q from transposer instead of %q", actual, expected)
+	}
+}
+
 /*
 
 TODO(aoeu): Reimplement all tests and examples.
@@ -177,16 +1344,19 @@ func ExampleChannelTransposer() {
 	iac2 := devices["IAC Driver Bus 2"]
 	transposer := NewTransposer(
 		map[int]int{1: 36, 2: 37, 3: 38, 4: 40, 5: 41, 6: 42},
+		// Override the default Transposition to map channels to keys.
 		func(t Transposer) {
 			for {
-				select {
-				case note := <-t.In:
+				switch e := <-t.In; e.(type) {
+				case NoteOn:
+					note := e.(NoteOn)
 					if key, ok := t.NoteMap[note.Channel]; ok {
 						note.Channel = 0
 						note.Key = key
 						t.Out <- note
 					}
-				case note := <-t.In:
+				case NoteOff:
+					note := e.(NoteOff)
 					if key, ok := t.NoteMap[note.Channel]; ok {
 						note.Channel = 0
 						note.Key = key
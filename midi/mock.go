@@ -0,0 +1,112 @@
+package midi
+
+import (
+	"fmt"
+	"time"
+)
+
+// How long a MockDevice waits for a message to be sent or received before giving up,
+// so that tests of connections fail rather than hang.
+const mockTimeout = time.Second
+
+// The number of messages received by a MockDevice that are held until read.
+const mockBufferSize = 1024
+
+// A MockDevice is an in-memory device for testing Pipes, Chains, Routers, Funnels, etc.
+// without PortMidi or MIDI devices on the system. Messages sent to its In are
+// held until read with Receive, and messages are sent from its Out with Send,
+// as though played on it. Connect the embedded Device as any other.
+type MockDevice struct {
+	*Device
+	Name       string
+	received   chan Message
+	disconnect *disconnection
+}
+
+// Creates a new MockDevice, which holds the messages it is sent until closed.
+func NewMockDevice(name string) *MockDevice {
+	m := &MockDevice{
+		Device:     NewDevice(),
+		Name:       name,
+		received:   make(chan Message, mockBufferSize),
+		disconnect: newDisconnection(),
+	}
+	go forward(m.In, m.received, m.disconnect.done())
+	return m
+}
+
+// Sends a message from the device's Out, returning an error if it isn't received
+// (by whatever the device is connected to) in time.
+func (m *MockDevice) Send(msg Message) error {
+	select {
+	case m.Out <- msg:
+		return nil
+	case <-time.After(mockTimeout):
+		return fmt.Errorf("Message %q sent from mock device %q was not received.", msg, m.Name)
+	}
+}
+
+// Returns the next message sent to the device's In, or an error if none is sent in time.
+func (m *MockDevice) Receive() (Message, error) {
+	select {
+	case msg := <-m.received:
+		return msg, nil
+	case <-time.After(mockTimeout):
+		return nil, fmt.Errorf("Mock device %q received no message.", m.Name)
+	}
+}
+
+// Returns the messages sent to the device's In but not yet received, without waiting.
+func (m *MockDevice) Received() []Message {
+	var messages []Message
+	for {
+		select {
+		case msg := <-m.received:
+			messages = append(messages, msg)
+		default:
+			return messages
+		}
+	}
+}
+
+// Stops holding the messages sent to the device and closes it.
+func (m *MockDevice) Close() error {
+	m.disconnect.disconnect()
+	return m.Device.Close()
+}
+
+// MockDevices are MockDevices by name, standing in for SystemDevices in tests.
+type MockDevices map[string]*MockDevice
+
+// Creates MockDevices of the specified names.
+func NewMockDevices(names ...string) MockDevices {
+	devices := make(MockDevices)
+	for _, name := range names {
+		devices[name] = NewMockDevice(name)
+	}
+	return devices
+}
+
+// Returns the device with the specified name, or an error listing the names
+// of the devices present if there is no such device, as per SystemDevices.Get.
+func (m MockDevices) Get(name string) (*MockDevice, error) {
+	if d, ok := m[name]; ok {
+		return d, nil
+	}
+	names := make([]string, 0, len(m))
+	for n := range m {
+		names = append(names, n)
+	}
+	return nil, deviceNotFound(name, names)
+}
+
+// Closes all devices.
+func (m MockDevices) Shutdown() error {
+	var err error
+	for _, device := range m {
+		if e := device.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+package midi
+
+/*
+MIDI Polyphonic Expression (MPE) gives each note its own pitch bend, pressure, and timbre
+(Control Change 74) by playing each note on a member channel of its own within a zone.
+Each zone also has a master channel, whose messages apply to all notes of the zone:
+channel 0 for the lower zone (with member channels counting up from 1),
+and channel 15 for the upper zone (with member channels counting down from 14).
+*/
+
+// An MPEZone is the master channel and member channels of an MPE zone.
+type MPEZone struct {
+	Master  int
+	Members []int
+}
+
+// Returns the lower zone, with a master channel of 0 and up to 15 member channels from 1 up.
+func LowerZone(numMembers int) MPEZone {
+	z := MPEZone{Master: 0}
+	for channel := 1; channel <= numMembers && channel < 16; channel++ {
+		z.Members = append(z.Members, channel)
+	}
+	return z
+}
+
+// Returns the upper zone, with a master channel of 15 and up to 15 member channels from 14 down.
+func UpperZone(numMembers int) MPEZone {
+	z := MPEZone{Master: 15}
+	for channel := 14; channel >= 15-numMembers && channel >= 0; channel-- {
+		z.Members = append(z.Members, channel)
+	}
+	return z
+}
+
+// Returns the MPE Configuration Message (Registered Parameter Number 6) for the zone,
+// which sets up a receiving device to play the zone.
+func (z MPEZone) Configure() []Message {
+	cc := func(id, value int) Message {
+		return ControlChange{z.Master, id, value, ControlChangeNames[id]}
+	}
+	return []Message{cc(101, 0), cc(100, 6), cc(6, len(z.Members))}
+}
+
+// An MPE distributes the notes played on any channel across the member channels of an MPE zone,
+// so that a receiving MPE device can bend and press each note independently.
+// Implements Device.
+type MPE struct {
+	processor
+	Zone MPEZone
+}
+
+// Creates a new MPE distributing notes across the member channels of a zone.
+func NewMPE(zone MPEZone) *MPE {
+	return &MPE{
+		processor: newProcessor(),
+		Zone:      zone,
+	}
+}
+
+// Begins distributing notes. Each NoteOn is preceded by a reset of the pitch bend and pressure
+// of its member channel, and the note is released on that channel. A note pressed when every member
+// channel is sounding takes the channel of the oldest note, which is released first.
+// Pitch bends, pressure, and Control Changes received on the channel of a sounding note
+// apply to its most recently pressed note, while those of the master channel (or of channels
+// without sounding notes) are sent to the master channel, applying to the entire zone.
+func (e *MPE) Connect() {
+	channels := newChannelAllocator(e.Zone.Members)
+	latest := make(map[int]noteID) // The most recently pressed sounding note received on each channel.
+	release := func(id noteID, velocity int) []Message {
+		channel, ok := channels.release(id)
+		if !ok {
+			return nil
+		}
+		if latest[id.channel] == id {
+			delete(latest, id.channel)
+		}
+		return []Message{NoteOff{channel, id.key, velocity}}
+	}
+	// Returns the member channel of the latest note received on a channel, or the master channel.
+	target := func(channel int) int {
+		if id, ok := latest[channel]; ok && channel != e.Zone.Master {
+			return channels.sounding[id]
+		}
+		return e.Zone.Master
+	}
+	e.process(func(m Message) []Message {
+		switch n := m.(type) {
+		case NoteOn:
+			id := noteID{n.Channel, n.Key}
+			if n.Velocity == 0 {
+				return release(id, 0)
+			}
+			messages := release(id, 0) // A note pressed again is released first.
+			channel, stolen := channels.allocate(id)
+			if stolen != nil {
+				messages = append(messages, NoteOff{channel, stolen.key, 0})
+				if latest[stolen.channel] == *stolen {
+					delete(latest, stolen.channel)
+				}
+			}
+			if channel < 0 {
+				return messages
+			}
+			latest[n.Channel] = id
+			return append(messages, PitchBend{channel, 0}, ChannelPressure{channel, 0},
+				NoteOn{channel, n.Key, n.Velocity})
+		case NoteOff:
+			return release(noteID{n.Channel, n.Key}, n.Velocity)
+		}
+		if channel, ok := getChannel(m); ok {
+			return []Message{setChannel(m, target(channel))}
+		}
+		return []Message{m}
+	})
+}
+
+// An MPECollapser plays the notes of MPE zones on a single channel, for devices without MPE.
+// As a channel has one pitch bend and pressure, those of the most recently pressed
+// sounding note are applied to all notes.
+// Implements Device.
+type MPECollapser struct {
+	processor
+	Channel int // The channel to play all notes on.
+}
+
+// Creates a new MPECollapser playing all notes on a channel.
+func NewMPECollapser(channel int) *MPECollapser {
+	return &MPECollapser{
+		processor: newProcessor(),
+		Channel:   channel,
+	}
+}
+
+// Begins collapsing MPE. When the most recently pressed note is released, the pitch bend and
+// pressure of the next most recently pressed sounding note (if any) are restored.
+// All other channel messages are moved onto the channel, and other MIDI data is passed through.
+func (c *MPECollapser) Connect() {
+	var order []noteID                         // Sounding notes, oldest first.
+	bends := make(map[int]PitchBend)           // The latest pitch bend of each channel.
+	pressures := make(map[int]ChannelPressure) // The latest pressure of each channel.
+	current := func() (int, bool) {
+		if len(order) == 0 {
+			return 0, false
+		}
+		return order[len(order)-1].channel, true
+	}
+	// Returns the pitch bend and pressure of a channel, moved to the collapsed channel.
+	expression := func(channel int) []Message {
+		return []Message{PitchBend{c.Channel, bends[channel].Value},
+			ChannelPressure{c.Channel, pressures[channel].Pressure}}
+	}
+	release := func(id noteID, m Message) []Message {
+		before, _ := current()
+		for i, sounding := range order {
+			if sounding == id {
+				order = append(order[:i], order[i+1:]...)
+				break
+			}
+		}
+		messages := []Message{setChannel(m, c.Channel)}
+		if after, ok := current(); ok && after != before {
+			messages = append(messages, expression(after)...)
+		}
+		return messages
+	}
+	c.process(func(m Message) []Message {
+		switch n := m.(type) {
+		case NoteOn:
+			id := noteID{n.Channel, n.Key}
+			if n.Velocity == 0 {
+				return release(id, m)
+			}
+			order = append(order, id)
+			return append(expression(n.Channel), setChannel(m, c.Channel))
+		case NoteOff:
+			return release(noteID{n.Channel, n.Key}, m)
+		case PitchBend:
+			bends[n.Channel] = n
+			if channel, ok := current(); ok && channel != n.Channel {
+				return nil // Not the bend of the most recent note.
+			}
+		case ChannelPressure:
+			pressures[n.Channel] = n
+			if channel, ok := current(); ok && channel != n.Channel {
+				return nil
+			}
+		}
+		if _, ok := getChannel(m); ok {
+			return []Message{setChannel(m, c.Channel)}
+		}
+		return []Message{m}
+	})
+}
@@ -0,0 +1,118 @@
+package midi
+
+/*
+A NetDevice transmits MIDI data between machines as UDP datagrams.
+Each datagram holds one or more messages, encoded as they are sent over the
+wire (optionally using running status), so any program that can send raw
+MIDI bytes over UDP can interoperate with a NetDevice.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+const maxDatagramSize = 1024
+
+// Represents a MIDI device on a network, implements Device.
+type NetDevice struct {
+	*Wires
+	LocalAddr  string // The address to receive MIDI data on, as "host:port".
+	RemoteAddr string // The address to send MIDI data to, as "host:port".
+	conn       *net.UDPConn
+	remote     *net.UDPAddr
+	disconnect *disconnection
+}
+
+// Creates a new network device that receives MIDI data at a local address and
+// sends MIDI data to a remote address. Either address may be empty to only send
+// or only receive, and a local port of 0 picks any available port.
+func NewNetDevice(localAddr, remoteAddr string) *NetDevice {
+	return &NetDevice{
+		Wires:      NewWires(),
+		LocalAddr:  localAddr,
+		RemoteAddr: remoteAddr,
+		disconnect: newDisconnection(),
+	}
+}
+
+// Opens the network connection.
+func (n *NetDevice) Open() error {
+	var err error
+	local := &net.UDPAddr{}
+	if n.LocalAddr != "" {
+		if local, err = net.ResolveUDPAddr("udp", n.LocalAddr); err != nil {
+			return err
+		}
+	}
+	if n.RemoteAddr != "" {
+		if n.remote, err = net.ResolveUDPAddr("udp", n.RemoteAddr); err != nil {
+			return err
+		}
+	}
+	n.conn, err = net.ListenUDP("udp", local)
+	return err
+}
+
+// Returns the address MIDI data is received on, once opened.
+func (n *NetDevice) Addr() net.Addr {
+	if n.conn == nil {
+		return nil
+	}
+	return n.conn.LocalAddr()
+}
+
+// Ends transmission of MIDI data and closes the network connection.
+func (n *NetDevice) Close() error {
+	if n.conn == nil {
+		return errors.New("Network device is not open.")
+	}
+	n.disconnect.disconnect()
+	return n.conn.Close()
+}
+
+// Begins transmission of MIDI data over the network.
+func (n *NetDevice) Connect() {
+	go n.receive()
+	go n.send()
+}
+
+// Sends messages inbound to the device to the remote address.
+func (n *NetDevice) send() {
+	done := n.disconnect.done()
+	for {
+		select {
+		case m := <-n.In:
+			if n.remote == nil {
+				continue
+			}
+			if _, err := n.conn.WriteToUDP(m.Encode(), n.remote); err != nil {
+				fmt.Printf("Could not send MIDI message %v: %v\n", m, err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// Receives messages from the network, outbound from the device.
+func (n *NetDevice) receive() {
+	var d Decoder
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		size, _, err := n.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return // The connection was closed.
+		}
+		messages, err := d.Decode(buffer[:size])
+		if err != nil {
+			fmt.Printf("Invalid MIDI data received and ignored: %v\n", err)
+		}
+		for _, m := range messages {
+			if !send(n.Out, m, n.disconnect.done()) {
+				return
+			}
+		}
+	}
+}
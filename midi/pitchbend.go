@@ -0,0 +1,149 @@
+package midi
+
+/*
+MIDI notes are limited to the 12 keys per octave of equal temperament.
+Other pitches are reached by bending notes, and as a pitch bend applies to an
+entire channel, each note is played on a distinct channel so that every note
+can be bent independently (as per MIDI Polyphonic Expression).
+*/
+
+import "math"
+
+// Distributes notes across channels, one note per channel, reusing the channel released
+// longest ago and, when every channel is sounding, taking the channel of the oldest note.
+type channelAllocator struct {
+	free     []int          // Channels without a sounding note, released longest ago first.
+	sounding map[noteID]int // The channel allocated to each sounding note.
+	order    []noteID       // Sounding notes, oldest first.
+}
+
+func newChannelAllocator(channels []int) *channelAllocator {
+	return &channelAllocator{
+		free:     append([]int(nil), channels...),
+		sounding: make(map[noteID]int),
+	}
+}
+
+// Allocates a channel to a note that is not sounding, returning the channel and the note whose channel was
+// taken (and which should be released), if any.
+func (a *channelAllocator) allocate(id noteID) (channel int, stolen *noteID) {
+	if len(a.free) == 0 && len(a.order) > 0 {
+		oldest := a.order[0]
+		a.release(oldest)
+		stolen = &oldest
+	}
+	if len(a.free) == 0 {
+		return -1, stolen
+	}
+	channel, a.free = a.free[0], a.free[1:]
+	a.sounding[id] = channel
+	a.order = append(a.order, id)
+	return channel, stolen
+}
+
+// Releases the channel of a note, returning false if the note has no channel.
+func (a *channelAllocator) release(id noteID) (channel int, ok bool) {
+	channel, ok = a.sounding[id]
+	if !ok {
+		return -1, false
+	}
+	delete(a.sounding, id)
+	for i, sounding := range a.order {
+		if sounding == id {
+			a.order = append(a.order[:i], a.order[i+1:]...)
+			break
+		}
+	}
+	a.free = append(a.free, channel)
+	return channel, true
+}
+
+// Returns the pitch bend value bending a number of cents, for a pitch bend range in semitones,
+// clamped to the range of pitch bend values.
+func pitchBendValue(cents, bendRange float64) int {
+	v := int(math.Floor(cents/(100*bendRange)*8192 + 0.5))
+	switch {
+	case v < -8192:
+		return -8192
+	case v > 8191:
+		return 8191
+	}
+	return v
+}
+
+// A PitchBendTransposer tunes notes by fractions of semitones, such as for microtonal scales
+// or just intonation, by playing the nearest key with a pitch bend to the exact pitch.
+// Each note sounds on a channel of its own, so that notes can be bent independently.
+// Implements Device.
+type PitchBendTransposer struct {
+	processor
+	Cents     map[int]float64 // Cents (hundredths of semitones) to tune each key by, such as -13.7 for a just major third.
+	BendRange float64         // The pitch bend range of the receiving device, in semitones.
+	Channels  []int           // The channels notes are distributed across.
+}
+
+// Creates a new PitchBendTransposer tuning keys by cents, for a receiving device with the
+// usual pitch bend range of 2 semitones, distributing notes across channels 1 through 15
+// (leaving channel 0, as per the lower zone of MIDI Polyphonic Expression).
+func NewPitchBendTransposer(centsMap map[int]float64) *PitchBendTransposer {
+	channels := make([]int, 15)
+	for i := range channels {
+		channels[i] = i + 1
+	}
+	return &PitchBendTransposer{
+		processor: newProcessor(),
+		Cents:     centsMap,
+		BendRange: 2,
+		Channels:  channels,
+	}
+}
+
+// Begins tuning notes. Each NoteOn is preceded by a PitchBend on the channel allocated to the note,
+// and the note is released on that channel. A note pressed when every channel is sounding takes
+// the channel of the oldest note, which is released first. All other MIDI data is passed through untouched.
+func (p *PitchBendTransposer) Connect() {
+	channels := newChannelAllocator(p.Channels)
+	keys := make(map[noteID]int) // The keys played for sounding notes.
+	release := func(id noteID, velocity int) []Message {
+		channel, ok := channels.release(id)
+		if !ok {
+			return nil
+		}
+		key := keys[id]
+		delete(keys, id)
+		return []Message{NoteOff{channel, key, velocity}}
+	}
+	p.process(func(m Message) []Message {
+		switch n := m.(type) {
+		case NoteOn:
+			id := noteID{n.Channel, n.Key}
+			if n.Velocity == 0 {
+				return release(id, 0)
+			}
+			var messages []Message
+			if _, ok := channels.sounding[id]; ok { // The note is pressed again; release it first.
+				messages = append(messages, release(id, 0)...)
+			}
+			channel, stolen := channels.allocate(id)
+			if stolen != nil {
+				messages = append(messages, NoteOff{channel, keys[*stolen], 0})
+				delete(keys, *stolen)
+			}
+			if channel < 0 {
+				return messages
+			}
+			pitch := 100*float64(n.Key) + p.Cents[n.Key]
+			key := int(math.Floor(pitch/100 + 0.5))
+			if key < 0 || key > 127 {
+				channels.release(id)
+				return messages
+			}
+			keys[id] = key
+			bend := pitchBendValue(pitch-100*float64(key), p.BendRange)
+			return append(messages, PitchBend{channel, bend}, NoteOn{channel, key, n.Velocity})
+		case NoteOff:
+			return release(noteID{n.Channel, n.Key}, n.Velocity)
+		}
+		return []Message{m}
+	})
+}
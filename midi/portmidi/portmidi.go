@@ -3,6 +3,7 @@ package portmidi
 
 // #cgo CFLAGS: -I/opt/local/include
 // #cgo LDFLAGS: -L/opt/local/lib -lportmidi
+// #include <stdlib.h>
 // #include <portmidi.h>
 import "C"
 import (
@@ -56,6 +57,40 @@ func NewStreamInfo(deviceID int) *StreamInfo {
 	}
 }
 
+// CreateVirtualInput makes a C call via portmidi to create an OS-level virtual
+// input stream that other applications can write to, returning its device ID.
+// Virtual streams require PortMidi 2.0 or newer and are supported by
+// CoreMIDI (OS X) and ALSA (Linux) but not by Windows.
+func CreateVirtualInput(name string) (deviceID int, err error) {
+	return createVirtual(name, true)
+}
+
+// CreateVirtualOutput makes a C call via portmidi to create an OS-level virtual
+// output stream that other applications can read from, returning its device ID.
+func CreateVirtualOutput(name string) (deviceID int, err error) {
+	return createVirtual(name, false)
+}
+
+func createVirtual(name string, isInput bool) (int, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	var id C.PmError
+	if isInput {
+		id = C.Pm_CreateVirtualInput(cName, nil, nil)
+	} else {
+		id = C.Pm_CreateVirtualOutput(cName, nil, nil)
+	}
+	if id < 0 {
+		return -1, newError(id)
+	}
+	return int(id), nil
+}
+
+// DeleteVirtual makes a C call via portmidi to remove a closed virtual stream.
+func DeleteVirtual(deviceID int) error {
+	return newError(C.Pm_DeleteVirtualDevice(C.PmDeviceID(deviceID)))
+}
+
 type Output struct {
 	deviceID C.PmDeviceID
 	stream   unsafe.Pointer
@@ -12,56 +12,81 @@ that the OS uses to transfer data to them.
 import (
 	"fmt"
 	"github.com/aoeu/audio/midi/portmidi"
+	"sync"
 	"time"
 )
 
+// Ports are safe to open, close, and connect from different goroutines.
 type Port struct {
+	mu         *sync.Mutex
 	isOpen     bool
 	messages   chan Message
-	disconnect chan bool
+	disconnect chan bool // Closed when the port is closed.
 }
 
 func NewPort(isOpen bool) *Port {
 	return &Port{
+		mu:         new(sync.Mutex),
 		isOpen:     isOpen,
 		messages:   make(chan Message, BufferSize),
-		disconnect: make(chan bool, 1),
+		disconnect: make(chan bool),
 	}
 }
 
 func (p *Port) Open() error {
-	p.isOpen = true
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.isOpen {
+		p.isOpen = true
+		p.disconnect = make(chan bool)
+	}
 	return nil
 }
 
+// Closes the port, signalling its connection to stop. Closing a closed port does nothing.
+// The messages channel is left open so concurrent senders do not panic.
 func (p *Port) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if p.isOpen {
 		p.isOpen = false
-		p.disconnect <- true
-		close(p.messages)
+		close(p.disconnect)
 	}
 	return nil
 }
 
+// Reports whether the port is open.
+func (p *Port) opened() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isOpen
+}
+
+// Returns a channel that is closed once the port is closed.
+func (p *Port) done() <-chan bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.disconnect
+}
+
 func (p *Port) Connect() {}
 
 type SystemPort struct {
-	Port
+	*Port
 	id int
 }
 
-func (s *SystemPort) Close() error {
-	if s.isOpen {
-		s.isOpen = false
-		s.disconnect <- true
-		close(s.messages)
-	}
-	return nil
-}
-
 type SystemInPort struct {
 	SystemPort
 	*portmidi.Output
+	mu sync.Mutex // Serializes writes to the system's MIDI stream.
+}
+
+// Writes a message to the system's MIDI stream.
+func (s *SystemInPort) write(m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Output.Write(m)
 }
 
 func (s *SystemInPort) Close() error {
@@ -70,24 +95,25 @@ func (s *SystemInPort) Close() error {
 }
 
 func (s *SystemInPort) Open() error {
-	if s.isOpen {
+	if s.opened() {
 		return nil
 	}
 	err := s.Output.Open()
 	if err == nil {
-		s.isOpen = true
+		s.Port.Open()
 	}
 	return err
 }
 
-func (s SystemInPort) Connect() {
+func (s *SystemInPort) Connect() {
+	done := s.done()
 	for {
 		select {
 		case m := <-s.messages:
-			if err := s.Output.Write(m); err != nil {
+			if err := s.write(m); err != nil {
 				panic(err)
 			}
-		case <-s.disconnect:
+		case <-done:
 			return
 		}
 	}
@@ -99,20 +125,24 @@ type SystemOutPort struct {
 }
 
 func (s *SystemOutPort) Open() error {
-	if s.isOpen {
+	if s.opened() {
 		return nil
 	}
 	err := s.Input.Open()
 	if err == nil {
-		s.isOpen = true
+		s.Port.Open()
 	}
 	return err
 }
 
+// Reads MIDI data from the system until the port is closed, decoding messages
+// that use running status with the last status byte received by the port.
 func (s SystemOutPort) Connect() {
+	done := s.done()
+	var d Decoder
 	for {
 		select {
-		case <-s.disconnect:
+		case <-done:
 			return
 		default:
 			dataAvailable, err := s.Input.Poll()
@@ -123,21 +153,20 @@ func (s SystemOutPort) Connect() {
 				time.Sleep(1 * time.Millisecond)
 				continue
 			}
-			m := newMessage(s.Input.Read())
-			switch m.Command {
-			case NOTE_ON:
-				s.messages <- NoteOn{m.Channel, m.Data1, m.Data2}
-			case NOTE_OFF:
-				// A NoteOn with velocity 0 (Data2) is arguably a Note Off.
-				s.messages <- NoteOff{m.Channel, m.Data1, 0}
-			case CONTROL_CHANGE:
-				name, ok := ControlChangeNames[m.Data1]
-				if !ok {
-					name = "Unknown"
+			e := s.Input.Read()
+			if e == 0 {
+				continue
+			}
+			messages, err := d.decodeEvent(e)
+			if err != nil {
+				fmt.Printf("Unknown message type received and ignored: %v", err)
+			}
+			for _, m := range messages {
+				select {
+				case s.messages <- m:
+				case <-done:
+					return
 				}
-				s.messages <- ControlChange{m.Channel, m.Data1, m.Data2, name}
-			default:
-				fmt.Printf("Unknown message type received and ignored: %+v", m)
 			}
 		}
 	}
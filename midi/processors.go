@@ -0,0 +1,730 @@
+package midi
+
+/*
+Processors are "fake" devices, like the Transposer, that can be piped or
+chained to other devices in order to manipulate the MIDI data coming through
+them. A processor's In receives MIDI data and its Out sends the manipulated
+MIDI data onward.
+*/
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A bypass switch passes MIDI data through a device untouched while on,
+// like the switch of an effect pedal.
+type bypass struct {
+	mu sync.Mutex
+	on bool
+}
+
+// Turns the bypass on or off, which is safe to do while the device is connected.
+// Notes pressed before the bypass is toggled are released as they were pressed,
+// so that notes are not left hanging.
+func (b *bypass) SetBypass(on bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.on = on
+}
+
+// Returns whether MIDI data is passed through the device untouched.
+func (b *bypass) Bypassed() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.on
+}
+
+// Returns whether a message bypasses the device. Releases of notes bypass the device
+// only if their NoteOns did, as recorded of each sounding note in pressed.
+func (b *bypass) bypasses(m Message, pressed map[noteID]bool) bool {
+	on := b.Bypassed()
+	var id noteID
+	switch n := m.(type) {
+	case NoteOn:
+		id = noteID{n.Channel, n.Key}
+		if n.Velocity > 0 {
+			pressed[id] = on
+			return on
+		}
+	case NoteOff:
+		id = noteID{n.Channel, n.Key}
+	default:
+		return on
+	}
+	if was, ok := pressed[id]; ok {
+		delete(pressed, id)
+		return was
+	}
+	return on
+}
+
+// The ports and wires shared by processors.
+type processor struct {
+	in  *Port
+	out *Port
+	*Wires
+	*bypass
+}
+
+func newProcessor() processor {
+	return processor{
+		in:     NewPort(false),
+		out:    NewPort(false),
+		Wires:  NewWires(),
+		bypass: new(bypass),
+	}
+}
+
+func (p *processor) Open() error {
+	if err := p.in.Open(); err != nil {
+		return err
+	}
+	return p.out.Open()
+}
+
+func (p processor) Close() error {
+	if err := p.in.Close(); err != nil {
+		return err
+	}
+	return p.out.Close()
+}
+
+// Returns a channel that is closed once the processor is closed.
+func (p processor) done() <-chan bool {
+	return p.in.done()
+}
+
+// Sends each message received through a function, and the resulting messages
+// onward, until the processor is closed. Messages are sent onward untouched
+// while the processor is bypassed.
+func (p processor) process(fn func(Message) []Message) {
+	done := p.done()
+	pressed := make(map[noteID]bool) // Whether each sounding note bypassed the processor.
+	for {
+		select {
+		case m := <-p.In:
+			results := []Message{m}
+			if !p.bypasses(m, pressed) {
+				results = fn(m)
+			}
+			for _, result := range results {
+				if !send(p.Out, result, done) {
+					return
+				}
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// A Quantizer delays notes so that they land on a rhythmic grid.
+// Implements Device.
+type Quantizer struct {
+	processor
+	mu       sync.Mutex
+	bpm      float64 // Tempo, in quarter notes per minute.
+	division int     // Notes per bar of the grid, such as 16 for sixteenth notes.
+	start    time.Time
+	now      func() time.Time
+}
+
+// Creates a new Quantizer with a grid of the specified tempo and divisions,
+// such as NewQuantizer(120, 16) to quantize to sixteenth notes at 120 BPM.
+// To always land a note on the nearest grid position, rather than only later ones,
+// all notes are delayed by a look-ahead of half a grid interval.
+// A tempo or division that isn't positive defaults to 120 BPM or sixteenth notes.
+func NewQuantizer(bpm float64, division int) *Quantizer {
+	if bpm <= 0 {
+		bpm = 120
+	}
+	if division <= 0 {
+		division = 16
+	}
+	return &Quantizer{
+		processor: newProcessor(),
+		bpm:       bpm,
+		division:  division,
+		now:       time.Now,
+	}
+}
+
+// Returns the tempo of the grid, in quarter notes per minute.
+func (q *Quantizer) Tempo() float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.bpm
+}
+
+// Sets the tempo of the grid in quarter notes per minute, which must be positive,
+// taking effect for the next note quantized.
+func (q *Quantizer) SetTempo(bpm float64) error {
+	if bpm <= 0 {
+		return fmt.Errorf("Tempo must be positive, not %v BPM.", bpm)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.bpm = bpm
+	return nil
+}
+
+// Returns the notes per bar of the grid.
+func (q *Quantizer) Division() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.division
+}
+
+// Sets the notes per bar of the grid, which must be positive,
+// taking effect for the next note quantized.
+func (q *Quantizer) SetDivision(division int) error {
+	if division <= 0 {
+		return fmt.Errorf("Division must be positive, not %v.", division)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.division = division
+	return nil
+}
+
+// Returns the duration between positions of the grid.
+func (q *Quantizer) interval() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	quarterNote := time.Duration(float64(time.Minute) / q.bpm)
+	return quarterNote * 4 / time.Duration(q.division)
+}
+
+// Returns how long to delay a note played at a time so it lands on the grid.
+func (q *Quantizer) delay(t time.Time) time.Duration {
+	interval := q.interval()
+	elapsed := t.Sub(q.start)
+	nearest := time.Duration(math.Floor(float64(elapsed)/float64(interval)+0.5)) * interval
+	return nearest - elapsed + interval/2
+}
+
+// A message to be sent at a later time.
+type scheduledMessage struct {
+	at time.Time
+	m  Message
+}
+
+// Sends scheduled messages onward at their scheduled times, in order of time,
+// and in the order they were scheduled for equal times, until done.
+func sendScheduled(out chan<- Message, schedule <-chan scheduledMessage, done <-chan bool) {
+	var pending []scheduledMessage // Sorted by time.
+	for {
+		var due <-chan time.Time
+		if len(pending) > 0 {
+			due = time.After(pending[0].at.Sub(time.Now()))
+		}
+		select {
+		case s := <-schedule:
+			i := sort.Search(len(pending), func(i int) bool { return pending[i].at.After(s.at) })
+			pending = append(pending, scheduledMessage{})
+			copy(pending[i+1:], pending[i:])
+			pending[i] = s
+		case <-due:
+			if !send(out, pending[0].m, done) {
+				return
+			}
+			pending = pending[1:]
+		case <-done:
+			return
+		}
+	}
+}
+
+// Begins quantizing MIDI data. The grid starts when connected.
+// NoteOffs are delayed as much as their NoteOns to preserve the length of notes,
+// while all other MIDI data is sent onward without delay.
+func (q *Quantizer) Connect() {
+	q.start = q.now()
+	delays := make(map[noteID]time.Duration) // How long each sounding note was delayed.
+	schedule := make(chan scheduledMessage)
+	done := q.done()
+	go sendScheduled(q.Out, schedule, done)
+	later := func(m Message, d time.Duration) []Message {
+		select {
+		case schedule <- scheduledMessage{q.now().Add(d), m}:
+		case <-done:
+		}
+		return nil
+	}
+	q.process(func(m Message) []Message {
+		switch n := m.(type) {
+		case NoteOn:
+			id := noteID{n.Channel, n.Key}
+			if n.Velocity == 0 {
+				defer delete(delays, id)
+				return later(m, delays[id])
+			}
+			delays[id] = q.delay(q.now())
+			return later(m, delays[id])
+		case NoteOff:
+			id := noteID{n.Channel, n.Key}
+			defer delete(delays, id)
+			return later(m, delays[id])
+		}
+		return []Message{m}
+	})
+}
+
+// A Chorder plays a chord for each note, adding notes at intervals above it.
+// Implements Device.
+type Chorder struct {
+	processor
+	Intervals []int // Semitones above each note to add notes at, such as {4, 7} for a major triad.
+}
+
+// Creates a new Chorder adding notes at the specified intervals (in semitones).
+func NewChorder(intervals []int) *Chorder {
+	return &Chorder{
+		processor: newProcessor(),
+		Intervals: intervals,
+	}
+}
+
+// Begins playing chords. Added notes share the channel and velocity of the note played,
+// and are released along with it, as they were when it was pressed.
+// Notes beyond the range of MIDI keys are not added.
+func (c *Chorder) Connect() {
+	chords := make(map[noteID][]int) // The keys played for each pressed note.
+	release := func(id noteID, m func(key int) Message) []Message {
+		keys, ok := chords[id]
+		if !ok {
+			keys = []int{id.key}
+		}
+		delete(chords, id)
+		messages := make([]Message, len(keys))
+		for i, key := range keys {
+			messages[i] = m(key)
+		}
+		return messages
+	}
+	c.process(func(m Message) []Message {
+		switch n := m.(type) {
+		case NoteOn:
+			id := noteID{n.Channel, n.Key}
+			if n.Velocity == 0 {
+				return release(id, func(key int) Message { return NoteOn{n.Channel, key, 0} })
+			}
+			keys := []int{n.Key}
+			for _, interval := range c.Intervals {
+				if key := n.Key + interval; key >= 0 && key <= 127 && interval != 0 {
+					keys = append(keys, key)
+				}
+			}
+			chords[id] = keys
+			messages := make([]Message, len(keys))
+			for i, key := range keys {
+				messages[i] = NoteOn{n.Channel, key, n.Velocity}
+			}
+			return messages
+		case NoteOff:
+			return release(noteID{n.Channel, n.Key}, func(key int) Message {
+				return NoteOff{n.Channel, key, n.Velocity}
+			})
+		}
+		return []Message{m}
+	})
+}
+
+// An OctaveShifter transposes notes by a number of octaves.
+// Implements Device.
+type OctaveShifter struct {
+	processor
+	Octaves int // Octaves to shift notes up by, or down by for negative values.
+}
+
+// Creates a new OctaveShifter that shifts the keys of notes by 12 semitones per octave.
+func NewOctaveShifter(octaves int) *OctaveShifter {
+	return &OctaveShifter{
+		processor: newProcessor(),
+		Octaves:   octaves,
+	}
+}
+
+// Begins shifting notes. Notes are released with the key they were shifted to
+// when pressed, and notes shifted beyond the range of MIDI keys are dropped.
+func (o *OctaveShifter) Connect() {
+	sounding := make(map[noteID]int) // Shifted keys of pressed notes.
+	release := func(id noteID) (int, bool) {
+		key, ok := sounding[id]
+		if !ok {
+			key = id.key + 12*o.Octaves
+		}
+		delete(sounding, id)
+		return key, key >= 0 && key <= 127
+	}
+	o.process(func(m Message) []Message {
+		switch n := m.(type) {
+		case NoteOn:
+			id := noteID{n.Channel, n.Key}
+			if n.Velocity == 0 {
+				if key, ok := release(id); ok {
+					return []Message{NoteOn{n.Channel, key, 0}}
+				}
+				return nil
+			}
+			key := n.Key + 12*o.Octaves
+			sounding[id] = key // Even if dropped, so the note's release is too.
+			if key < 0 || key > 127 {
+				return nil
+			}
+			return []Message{NoteOn{n.Channel, key, n.Velocity}}
+		case NoteOff:
+			if key, ok := release(noteID{n.Channel, n.Key}); ok {
+				return []Message{NoteOff{n.Channel, key, n.Velocity}}
+			}
+			return nil
+		}
+		return []Message{m}
+	})
+}
+
+// A VelocityCurveKind maps the velocity of a pressed note (from 1 to 127) to a new velocity.
+type VelocityCurveKind func(velocity int) int
+
+// Returns a velocity curve raising velocities to a power, which clamps results
+// to the range of velocities of pressed notes.
+func velocityPower(exponent float64) VelocityCurveKind {
+	return func(velocity int) int {
+		return clampVelocity(int(127*math.Pow(float64(velocity)/127, exponent) + 0.5))
+	}
+}
+
+// Returns a velocity clamped to the range of velocities of pressed notes.
+func clampVelocity(velocity int) int {
+	switch {
+	case velocity < 1:
+		return 1
+	case velocity > 127:
+		return 127
+	}
+	return velocity
+}
+
+// Presets for velocity curves.
+var (
+	Linear VelocityCurveKind = func(velocity int) int { return velocity } // Leaves velocities unchanged.
+	Soft                     = velocityPower(0.5)                         // Makes soft playing louder.
+	Hard                     = velocityPower(2)                           // Requires hard playing to be loud.
+)
+
+// Returns a velocity curve that plays every note at the same velocity.
+func Fixed(velocity int) VelocityCurveKind {
+	velocity = clampVelocity(velocity)
+	return func(int) int { return velocity }
+}
+
+// A VelocityCurve shapes the dynamics of notes by mapping their velocities.
+// Implements Device.
+type VelocityCurve struct {
+	processor
+	Curve VelocityCurveKind
+}
+
+// Creates a new VelocityCurve mapping velocities with a curve, such as a preset
+// (Linear, Soft, Hard, or Fixed) or any other function.
+func NewVelocityCurve(curve VelocityCurveKind) *VelocityCurve {
+	return &VelocityCurve{
+		processor: newProcessor(),
+		Curve:     curve,
+	}
+}
+
+// Begins mapping the velocities of NoteOns, passing all other MIDI data
+// (including NoteOns without velocity, which release notes) through untouched.
+func (v *VelocityCurve) Connect() {
+	v.process(func(m Message) []Message {
+		if n, ok := m.(NoteOn); ok && n.Velocity > 0 && v.Curve != nil {
+			n.Velocity = clampVelocity(v.Curve(n.Velocity))
+			return []Message{n}
+		}
+		return []Message{m}
+	})
+}
+
+// Returns a function for processing MIDI data that moves each note to the channel
+// chosen for it when pressed, releasing the note on the same channel even if it would
+// since be routed elsewhere. All other MIDI data is passed through untouched.
+func routeNotes(route func(NoteOn) int) func(Message) []Message {
+	sounding := make(map[noteID]int) // Channels that pressed notes were routed to.
+	release := func(id noteID) int {
+		channel, ok := sounding[id]
+		if !ok {
+			channel = id.channel // Notes pressed before routing began are released where they are.
+		}
+		delete(sounding, id)
+		return channel
+	}
+	return func(m Message) []Message {
+		switch n := m.(type) {
+		case NoteOn:
+			id := noteID{n.Channel, n.Key}
+			if n.Velocity == 0 {
+				return []Message{NoteOn{release(id), n.Key, 0}}
+			}
+			channel := route(n)
+			sounding[id] = channel
+			return []Message{NoteOn{channel, n.Key, n.Velocity}}
+		case NoteOff:
+			return []Message{NoteOff{release(noteID{n.Channel, n.Key}), n.Key, n.Velocity}}
+		}
+		return []Message{m}
+	}
+}
+
+// A VelocitySplit routes notes to different channels by how hard they are played,
+// such as to layer a soft and a hard sample of a drum (velocity switching).
+// Implements Device.
+type VelocitySplit struct {
+	processor
+	Thresholds []int // The lowest velocity of each bracket after the first, in ascending order.
+	Channels   []int // The channel of each bracket, one more than the thresholds.
+}
+
+// Creates a new VelocitySplit routing notes with velocities below the first threshold
+// to the first channel, those below the second threshold to the second channel, and so on,
+// such as NewVelocitySplit([]int{64}, []int{0, 1}) to split soft and hard notes at 64.
+func NewVelocitySplit(thresholds []int, channels []int) *VelocitySplit {
+	return &VelocitySplit{
+		processor:  newProcessor(),
+		Thresholds: thresholds,
+		Channels:   channels,
+	}
+}
+
+// Returns the channel of the bracket for a velocity, or the channel the note was played on
+// if there is no channel for the bracket.
+func (v *VelocitySplit) channel(n NoteOn) int {
+	bracket := 0
+	for bracket < len(v.Thresholds) && n.Velocity >= v.Thresholds[bracket] {
+		bracket++
+	}
+	if bracket >= len(v.Channels) {
+		return n.Channel
+	}
+	return v.Channels[bracket]
+}
+
+// Begins splitting notes by velocity. Notes are released on the channel they were routed to
+// when pressed, and all other MIDI data is passed through untouched.
+func (v *VelocitySplit) Connect() {
+	v.process(routeNotes(v.channel))
+}
+
+// A KeySplit routes notes to one of two channels by key, such as to play bass
+// with the left hand and a lead with the right hand of an organ-style split keyboard.
+// Implements Device.
+type KeySplit struct {
+	processor
+	SplitPoint  int // The lowest key routed to the high channel.
+	LowChannel  int
+	HighChannel int
+}
+
+// Creates a new KeySplit routing notes below the split point to a low channel
+// and all other notes to a high channel.
+func NewKeySplit(splitPoint int, lowChannel, highChannel int) *KeySplit {
+	return &KeySplit{
+		processor:   newProcessor(),
+		SplitPoint:  splitPoint,
+		LowChannel:  lowChannel,
+		HighChannel: highChannel,
+	}
+}
+
+// Returns the channel to route a note to by its key.
+func (k *KeySplit) channel(n NoteOn) int {
+	if n.Key < k.SplitPoint {
+		return k.LowChannel
+	}
+	return k.HighChannel
+}
+
+// Begins splitting notes by key. Notes are released on the channel they were routed to
+// when pressed, even if the split point has changed since, and all other MIDI data
+// is passed through untouched.
+func (k *KeySplit) Connect() {
+	k.process(routeNotes(k.channel))
+}
+
+// The number of messages a Tap holds for its callback before dropping messages.
+const tapBufferSize = 64
+
+// A Tap passes all MIDI data through untouched, while also handing each message to a callback,
+// such as for logging or metering, like the tee command. The callback runs on its own goroutine
+// so that it never delays MIDI data; if it falls too far behind, messages are dropped from it.
+// Implements Device.
+type Tap struct {
+	processor
+	Observe  func(Message)
+	observed chan Message
+	mu       sync.Mutex
+	dropped  int
+}
+
+// Creates a new Tap handing messages to a callback.
+func NewTap(observe func(Message)) *Tap {
+	return &Tap{
+		processor: newProcessor(),
+		Observe:   observe,
+		observed:  make(chan Message, tapBufferSize),
+	}
+}
+
+// Returns the number of messages passed through without being handed to the callback,
+// as it was too far behind.
+func (t *Tap) Dropped() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// Begins passing MIDI data through, and handing it to the callback, until closed.
+func (t *Tap) Connect() {
+	done := t.done()
+	go func() {
+		for {
+			select {
+			case m := <-t.observed:
+				if t.Observe != nil {
+					t.Observe(m)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	t.process(func(m Message) []Message {
+		select {
+		case t.observed <- m:
+		default:
+			t.mu.Lock()
+			t.dropped++
+			t.mu.Unlock()
+		}
+		return []Message{m}
+	})
+}
+
+// The number of messages a RateLimiter holds, unless created otherwise.
+const DefaultRateLimiterBufferSize = 256
+
+// A RateLimiter paces MIDI data to a maximum number of messages per second, holding
+// bursts of messages to send at the maximum rate, so that devices that can't keep up
+// with dense MIDI data aren't overwhelmed. Once it holds as many messages as it can,
+// the oldest held message other than a note (such as a Control Change) is dropped
+// for each message received, so that notes are never dropped; if it holds only notes,
+// messages aren't received until one is sent.
+// Implements Device.
+type RateLimiter struct {
+	processor
+	MaxPerSecond float64 // Messages are passed on without pacing at a rate of 0 or less.
+	BufferSize   int     // The number of messages held before dropping messages.
+	mu           sync.Mutex
+	dropped      int
+}
+
+// Creates a new RateLimiter pacing MIDI data to a maximum number of messages per second,
+// holding up to DefaultRateLimiterBufferSize messages.
+func NewRateLimiter(maxPerSecond float64) *RateLimiter {
+	return &RateLimiter{
+		processor:    newProcessor(),
+		MaxPerSecond: maxPerSecond,
+		BufferSize:   DefaultRateLimiterBufferSize,
+	}
+}
+
+// Returns the number of messages dropped while the RateLimiter held as many as it can.
+func (r *RateLimiter) Dropped() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// Returns the time between messages sent at the maximum rate.
+func (r *RateLimiter) interval() time.Duration {
+	if r.MaxPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / r.MaxPerSecond)
+}
+
+// Returns the offset of the oldest message other than a note, or -1 if there is none.
+func oldestDroppable(messages []Message) int {
+	for i, m := range messages {
+		switch m.(type) {
+		case NoteOn, NoteOff:
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+// Begins pacing MIDI data until closed.
+func (r *RateLimiter) Connect() {
+	done := r.done()
+	received := make(chan Message)
+	go r.pace(received, done)
+	r.process(func(m Message) []Message {
+		select {
+		case received <- m:
+		case <-done:
+		}
+		return nil
+	})
+}
+
+// Sends the messages received onward at no more than the maximum rate, until done.
+func (r *RateLimiter) pace(received <-chan Message, done <-chan bool) {
+	var held []Message // In order of receipt.
+	var last time.Time // When the last message was sent.
+	size := r.BufferSize
+	if size < 1 {
+		size = 1
+	}
+	for {
+		in := received
+		if len(held) >= size && oldestDroppable(held) < 0 {
+			in = nil // Holding only notes, until one is sent.
+		}
+		var due <-chan time.Time
+		var out chan<- Message
+		var next Message
+		if len(held) > 0 {
+			if wait := last.Add(r.interval()).Sub(time.Now()); wait > 0 {
+				due = time.After(wait)
+			} else {
+				out, next = r.Out, held[0]
+			}
+		}
+		select {
+		case m := <-in:
+			if len(held) >= size {
+				i := oldestDroppable(held)
+				held = append(held[:i], held[i+1:]...)
+				r.mu.Lock()
+				r.dropped++
+				r.mu.Unlock()
+			}
+			held = append(held, m)
+		case <-due:
+		case out <- next:
+			last = time.Now()
+			held = held[1:]
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package midi
+
+/*
+A SerialDevice transmits raw MIDI bytes over a serial port, such as to and
+from DIY synthesizers (Arduino, Teensy, etc.) or USB to MIDI DIN adapters.
+MIDI data received may use running status.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tarm/serial"
+	"io"
+)
+
+// Represents a MIDI device connected over a serial port, implements Device.
+type SerialDevice struct {
+	*Wires
+	Port       string // The name of the serial port, such as "/dev/ttyUSB0" or "COM3".
+	Baud       int    // The baud rate, usually 31250 for MIDI DIN or 115200 for USB serial.
+	conn       io.ReadWriteCloser
+	disconnect *disconnection
+}
+
+// Creates a new serial device and opens the serial port at the specified baud rate.
+func NewSerialDevice(port string, baud int) (*SerialDevice, error) {
+	if baud <= 0 {
+		return nil, fmt.Errorf("Baud rate %v is not positive.", baud)
+	}
+	conn, err := serial.OpenPort(&serial.Config{Name: port, Baud: baud})
+	if err != nil {
+		return nil, err
+	}
+	s := newStreamDevice(conn)
+	s.Port, s.Baud = port, baud
+	return s, nil
+}
+
+// Creates a new device transmitting MIDI data over a stream of bytes.
+func newStreamDevice(conn io.ReadWriteCloser) *SerialDevice {
+	return &SerialDevice{
+		Wires:      NewWires(),
+		conn:       conn,
+		disconnect: newDisconnection(),
+	}
+}
+
+// The serial port is opened when the serial device is created.
+func (s *SerialDevice) Open() error {
+	if s.conn == nil {
+		return errors.New("Serial device has no serial port.")
+	}
+	return nil
+}
+
+// Ends transmission of MIDI data and closes the serial port.
+func (s *SerialDevice) Close() error {
+	if s.conn == nil {
+		return errors.New("Serial device has no serial port.")
+	}
+	s.disconnect.disconnect()
+	return s.conn.Close()
+}
+
+// Begins transmission of MIDI data over the serial port.
+func (s *SerialDevice) Connect() {
+	go s.receive()
+	go s.send()
+}
+
+// Writes messages inbound to the device to the serial port.
+func (s *SerialDevice) send() {
+	done := s.disconnect.done()
+	for {
+		select {
+		case m := <-s.In:
+			if _, err := s.conn.Write(m.Encode()); err != nil {
+				fmt.Printf("Could not send MIDI message %v: %v\n", m, err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// Reads messages from the serial port, outbound from the device.
+func (s *SerialDevice) receive() {
+	var d Decoder
+	buffer := make([]byte, 128)
+	for {
+		size, err := s.conn.Read(buffer)
+		messages, decodeErr := d.Decode(buffer[:size])
+		if decodeErr != nil {
+			fmt.Printf("Invalid MIDI data received and ignored: %v\n", decodeErr)
+		}
+		for _, m := range messages {
+			if !send(s.Out, m, s.disconnect.done()) {
+				return
+			}
+		}
+		if err != nil {
+			return // The serial port was closed.
+		}
+	}
+}
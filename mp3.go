@@ -0,0 +1,39 @@
+package audio
+
+// MP3 decoding is provided by github.com/hajimehoshi/go-mp3,
+// a pure Go decoder, so no C libraries are required.
+
+import (
+	"github.com/hajimehoshi/go-mp3"
+	"io/ioutil"
+	"os"
+)
+
+// Creates a new clip from an MP3 file name.
+// The decoder always produces two channels, so clips of identical channels
+// (as mono files are decoded) are collapsed into a clip of one channel.
+func NewClipFromMP3(mp3FileName string) (*Clip, error) {
+	f, err := os.Open(mp3FileName)
+	if err != nil {
+		return new(Clip), err
+	}
+	defer f.Close()
+	d, err := mp3.NewDecoder(f)
+	if err != nil {
+		return new(Clip), err
+	}
+	// The decoder produces interlaced, little-endian, 16-bit stereo PCM data.
+	data, err := ioutil.ReadAll(d)
+	if err != nil {
+		return new(Clip), err
+	}
+	c, err := NewClipFromPCM(data[:len(data)-len(data)%4], d.SampleRate(), 2)
+	if err != nil {
+		return new(Clip), err
+	}
+	c.Name = mp3FileName
+	if c.IsMonoContent() {
+		return c.ChangeChannelCount(1)
+	}
+	return c, nil
+}
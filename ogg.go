@@ -0,0 +1,34 @@
+package audio
+
+// Ogg Vorbis decoding is provided by github.com/jfreymuth/oggvorbis,
+// a pure Go decoder, so no C libraries are required.
+
+import (
+	"github.com/jfreymuth/oggvorbis"
+	"os"
+)
+
+// Creates a new clip from an Ogg Vorbis file name.
+func NewClipFromOgg(oggFileName string) (*Clip, error) {
+	f, err := os.Open(oggFileName)
+	if err != nil {
+		return new(Clip), err
+	}
+	defer f.Close()
+	samples, format, err := oggvorbis.ReadAll(f)
+	if err != nil {
+		return new(Clip), err
+	}
+	c := NewClip(format.Channels)
+	c.Name = oggFileName
+	c.SampleRate = format.SampleRate
+	lenPerChannel := len(samples) / format.Channels
+	for chanNum := range c.Samples {
+		c.Samples[chanNum] = make([]int16, lenPerChannel)
+	}
+	// Deinterlace the decoded sample data into disparate slices.
+	for i := 0; i < lenPerChannel*format.Channels; i++ {
+		c.Samples[i%format.Channels][i/format.Channels] = floatToSample(samples[i])
+	}
+	return c, nil
+}
@@ -0,0 +1,104 @@
+package audio
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A RingClip holds the most recent audio written to it, up to a fixed length,
+// such as the last few seconds of a live input for a looper to capture.
+// Writes and snapshots are safe to make from different goroutines.
+type RingClip struct {
+	mu         sync.Mutex
+	samples    [][]int16 // Channels of samples, each wrapping around at its capacity.
+	start      int       // The offset of the oldest sample of each channel.
+	length     int       // The number of samples held per channel.
+	sampleRate int
+}
+
+// Creates a new, empty RingClip holding up to a number of samples per channel.
+func NewRingClip(maxSamplesPerChannel, numChannels, sampleRate int) *RingClip {
+	r := &RingClip{
+		samples:    make([][]int16, numChannels),
+		sampleRate: sampleRate,
+	}
+	for i := range r.samples {
+		r.samples[i] = make([]int16, maxSamplesPerChannel)
+	}
+	return r
+}
+
+// Appends samples to each channel, overwriting the oldest samples once the RingClip is full.
+// Every channel must be written the same number of samples.
+func (r *RingClip) Write(samples [][]int16) error {
+	if len(samples) != len(r.samples) {
+		return fmt.Errorf("Expected %d channels of samples instead of %d.", len(r.samples), len(samples))
+	}
+	n := 0
+	for chanNum, s := range samples {
+		if chanNum == 0 {
+			n = len(s)
+		} else if len(s) != n {
+			return fmt.Errorf("Expected %d samples on channel %d instead of %d.", n, chanNum, len(s))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	capacity := r.capacity()
+	if capacity == 0 {
+		return nil
+	}
+	skip := 0 // Samples that would be overwritten by the rest of the same write.
+	if n > capacity {
+		skip = n - capacity
+	}
+	end := (r.start + r.length) % capacity
+	for chanNum, s := range samples {
+		for i, at := skip, end; i < n; i++ {
+			r.samples[chanNum][at] = s[i]
+			if at++; at == capacity {
+				at = 0
+			}
+		}
+	}
+	r.length += n - skip
+	if r.length > capacity {
+		r.start = (r.start + r.length - capacity) % capacity
+		r.length = capacity
+	}
+	return nil
+}
+
+// Returns the number of samples the RingClip can hold per channel.
+func (r *RingClip) capacity() int {
+	if len(r.samples) == 0 {
+		return 0
+	}
+	return len(r.samples[0])
+}
+
+// Returns the number of samples per channel currently held.
+func (r *RingClip) LenPerChannel() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.length
+}
+
+// Returns a new clip of the samples currently held, from oldest to newest.
+func (r *RingClip) Snapshot() *Clip {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := NewClip(len(r.samples))
+	c.SampleRate = r.sampleRate
+	for chanNum, s := range r.samples {
+		end := r.start + r.length
+		if end > len(s) {
+			end = len(s)
+		}
+		samples := make([]int16, r.length)
+		n := copy(samples, s[r.start:end])
+		copy(samples[n:], s) // The newest samples, having wrapped around.
+		c.Samples[chanNum] = samples
+	}
+	return c
+}
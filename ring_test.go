@@ -0,0 +1,74 @@
+package audio
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRingClip(t *testing.T) {
+	r := NewRingClip(5, 2, 44100)
+	write := func(samples ...int16) {
+		negated := make([]int16, len(samples))
+		for i, sample := range samples {
+			negated[i] = -sample
+		}
+		if err := r.Write([][]int16{samples, negated}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(expected ...int16) {
+		c := r.Snapshot()
+		if c.SampleRate != 44100 {
+			t.Errorf("Expected a sample rate of %d instead of %d\n", 44100, c.SampleRate)
+		}
+		for chanNum, sign := range []int16{1, -1} {
+			if len(c.Samples[chanNum]) != len(expected) {
+				t.Fatalf("Expected %d samples instead of %d on channel %d\n",
+					len(expected), len(c.Samples[chanNum]), chanNum)
+			}
+			for i, e := range expected {
+				if actual := c.Samples[chanNum][i]; actual != sign*e {
+					t.Errorf("Expected %d instead of %d at offset %d on channel %d\n", sign*e, actual, i, chanNum)
+				}
+			}
+		}
+	}
+	check()
+	write(1, 2, 3)
+	check(1, 2, 3)
+	write(4, 5, 6)
+	check(2, 3, 4, 5, 6)
+	write(7)
+	check(3, 4, 5, 6, 7)
+	write(8, 9, 10, 11, 12, 13, 14)
+	check(10, 11, 12, 13, 14)
+	if n := r.LenPerChannel(); n != 5 {
+		t.Errorf("Expected %d samples per channel instead of %d\n", 5, n)
+	}
+	if err := r.Write([][]int16{{1}}); err == nil {
+		t.Errorf("Expected an error for writing too few channels.")
+	}
+	if err := r.Write([][]int16{{1}, {1, 2}}); err == nil {
+		t.Errorf("Expected an error for writing channels of different lengths.")
+	}
+}
+
+func TestRingClipConcurrency(t *testing.T) {
+	r := NewRingClip(100, 1, 44100)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			r.Write([][]int16{{int16(i), int16(i + 1), int16(i + 2)}})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		r.Snapshot()
+	}
+	wg.Wait()
+	c := r.Snapshot()
+	if actual := c.Samples[0][len(c.Samples[0])-1]; actual != 1001 {
+		t.Errorf("Expected the newest sample to be %d instead of %d\n", 1001, actual)
+	}
+}
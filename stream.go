@@ -0,0 +1,192 @@
+package audio
+
+import (
+	"fmt"
+	"github.com/aoeu/audio/encoding/wave"
+	"io"
+	"time"
+)
+
+// A SampleProcessor processes audio a block at a time, such as to apply effects to
+// audio streamed from files too long to hold in memory. Each block follows the last,
+// so processors with state (like filters or envelopes) carry it from block to block.
+type SampleProcessor interface {
+	// Processes a block of samples in place. The block has a slice of samples
+	// for each channel, all of the same length.
+	Process(buf [][]int16)
+}
+
+// A SampleProcessorFunc is a function used as a SampleProcessor.
+type SampleProcessorFunc func(buf [][]int16)
+
+func (f SampleProcessorFunc) Process(buf [][]int16) {
+	f(buf)
+}
+
+// A GainProcessor applies a constant linear gain (see DecibelGain), saturating
+// samples that exceed the range of 16-bit audio. Implements SampleProcessor.
+type GainProcessor struct {
+	Gain float64
+}
+
+func (g GainProcessor) Process(buf [][]int16) {
+	for _, samples := range buf {
+		amplify(samples, g.Gain)
+	}
+}
+
+// A GainEnvelopeProcessor applies a gain envelope, as per Clip.ApplyGainEnvelope,
+// to audio streamed from its start. Implements SampleProcessor.
+type GainEnvelopeProcessor struct {
+	points     []EnvelopePoint
+	sampleRate int
+	pos        int // The offset of the next sample to process.
+	next       int // The first point after the next sample.
+}
+
+// Creates a new GainEnvelopeProcessor applying an envelope of points, in order of time,
+// to audio of a sample rate.
+func NewGainEnvelopeProcessor(points []EnvelopePoint, sampleRate int) (*GainEnvelopeProcessor, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("Invalid sample rate of %d.", sampleRate)
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i].At < points[i-1].At {
+			return nil, fmt.Errorf("Envelope point %d at %v precedes the prior point at %v.",
+				i, points[i].At, points[i-1].At)
+		}
+	}
+	return &GainEnvelopeProcessor{points: points, sampleRate: sampleRate}, nil
+}
+
+// Returns the offset of a sample at a playback time.
+func (g *GainEnvelopeProcessor) offset(d time.Duration) int {
+	return int(int64(d) * int64(g.sampleRate) / int64(time.Second))
+}
+
+func (g *GainEnvelopeProcessor) Process(buf [][]int16) {
+	if len(g.points) == 0 || len(buf) == 0 {
+		return
+	}
+	for i := range buf[0] {
+		pos := g.pos + i
+		for g.next < len(g.points) && g.offset(g.points[g.next].At) <= pos {
+			g.next++
+		}
+		var gain float64
+		switch {
+		case g.next == 0:
+			gain = g.points[0].Gain
+		case g.next == len(g.points):
+			gain = g.points[len(g.points)-1].Gain
+		default:
+			from, to := g.points[g.next-1], g.points[g.next]
+			start, end := g.offset(from.At), g.offset(to.At)
+			gain = from.Gain + (to.Gain-from.Gain)*float64(pos-start)/float64(end-start)
+		}
+		for _, samples := range buf {
+			samples[i], _ = saturate(float64(samples[i]) * gain)
+		}
+	}
+	g.pos += len(buf[0])
+}
+
+// A LowPassProcessor filters out frequencies above a cutoff with a windowed sinc filter,
+// keeping the last samples of each block to filter the start of the next.
+// The filtered audio is delayed by the length of half the filter. Implements SampleProcessor.
+type LowPassProcessor struct {
+	kernel  []float64
+	history [][]float64 // The most recent samples of each channel, as long as the kernel.
+	at      int         // The offset in the history of the oldest sample.
+}
+
+// Creates a new LowPassProcessor for audio of a sample rate and number of channels,
+// with a cutoff frequency below the Nyquist frequency (half the sample rate).
+func NewLowPassProcessor(cutoffHz float64, sampleRate, numChannels int) (*LowPassProcessor, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("Invalid sample rate of %d.", sampleRate)
+	}
+	cutoff := cutoffHz / float64(sampleRate)
+	if cutoff <= 0 || cutoff >= 0.5 {
+		return nil, fmt.Errorf("Cutoff of %v Hz is not between 0 Hz and the Nyquist frequency of %v Hz.",
+			cutoffHz, sampleRate/2)
+	}
+	// Filters long enough to have a transition of about a tenth of the cutoff.
+	halfLen := int(sincZeroCrossings*0.05/cutoff) + sincZeroCrossings
+	l := &LowPassProcessor{
+		kernel:  lowPassKernel(cutoff, halfLen),
+		history: make([][]float64, numChannels),
+	}
+	for i := range l.history {
+		l.history[i] = make([]float64, len(l.kernel))
+	}
+	return l, nil
+}
+
+func (l *LowPassProcessor) Process(buf [][]int16) {
+	if len(buf) == 0 {
+		return
+	}
+	n := len(l.kernel)
+	for i := range buf[0] {
+		for chanNum, samples := range buf {
+			if chanNum >= len(l.history) {
+				break
+			}
+			history := l.history[chanNum]
+			history[l.at] = float64(samples[i])
+			// The newest sample meets the first tap, so the oldest meets the last.
+			var sum float64
+			for k, h := range l.kernel {
+				sum += history[(l.at-k+n)%n] * h
+			}
+			samples[i], _ = saturate(sum)
+		}
+		l.at = (l.at + 1) % n
+	}
+}
+
+// Streams audio from a decoder to an encoder through processors, in blocks of a number
+// of samples per channel, so that audio of any length is processed in constant memory.
+// The decoder and encoder must have the same number of channels. The encoder is not closed.
+func ProcessStream(d *wave.Decoder, e *wave.Encoder, blockLen int, processors ...SampleProcessor) error {
+	numChannels := d.NumChannels()
+	if int(e.Header.NumChannels) != numChannels {
+		return fmt.Errorf("Decoder has %d channels and encoder has %d channels.",
+			numChannels, e.Header.NumChannels)
+	}
+	if blockLen <= 0 {
+		return fmt.Errorf("Block length of %d is not positive.", blockLen)
+	}
+	interleaved := make([]int16, blockLen*numChannels)
+	buf := make([][]int16, numChannels)
+	for chanNum := range buf {
+		buf[chanNum] = make([]int16, blockLen)
+	}
+	for {
+		n, err := d.Read(interleaved)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		frames := n / numChannels
+		for chanNum := range buf {
+			buf[chanNum] = buf[chanNum][:frames]
+			for i := range buf[chanNum] {
+				buf[chanNum][i] = interleaved[i*numChannels+chanNum]
+			}
+		}
+		for _, p := range processors {
+			p.Process(buf)
+		}
+		for chanNum, samples := range buf {
+			for i, sample := range samples {
+				interleaved[i*numChannels+chanNum] = sample
+			}
+		}
+		if err := e.Write(interleaved[:n]); err != nil {
+			return err
+		}
+	}
+}
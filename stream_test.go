@@ -0,0 +1,84 @@
+package audio
+
+import (
+	"bytes"
+	"github.com/aoeu/audio/encoding/wave"
+	"testing"
+	"time"
+)
+
+// Processes a clip with processors in a single block.
+func processClip(c *Clip, processors ...SampleProcessor) {
+	for _, p := range processors {
+		p.Process(c.Samples)
+	}
+}
+
+func TestProcessStream(t *testing.T) {
+	c := NewClip(2)
+	c.SampleRate = 8000
+	c.Samples[0] = sineSamples(8000, 1000, 8000, 10000)
+	c.Samples[1] = sineSamples(8000, 3500, 8000, 10000)
+	b, err := NewWaveFromClip(c).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newProcessors := func() []SampleProcessor {
+		envelope, err := NewGainEnvelopeProcessor([]EnvelopePoint{{0, 0}, {time.Second / 2, 1}}, 8000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lowPass, err := NewLowPassProcessor(2000, 8000, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []SampleProcessor{GainProcessor{DecibelGain(6)}, envelope, lowPass}
+	}
+	d, err := wave.NewDecoder(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	e, err := wave.NewEncoder(&out, d.Header, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ProcessStream(d, e, 300, newProcessors()...); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d, err = wave.NewDecoder(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed := make([]int16, 2*len(c.Samples[0])+2)
+	n, err := d.Read(streamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processClip(c, newProcessors()...)
+	if n != 2*len(c.Samples[0]) {
+		t.Fatalf("Expected %d samples instead of %d\n", 2*len(c.Samples[0]), n)
+	}
+	for chanNum := range c.Samples {
+		for i, sample := range c.Samples[chanNum] {
+			if actual := streamed[i*2+chanNum]; actual != sample {
+				t.Fatalf("Expected %d instead of %d at offset %d on channel %d\n", sample, actual, i, chanNum)
+			}
+		}
+	}
+	// The 3500 Hz channel is filtered out by the low-pass, while 1000 Hz is not.
+	var peaks [2]int16
+	for chanNum := range c.Samples {
+		for _, sample := range c.Samples[chanNum][4000:] {
+			if sample > peaks[chanNum] {
+				peaks[chanNum] = sample
+			}
+		}
+	}
+	if peaks[0] < 19000 || peaks[1] > 200 {
+		t.Errorf("Expected peaks of about %d and 0 instead of %v\n", 20000, peaks)
+	}
+}